@@ -4,10 +4,12 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/gc"
+	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/utils"
 )
 
 func main() {
-	db.DbMgr = db.NewMainDatabaseMgr()
+	mgr := db.NewMainDatabaseMgr()
 
-	gc.ClearChunks(db.DbMgr)
+	gc.New(mgr, io.NewStore(utils.SettingsFromEnv(), nil)).ClearChunks()
 }
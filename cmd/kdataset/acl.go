@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type aclCmd struct {
+	workspace  string
+	name       string
+	owner      string
+	readers    []string
+	writers    []string
+	publicRead bool
+}
+
+func NewACLCmd() *cobra.Command {
+	acl := &aclCmd{}
+	parseArgs := func(args []string) error {
+		// Validation
+		if len(args) < 1 {
+			return errors.New("Too few arguments.")
+		}
+		acl.workspace = args[0]
+		if len(args) > 1 {
+			acl.name = args[1]
+		}
+		return nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "acl",
+		Short: "Manage access control lists of catalog entities. Without the entity name, the workspace defaults are managed.",
+	}
+
+	get := &cobra.Command{
+		Use:   "get <workspace> [<entity-name>]",
+		Short: "Show the access control list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := parseArgs(args); err != nil {
+				return err
+			}
+			return acl.get()
+		},
+	}
+
+	set := &cobra.Command{
+		Use:   "set <workspace> [<entity-name>]",
+		Short: "Replace the access control list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := parseArgs(args); err != nil {
+				return err
+			}
+			return acl.set()
+		},
+	}
+	f := set.Flags()
+	f.StringVar(&acl.owner, "owner", "", "Owner user, who may change the list. Defaults to the current user.")
+	f.StringSliceVar(&acl.readers, "reader", []string{}, "User with read access. May be repeated.")
+	f.StringSliceVar(&acl.writers, "writer", []string{}, "User with write access. May be repeated.")
+	f.BoolVar(&acl.publicRead, "public-read", false, "Allow reading without authentication.")
+
+	del := &cobra.Command{
+		Use:   "delete <workspace> [<entity-name>]",
+		Short: "Delete the access control list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := parseArgs(args); err != nil {
+				return err
+			}
+			return acl.delete()
+		},
+	}
+
+	cmd.AddCommand(get, set, del)
+	return cmd
+}
+
+func (cmd *aclCmd) get() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run acl get...")
+
+	acl, err := client.GetEntityACL(entityType.Value, cmd.workspace, cmd.name)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	fmt.Printf("Owner:       %v\n", acl.Owner)
+	fmt.Printf("Readers:     %v\n", strings.Join(acl.Readers, ", "))
+	fmt.Printf("Writers:     %v\n", strings.Join(acl.Writers, ", "))
+	fmt.Printf("Public read: %v\n", acl.PublicRead)
+	return nil
+}
+
+func (cmd *aclCmd) set() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run acl set...")
+
+	_, err = client.SetEntityACL(&types.EntityACL{
+		Type:       entityType.Value,
+		Workspace:  cmd.workspace,
+		Name:       cmd.name,
+		Owner:      cmd.owner,
+		Readers:    cmd.readers,
+		Writers:    cmd.writers,
+		PublicRead: cmd.publicRead,
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return nil
+}
+
+func (cmd *aclCmd) delete() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run acl delete...")
+
+	if err = client.DeleteEntityACL(entityType.Value, cmd.workspace, cmd.name); err != nil {
+		logrus.Fatal(err)
+	}
+	return nil
+}
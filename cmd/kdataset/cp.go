@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type cpCmd struct {
+	workspace string
+	name      string
+	version   string
+	from      string
+	to        string
+	source    string
+}
+
+func NewCopyCmd() *cobra.Command {
+	cp := &cpCmd{}
+	cmd := &cobra.Command{
+		Use:   "cp <workspace> <entity-name>:<version> <from> <to>",
+		Short: "Copy file or directory into the editing version without re-uploading.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 4 {
+				return errors.New("Too few arguments.")
+			}
+			cp.workspace = args[0]
+			cp.name, cp.version, err = parseNameVersion(args[1])
+			if err != nil {
+				return err
+			}
+			cp.from = args[2]
+			cp.to = args[3]
+
+			return cp.run()
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(
+		&cp.source,
+		"source",
+		"s",
+		"",
+		"Copy from another version, in form [<workspace>/]<entity-name>:<version>.",
+	)
+
+	return cmd
+}
+
+func (cmd *cpCmd) run() (err error) {
+	client, err := initClient()
+	if err != nil {
+		return err
+	}
+
+	src := types.FileSource{Path: cmd.from}
+	if cmd.source != "" {
+		source := cmd.source
+		if i := strings.Index(source, "/"); i >= 0 {
+			src.Workspace = source[:i]
+			source = source[i+1:]
+		}
+		src.Name, src.Version, err = parseNameVersion(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	logrus.Debug("Run copy...")
+
+	err = client.CopyFiles(entityType.Value, cmd.workspace, cmd.name, cmd.version, cmd.to, src)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infof("%v copied to %v.", cmd.from, cmd.to)
+	return
+}
@@ -39,7 +39,7 @@ func NewDatasetDeleteCmd() *cobra.Command {
 		"force",
 		"f",
 		false,
-		"Delete entity immediately (run garbage collector).",
+		"Delete entity immediately, bypassing trash (run garbage collector).",
 	)
 
 	return cmd
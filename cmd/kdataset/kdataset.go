@@ -7,9 +7,9 @@ import (
 	"os/user"
 	"strings"
 
-	"github.com/sirupsen/logrus"
 	"github.com/kuberlab/pluk/cmd/kdataset/config"
 	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"go.uber.org/automaxprocs/maxprocs"
 )
@@ -176,6 +176,16 @@ func newRootCmd() *cobra.Command {
 		NewVersionsCmd(),
 		NewDatasetDeleteCmd(),
 		NewVersionDeleteCmd(),
+		NewRestoreCmd(),
+		NewMoveCmd(),
+		NewCopyCmd(),
+		NewMergeCmd(),
+		NewRenameCmd(),
+		NewStatsCmd(),
+		NewTokenCmd(),
+		NewUserCmd(),
+		NewACLCmd(),
+		NewShareCmd(),
 	)
 	return rootCmd
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type mergeCmd struct {
+	workspace string
+	name      string
+	version   string
+	theirs    string
+	base      string
+	resolve   []string
+}
+
+func NewMergeCmd() *cobra.Command {
+	merge := &mergeCmd{}
+	cmd := &cobra.Command{
+		Use:   "merge <workspace> <entity-name>:<version> <their-version> --base <base-version>",
+		Short: "Merge changes made in another version since the base into the editing version.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 3 {
+				return errors.New("Too few arguments.")
+			}
+			if merge.base == "" {
+				return errors.New("Base version is required.")
+			}
+			merge.workspace = args[0]
+			merge.name, merge.version, err = parseNameVersion(args[1])
+			if err != nil {
+				return err
+			}
+			merge.theirs = args[2]
+
+			return merge.run()
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(
+		&merge.base,
+		"base",
+		"",
+		"The common version both versions were cloned from.",
+	)
+	f.StringArrayVar(
+		&merge.resolve,
+		"resolve",
+		[]string{},
+		"Resolve the conflict in form <path>=ours|theirs, may be repeated.",
+	)
+
+	return cmd
+}
+
+func (cmd *mergeCmd) run() (err error) {
+	client, err := initClient()
+	if err != nil {
+		return err
+	}
+
+	resolutions := make(map[string]string)
+	for _, r := range cmd.resolve {
+		pathSide := strings.SplitN(r, "=", 2)
+		if len(pathSide) != 2 {
+			return fmt.Errorf("Wrong resolution %v: must be in form <path>=ours|theirs", r)
+		}
+		resolutions[pathSide[0]] = pathSide[1]
+	}
+
+	logrus.Debug("Run merge...")
+
+	result, err := client.MergeVersion(
+		entityType.Value, cmd.workspace, cmd.name, cmd.version, cmd.theirs, cmd.base, resolutions,
+	)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infof(
+		"Merged %v into %v: %v added, %v modified, %v deleted.",
+		cmd.theirs, cmd.version, len(result.Added), len(result.Modified), len(result.Deleted),
+	)
+	if len(result.Conflicts) == 0 {
+		return nil
+	}
+
+	logrus.Warnf("%v conflicts left, resolve them with --resolve:", len(result.Conflicts))
+	w := tabwriter.NewWriter(os.Stdout, 5, 4, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PATH\tOURS\tTHEIRS")
+	for _, c := range result.Conflicts {
+		_, _ = fmt.Fprintln(w, strings.Join([]string{c.Path, c.Ours, c.Theirs}, "\t"))
+	}
+	_ = w.Flush()
+	return nil
+}
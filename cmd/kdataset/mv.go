@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type mvCmd struct {
+	workspace string
+	name      string
+	version   string
+	from      string
+	to        string
+}
+
+func NewMoveCmd() *cobra.Command {
+	mv := &mvCmd{}
+	cmd := &cobra.Command{
+		Use:   "mv <workspace> <entity-name>:<version> <from> <to>",
+		Short: "Move or rename file or directory inside the editing version.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 4 {
+				return errors.New("Too few arguments.")
+			}
+			mv.workspace = args[0]
+			mv.name, mv.version, err = parseNameVersion(args[1])
+			if err != nil {
+				return err
+			}
+			mv.from = args[2]
+			mv.to = args[3]
+
+			return mv.run()
+		},
+	}
+
+	return cmd
+}
+
+func (cmd *mvCmd) run() (err error) {
+	client, err := initClient()
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("Run move...")
+
+	err = client.MoveFiles(entityType.Value, cmd.workspace, cmd.name, cmd.version, cmd.from, cmd.to)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infof("%v moved to %v.", cmd.from, cmd.to)
+	return
+}
+
+func parseNameVersion(arg string) (name, version string, err error) {
+	nameVersion := strings.Split(arg, ":")
+	if len(nameVersion) != 2 || nameVersion[0] == "" || nameVersion[1] == "" {
+		return "", "", errors.New("Entity name is invalid. Must be in form <entity-name>:<version>")
+	}
+	return nameVersion[0], nameVersion[1], nil
+}
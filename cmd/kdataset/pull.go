@@ -10,6 +10,8 @@ import (
 
 	"io"
 
+	"github.com/kuberlab/pluk/pkg/manifest"
+	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -19,6 +21,7 @@ type pullCmd struct {
 	name      string
 	version   string
 	output    string
+	verifyKey string
 }
 
 func NewPullCmd() *cobra.Command {
@@ -60,6 +63,12 @@ func NewPullCmd() *cobra.Command {
 		"",
 		"Output filename",
 	)
+	f.StringVar(
+		&pull.verifyKey,
+		"verify-key",
+		"",
+		"Path to the trusted ed25519 public key (PEM); verify the version manifest signature",
+	)
 
 	return cmd
 }
@@ -84,8 +93,21 @@ func (cmd *pullCmd) run() (err error) {
 	}
 	defer f.Close()
 
+	var verifier *manifest.TarVerifier
+	if cmd.verifyKey != "" {
+		m, err := cmd.verifiedManifest(client)
+		if err != nil {
+			os.Remove(cmd.output)
+			logrus.Fatal(err)
+		}
+		verifier = manifest.NewTarVerifier(m)
+	}
+
 	bar := pb.New64(size).SetUnits(pb.U_BYTES)
-	w := io.MultiWriter(f, bar)
+	var w io.Writer = io.MultiWriter(f, bar)
+	if verifier != nil {
+		w = io.MultiWriter(f, bar, verifier)
+	}
 
 	bar.SetMaxWidth(100)
 	bar.ShowSpeed = true
@@ -101,6 +123,34 @@ func (cmd *pullCmd) run() (err error) {
 	}
 	bar.Finish()
 
+	if verifier != nil {
+		if err = verifier.Close(); err != nil {
+			os.Remove(cmd.output)
+			logrus.Fatalf("Verification failed: %v", err)
+		}
+		logrus.Infof("Manifest signature of %v:%v is valid.", cmd.name, cmd.version)
+	}
+
 	logrus.Infof("Successfully downloaded %v to %v.", entityType.Value, cmd.output)
 	return
 }
+
+func (cmd *pullCmd) verifiedManifest(client *plukclient.Client) (*manifest.Manifest, error) {
+	pub, err := manifest.LoadPublicKey(cmd.verifyKey)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := client.GetFSStructure(entityType.Value, cmd.workspace, cmd.name, cmd.version, "")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := client.GetManifestSignature(entityType.Value, cmd.workspace, cmd.name, cmd.version)
+	if err != nil {
+		return nil, err
+	}
+	m := manifest.FromFS(entityType.Value, cmd.workspace, cmd.name, cmd.version, fs)
+	if err = manifest.Verify(pub, m, sig); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
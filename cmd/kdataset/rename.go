@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type renameCmd struct {
+	workspace       string
+	name            string
+	targetName      string
+	targetWorkspace string
+}
+
+func NewRenameCmd() *cobra.Command {
+	rename := &renameCmd{}
+	cmd := &cobra.Command{
+		Use:   "rename <workspace> <entity-name> <new-name>",
+		Short: "Rename catalog entity or move it to another workspace.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 3 {
+				return errors.New("Too few arguments.")
+			}
+			rename.workspace = args[0]
+			rename.name = args[1]
+			rename.targetName = args[2]
+			if rename.targetWorkspace == "" {
+				rename.targetWorkspace = rename.workspace
+			}
+
+			return rename.run()
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(
+		&rename.targetWorkspace,
+		"target-workspace",
+		"",
+		"Move the entity to this workspace.",
+	)
+
+	return cmd
+}
+
+func (cmd *renameCmd) run() (err error) {
+	client, err := initClient()
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("Run rename...")
+
+	err = client.RenameEntity(entityType.Value, cmd.workspace, cmd.name, cmd.targetWorkspace, cmd.targetName)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infof(
+		"%v %v/%v successfully moved to %v/%v.",
+		strings.Title(entityType.Value), cmd.workspace, cmd.name, cmd.targetWorkspace, cmd.targetName,
+	)
+	return
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type restoreCmd struct {
+	workspace string
+	name      string
+	version   string
+	list      bool
+}
+
+func NewRestoreCmd() *cobra.Command {
+	restore := &restoreCmd{}
+	cmd := &cobra.Command{
+		Use:   "restore <workspace> [<entity-name>[:<version>]]",
+		Short: "Restore deleted catalog entity or its version from trash.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 1 {
+				return errors.New("Too few arguments.")
+			}
+			restore.workspace = args[0]
+			if restore.list {
+				return restore.runList()
+			}
+
+			if len(args) < 2 {
+				return errors.New("Too few arguments.")
+			}
+			nameVersion := strings.Split(args[1], ":")
+			if len(nameVersion) > 2 {
+				return errors.New("Entity name is invalid. Must be in form <entity-name>[:<version>]")
+			}
+			restore.name = nameVersion[0]
+			if len(nameVersion) == 2 {
+				restore.version = nameVersion[1]
+			}
+
+			return restore.run()
+		},
+	}
+	f := cmd.Flags()
+	f.BoolVarP(
+		&restore.list,
+		"list",
+		"l",
+		false,
+		"List the trash content of the workspace.",
+	)
+
+	return cmd
+}
+
+func (cmd *restoreCmd) run() (err error) {
+	client, err := initClient()
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("Run restore...")
+
+	if cmd.version == "" {
+		err = client.RestoreEntity(entityType.Value, cmd.workspace, cmd.name)
+	} else {
+		err = client.RestoreVersion(entityType.Value, cmd.workspace, cmd.name, cmd.version)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if cmd.version == "" {
+		logrus.Infof("%v %v successfully restored.", strings.Title(entityType.Value), cmd.name)
+	} else {
+		logrus.Infof(
+			"Version %v of %v %v successfully restored.",
+			cmd.version, entityType.Value, cmd.name,
+		)
+	}
+	return
+}
+
+func (cmd *restoreCmd) runList() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	trash, err := client.ListTrash(entityType.Value, cmd.workspace)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 4, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tVERSION\tDELETED\tPURGE AFTER")
+	for _, item := range trash.Items {
+		columns := []string{
+			item.Name,
+			item.Version,
+			item.DeletedAt.Format(time.RFC3339),
+			item.PurgeAt.Format(time.RFC3339),
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	_ = w.Flush()
+
+	return nil
+}
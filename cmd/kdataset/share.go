@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type shareCmd struct {
+	workspace string
+	name      string
+	version   string
+	path      string
+	expires   time.Duration
+	ip        string
+	maxSize   int64
+}
+
+func NewShareCmd() *cobra.Command {
+	share := &shareCmd{}
+	cmd := &cobra.Command{
+		Use:   "share <workspace> <entity-name>:<version> [<path>]",
+		Short: "Print the signed expiring URL of the file or, without the path, of the version tar archive.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 2 {
+				return errors.New("Too few arguments.")
+			}
+			share.workspace = args[0]
+			share.name, share.version, err = parseNameVersion(args[1])
+			if err != nil {
+				return err
+			}
+			if len(args) > 2 {
+				share.path = args[2]
+			}
+
+			return share.run()
+		},
+	}
+	f := cmd.Flags()
+	f.DurationVar(&share.expires, "expires", time.Hour, "URL lifetime, up to 168h.")
+	f.StringVar(&share.ip, "ip", "", "Allow the URL only from this address or CIDR.")
+	f.Int64Var(&share.maxSize, "max-size", 0, "Reject the download if it is larger than this size in bytes.")
+
+	return cmd
+}
+
+func (cmd *shareCmd) run() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run share...")
+
+	signed, err := client.SignURL(
+		entityType.Value, cmd.workspace, cmd.name, cmd.version, cmd.path, cmd.expires, cmd.ip, cmd.maxSize,
+	)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	fmt.Println(signed.URL)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type statsCmd struct {
+	workspace string
+	name      string
+	version   string
+	versions  bool
+}
+
+func NewStatsCmd() *cobra.Command {
+	stats := &statsCmd{}
+	cmd := &cobra.Command{
+		Use:   "stats <workspace> <entity-name>[:<version>]",
+		Short: "Show storage used by the catalog entity or its version, including shared and exclusive bytes.",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Validation
+			if len(args) < 2 {
+				return errors.New("Too few arguments.")
+			}
+			stats.workspace = args[0]
+			stats.name = args[1]
+			if strings.Contains(args[1], ":") {
+				stats.name, stats.version, err = parseNameVersion(args[1])
+				if err != nil {
+					return err
+				}
+			}
+
+			return stats.run()
+		},
+	}
+	f := cmd.Flags()
+	f.BoolVar(
+		&stats.versions,
+		"versions",
+		false,
+		"Show stats for every version of the entity as well.",
+	)
+
+	return cmd
+}
+
+func (cmd *statsCmd) run() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run stats...")
+
+	stats, err := client.GetStorageStats(entityType.Value, cmd.workspace, cmd.name, cmd.version, cmd.versions)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 4, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tFILES\tLOGICAL\tCHUNKS\tUNIQUE\tSHARED\tEXCLUSIVE\tDEDUP")
+	printStats(w, stats)
+	for _, v := range stats.Versions {
+		printStats(w, &v)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func printStats(w *tabwriter.Writer, stats *types.StorageStats) {
+	version := stats.Version
+	if version == "" {
+		version = "*"
+	}
+	columns := []string{
+		version,
+		fmt.Sprintf("%v", stats.Files),
+		sizeString(stats.LogicalBytes),
+		fmt.Sprintf("%v", stats.UniqueChunks),
+		sizeString(stats.UniqueBytes),
+		sizeString(stats.SharedBytes),
+		sizeString(stats.ExclusiveBytes),
+		fmt.Sprintf("%.2f", stats.DedupRatio),
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(columns, "\t"))
+}
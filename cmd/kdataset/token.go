@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type tokenCmd struct {
+	user    string
+	name    string
+	scopes  []string
+	expires time.Duration
+}
+
+func NewTokenCmd() *cobra.Command {
+	token := &tokenCmd{}
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens of the built-in authentication (admin only).",
+	}
+
+	create := &cobra.Command{
+		Use:   "create <user>",
+		Short: "Create the token for the user and print it. The token can't be shown again.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validation
+			if len(args) < 1 {
+				return errors.New("Too few arguments.")
+			}
+			token.user = args[0]
+			return token.create()
+		},
+	}
+	f := create.Flags()
+	f.StringVar(&token.name, "name", "", "Token name, e.g. where it is used.")
+	f.StringSliceVar(
+		&token.scopes,
+		"scope",
+		[]string{},
+		"Access granted by the token as <workspace>:<read|write>, '*' means any workspace. May be repeated.",
+	)
+	f.DurationVar(&token.expires, "expires", 0, "Token lifetime, e.g. 720h. Never expires by default.")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List tokens.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return token.list()
+		},
+	}
+	list.Flags().StringVar(&token.user, "user", "", "List tokens of this user only.")
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke the token.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validation
+			if len(args) < 1 {
+				return errors.New("Too few arguments.")
+			}
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid token id: %v", err)
+			}
+			return token.revoke(uint(id))
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
+
+func (cmd *tokenCmd) create() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	token := &types.Token{User: cmd.user, Name: cmd.name, Scopes: make([]types.TokenScope, 0)}
+	for _, s := range cmd.scopes {
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid scope %q: must be <workspace>:<read|write>", s)
+		}
+		token.Scopes = append(token.Scopes, types.TokenScope{Workspace: parts[0], Access: parts[1]})
+	}
+	if cmd.expires > 0 {
+		expiresAt := time.Now().Add(cmd.expires)
+		token.ExpiresAt = &expiresAt
+	}
+
+	logrus.Debug("Run token create...")
+
+	created, err := client.CreateToken(token)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	fmt.Println(created.Token)
+	return nil
+}
+
+func (cmd *tokenCmd) list() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run token list...")
+
+	tokens, err := client.ListTokens(cmd.user)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 4, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tUSER\tNAME\tSCOPES\tEXPIRES")
+	for _, t := range tokens.Items {
+		scopes := make([]string, 0)
+		for _, s := range t.Scopes {
+			scopes = append(scopes, s.Workspace+":"+s.Access)
+		}
+		expires := "never"
+		if t.ExpiresAt != nil {
+			expires = t.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", t.ID, t.User, t.Name, strings.Join(scopes, ","), expires)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func (cmd *tokenCmd) revoke(id uint) error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run token revoke...")
+
+	if err = client.DeleteToken(id); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("Token %v revoked.", id)
+	return nil
+}
+
+type userCmd struct {
+	admin bool
+}
+
+func NewUserCmd() *cobra.Command {
+	user := &userCmd{}
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users of the built-in authentication (admin only).",
+	}
+
+	create := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create the user.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validation
+			if len(args) < 1 {
+				return errors.New("Too few arguments.")
+			}
+			return user.create(args[0])
+		},
+	}
+	create.Flags().BoolVar(&user.admin, "admin", false, "Allow the user to manage users and tokens and run admin operations.")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List users.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return user.list()
+		},
+	}
+
+	del := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete the user and revoke all its tokens.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validation
+			if len(args) < 1 {
+				return errors.New("Too few arguments.")
+			}
+			return user.delete(args[0])
+		},
+	}
+
+	cmd.AddCommand(create, list, del)
+	return cmd
+}
+
+func (cmd *userCmd) create(name string) error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run user create...")
+
+	if err = client.CreateUser(&types.User{Name: name, Admin: cmd.admin}); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("User %v created.", name)
+	return nil
+}
+
+func (cmd *userCmd) list() error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run user list...")
+
+	users, err := client.ListUsers()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 4, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tADMIN")
+	for _, u := range users.Items {
+		_, _ = fmt.Fprintf(w, "%v\t%v\n", u.Name, u.Admin)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func (cmd *userCmd) delete(name string) error {
+	client, err := initClient()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Debug("Run user delete...")
+
+	if err = client.DeleteUser(name); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("User %v deleted.", name)
+	return nil
+}
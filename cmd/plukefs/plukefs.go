@@ -11,8 +11,7 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse/nodefs"
 	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
 	"github.com/kuberlab/pluk/pkg/fuse"
-	"github.com/kuberlab/pluk/pkg/io"
-	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -58,6 +57,8 @@ type plukeFSCmd struct {
 	server          string
 	secret          string
 	dsType          string
+	verifyKey       string
+	metricsAddr     string
 }
 
 func newPlukeFSCmd() *cobra.Command {
@@ -101,6 +102,16 @@ func newPlukeFSCmd() *cobra.Command {
 					plukeFS.mountPoint = value
 				case "type":
 					plukeFS.dsType = value
+				case "verify_key":
+					plukeFS.verifyKey = value
+				case "metrics_addr":
+					plukeFS.metricsAddr = value
+				case "ca_file":
+					_ = os.Setenv(utils.TLSCAFileVar, value)
+				case "insecure":
+					_ = os.Setenv(utils.TLSInsecureVar, value)
+				case "grpc_tls":
+					_ = os.Setenv(utils.GrpcTLSVar, value)
 				case "workspace":
 					logrus.Info("Fallback to use 'workspace' as the object and secret workspace both.")
 					plukeFS.objectWorkspace = value
@@ -160,14 +171,14 @@ func (cmd *plukeFSCmd) run() int {
 	logrus.Debugf("Start with secret=%v", cmd.secret)
 
 	_ = os.Setenv(utils.DoNotSaveChunks, "true")
-	_ = os.Setenv(utils.MastersVar, cmd.server)
-	utils.UseGrpc = true
 	_ = os.Setenv("USE_GRPC", "true")
 
-	io.MasterClient = plukclient.NewMasterClientWithSecret(cmd.secretWorkspace, cmd.secret)
 	if logrus.GetLevel() == logrus.DebugLevel {
 		utils.PrintEnvInfo()
 	}
+	if cmd.metricsAddr != "" {
+		go metrics.Serve(cmd.metricsAddr)
+	}
 
 	plukefs, err := fuse.NewPlukeFS(
 		cmd.dsType,
@@ -177,6 +188,7 @@ func (cmd *plukeFSCmd) run() int {
 		cmd.server,
 		cmd.secret,
 		cmd.secretWorkspace,
+		cmd.verifyKey,
 	)
 	if err != nil {
 		fmt.Println(err)
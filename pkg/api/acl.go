@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/auth"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+func (api *API) getEntityACL(req *restful.Request, resp *restful.Response) {
+	eType := currentType(req)
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+
+	if req.QueryParameter("effective") == "true" {
+		acl := api.tokens.EffectiveACL(eType, workspace, name)
+		if acl == nil {
+			WriteErrorString(resp, http.StatusNotFound, fmt.Sprintf("ACL for %v %v/%v not found", eType, workspace, name))
+			return
+		}
+		resp.WriteEntity(acl)
+		return
+	}
+
+	acl, err := api.tokens.GetACL(eType, workspace, name)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(acl)
+}
+
+func (api *API) setEntityACL(req *restful.Request, resp *restful.Response) {
+	eType := currentType(req)
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	if err := api.checkACLEnforced(); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	acl := new(types.EntityACL)
+	if err := req.ReadEntity(acl); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+	if err := api.checkACLOwner(req, eType, workspace, name); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if _, err := api.ds.GetDataset(eType, workspace, name, master); err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	acl.Type = eType
+	acl.Workspace = workspace
+	acl.Name = name
+	if user, ok := req.Attribute("user").(string); ok && acl.Owner == "" {
+		acl.Owner = user
+	} else if id := api.dealerIdentity(req); id != nil && acl.Owner == "" {
+		acl.Owner = id.User
+	}
+	if err := api.tokens.SetACL(acl); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(acl)
+}
+
+func (api *API) deleteEntityACL(req *restful.Request, resp *restful.Response) {
+	eType := currentType(req)
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+
+	if err := api.checkACLEnforced(); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if err := api.checkACLOwner(req, eType, workspace, name); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if err := api.tokens.DeleteACL(eType, workspace, name); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) getWorkspaceACL(req *restful.Request, resp *restful.Response) {
+	acl, err := api.tokens.GetACL(currentType(req), req.PathParameter("workspace"), "")
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(acl)
+}
+
+func (api *API) setWorkspaceACL(req *restful.Request, resp *restful.Response) {
+	if err := api.checkACLEnforced(); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	acl := new(types.EntityACL)
+	if err := req.ReadEntity(acl); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+	acl.Type = currentType(req)
+	acl.Workspace = req.PathParameter("workspace")
+	acl.Name = ""
+	if err := api.tokens.SetACL(acl); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(acl)
+}
+
+func (api *API) deleteWorkspaceACL(req *restful.Request, resp *restful.Response) {
+	if err := api.checkACLEnforced(); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if err := api.tokens.DeleteACL(currentType(req), req.PathParameter("workspace"), ""); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// checkACLOwner allows changing the dataset ACL only to its owner or admin.
+// In the dealer mode the owner is the user AUTH_VALIDATION resolves and
+// the dataset without an owner may be claimed by anyone passing the regular
+// auth check.
+func (api *API) checkACLOwner(req *restful.Request, eType, workspace, name string) error {
+	if req.Attribute("internal") == "true" {
+		return nil
+	}
+	forbidden := errors.NewStatus(
+		http.StatusForbidden,
+		fmt.Sprintf("Only the owner may change ACL of %v %v/%v.", eType, workspace, name),
+	)
+	if api.dealerAuth() {
+		acl := api.tokens.EffectiveACL(eType, workspace, name)
+		if acl == nil || acl.Owner == "" {
+			return nil
+		}
+		if id := api.dealerIdentity(req); id != nil && id.User == acl.Owner {
+			return nil
+		}
+		return forbidden
+	}
+	if !api.localAuthEnabled() {
+		return nil
+	}
+	id, _ := req.Attribute("identity").(*auth.Identity)
+	if !api.tokens.IsOwner(id, eType, workspace, name) {
+		return forbidden
+	}
+	return nil
+}
+
+// checkACLEnforced rejects ACL changes which would have no effect: slaves
+// get decisions from the master and without authentication nothing is checked.
+func (api *API) checkACLEnforced() error {
+	if api.settings.HasMasters() {
+		return errors.NewStatus(http.StatusConflict, "ACLs are managed by the master, change them there.")
+	}
+	if !api.localAuthEnabled() && !api.dealerAuth() {
+		return errors.NewStatus(http.StatusNotImplemented, "ACLs are not enforced without authentication.")
+	}
+	return nil
+}
+
+// dealerIdentity is the user AUTH_VALIDATION resolves for the request,
+// nil if it is unknown. ACLs list these users in the dealer mode.
+func (api *API) dealerIdentity(req *restful.Request) *auth.Identity {
+	if !api.dealerAuth() {
+		return nil
+	}
+	login := api.dealerLogin(req.HeaderParameter("Authorization"), req.HeaderParameter("Cookie"))
+	if login == "" {
+		return nil
+	}
+	return &auth.Identity{User: login}
+}
+
+// authorizeDealerACL checks access to the dataset in the dealer mode if it
+// or its workspace has an ACL; the ACL decides instead of the dealer then.
+// Without an ACL decided is false.
+func (api *API) authorizeDealerACL(req *restful.Request, write bool, eType, workspace, name string) (decided bool, err error) {
+	if workspace == "" || name == "" || api.tokens.EffectiveACL(eType, workspace, name) == nil {
+		return false, nil
+	}
+	return true, api.tokens.Authorize(api.dealerIdentity(req), write, eType, workspace, name)
+}
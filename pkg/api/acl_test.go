@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestEntityACL(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	if err := testMgr.CreateDataset(&db.Dataset{Workspace: "workspace", Name: "secret", Type: "dataset"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "partner"} {
+		resp := authRequest(t, http.MethodPost, "admin/users", "", `{"name": "`+user+`"}`)
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+	alice := createToken(t, `{"user": "alice", "scopes": [{"workspace": "workspace", "access": "write"}]}`)
+	bob := createToken(t, `{"user": "bob", "scopes": [{"workspace": "workspace", "access": "write"}]}`)
+	partner := createToken(t, `{"user": "partner", "scopes": []}`)
+
+	resp := authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", alice.Token, fileData1)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", partner.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	// Share the dataset with the partner.
+	resp = authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", alice.Token, `{"readers": ["partner"]}`)
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", alice.Token, `{"readers": ["nobody"]}`)
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/acl", partner.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var acl types.EntityACL
+	if err := json.NewDecoder(resp.Body).Decode(&acl); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("alice", acl.Owner, t)
+	utils.Assert([]string{"partner"}, acl.Readers, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", partner.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions/1.0.0/raw/file1.txt", partner.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/secret/versions", partner.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file2.txt", partner.Token, fileData2)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", partner.Token, `{"readers": ["partner"], "writers": ["partner"]}`)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	// The ACL decides over workspace scopes: bob isn't listed anymore.
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", bob.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/secret/versions", bob.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "workspaces/workspace/dataset/dataset/spec", bob.Token, "{}")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "workspaces/workspace/dataset/dataset", bob.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	for _, path := range []string{"dataset", "dataset/workspace"} {
+		resp = authRequest(t, http.MethodGet, path, bob.Token, "")
+		utils.Assert(http.StatusOK, resp.StatusCode, t)
+		var list types.DataSetList
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(1, len(list.Items), t)
+		utils.Assert("secret", list.Items[0].Name, t)
+	}
+
+	// Chunks of the shared dataset are readable, also via gRPC.
+	var hash string
+	if err := testMgr.DB().Table("chunks").Select("hash").Row().Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	resp = authRequest(t, http.MethodGet, "chunks/"+hash, partner.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	ok, _ := testAPI.CheckChunkAuth("workspace", partner.Token, hash)
+	utils.Assert(true, ok, t)
+	ok, _ = testAPI.CheckChunkAuth("workspace", partner.Token, "0123456789abcdef")
+	utils.Assert(false, ok, t)
+
+	// Workspace defaults are inherited by all datasets.
+	resp, err := client.Get(buildURL("dataset/workspace/secret/versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPut, "acl/dataset/workspace", alice.Token, `{"public_read": true}`)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPut, "acl/dataset/workspace", "", `{"writers": ["bob"], "public_read": true}`)
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp, err = client.Get(buildURL("dataset/workspace/secret/versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp, err = client.Post(buildURL("dataset/workspace/secret/versions/1.0.0"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file2.txt", bob.Token, fileData2)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/acl?effective=true", alice.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	acl = types.EntityACL{}
+	if err = json.NewDecoder(resp.Body).Decode(&acl); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("alice", acl.Owner, t)
+	utils.Assert([]string{"bob"}, acl.Writers, t)
+	utils.Assert(true, acl.PublicRead, t)
+
+	resp = authRequest(t, http.MethodDelete, "dataset/workspace/dataset/acl", alice.Token, "")
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodDelete, "acl/dataset/workspace", "", "")
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", partner.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+}
+
+func TestSlaveEntityACL(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	if err := testMgr.CreateDataset(&db.Dataset{Workspace: "workspace", Name: "secret", Type: "dataset"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "partner"} {
+		resp := authRequest(t, http.MethodPost, "admin/users", "", `{"name": "`+user+`"}`)
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+	alice := createToken(t, `{"user": "alice", "scopes": [{"workspace": "workspace", "access": "write"}]}`)
+	bob := createToken(t, `{"user": "bob", "scopes": [{"workspace": "workspace", "access": "write"}]}`)
+	partner := createToken(t, `{"user": "partner", "scopes": []}`)
+	resp := authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", alice.Token, `{"readers": ["partner"]}`)
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	// The slave asks the master about the dataset, not only the workspace.
+	slave, closeSlave := startSlave(t, server.URL)
+	defer closeSlave()
+	slaveRequest := func(method, path, token, body string) int {
+		req, _ := http.NewRequest(method, slave.URL+utils.ApiPrefix+"/"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	utils.Assert(http.StatusOK, slaveRequest(http.MethodGet, "dataset/workspace/dataset/versions", alice.Token, ""), t)
+	utils.Assert(http.StatusOK, slaveRequest(http.MethodGet, "dataset/workspace/dataset/versions", partner.Token, ""), t)
+	utils.Assert(http.StatusForbidden, slaveRequest(http.MethodGet, "dataset/workspace/dataset/versions", bob.Token, ""), t)
+	utils.Assert(http.StatusForbidden, slaveRequest(http.MethodGet, "dataset/workspace/secret/versions", partner.Token, ""), t)
+	utils.Assert(http.StatusForbidden, slaveRequest(http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", partner.Token, fileData1), t)
+
+	// ACLs are changed on the master only.
+	utils.Assert(http.StatusConflict, slaveRequest(http.MethodPut, "dataset/workspace/dataset/acl", alice.Token, `{"readers": ["bob"]}`), t)
+}
+
+func TestDealerEntityACL(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	// ACLs have no effect without authentication.
+	resp := authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", "alice", `{"readers": ["bob"]}`)
+	utils.Assert(http.StatusNotImplemented, resp.StatusCode, t)
+
+	dealer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v0.2/workspace/") {
+			w.Write([]byte(`{"can": ["dataset.read", "dataset.manage"]}`))
+			return
+		}
+		w.Write([]byte(`{"login": "` + strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") + `"}`))
+	}))
+	defer dealer.Close()
+	testAPI.settings.AuthURL = dealer.URL + "/api/v0.2/me"
+
+	// The first user claims the dataset and the ACL decides instead of the dealer.
+	resp = authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", "alice", `{"readers": ["partner"]}`)
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var acl types.EntityACL
+	if err := json.NewDecoder(resp.Body).Decode(&acl); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("alice", acl.Owner, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", "partner", "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", "bob", "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", "partner", fileData1)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPut, "dataset/workspace/dataset/acl", "partner", `{"writers": ["partner"]}`)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace", "bob", "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var list types.DataSetList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(0, len(list.Items), t)
+
+	resp = authRequest(t, http.MethodDelete, "dataset/workspace/dataset/acl", "alice", "")
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", "bob", "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+}
@@ -1,16 +1,54 @@
 package api
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
 	"github.com/emicklei/go-restful"
-	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/jobs"
 )
 
 func (api *API) runGC(req *restful.Request, resp *restful.Response) {
-	utils.GCChan <- "Run GC by API request"
-	resp.Write([]byte("GC started!\n"))
+	record := &db.Job{Type: jobs.TypeGC}
+	api.submitJob(resp, record, false, true, http.StatusOK,
+		func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+			api.gc.GoGC()
+			return nil, nil
+		},
+	)
 }
 
 func (api *API) runClearChunks(req *restful.Request, resp *restful.Response) {
-	utils.GCClearChunks <- "Run by API request"
-	resp.Write([]byte("Clear chunks started!\n"))
+	record := &db.Job{Type: jobs.TypeClearChunks}
+	api.submitJob(resp, record, false, true, http.StatusOK,
+		func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+			api.gc.ClearChunks()
+			return nil, nil
+		},
+	)
+}
+
+// getConfig shows the settings of the server with secrets redacted.
+func (api *API) getConfig(req *restful.Request, resp *restful.Response) {
+	conf := api.settings.EffectiveConfig()
+	if addr, ok := req.Request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		conf.HTTPPort = addrPort(addr.String())
+	}
+	api.grpcState.RLock()
+	conf.GrpcPort = addrPort(api.grpcState.addr)
+	api.grpcState.RUnlock()
+	resp.WriteEntity(conf)
+}
+
+// addrPort returns the port of the listen address, 0 if there is none.
+func addrPort(addr string) int {
+	_, raw, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(raw)
+	return port
 }
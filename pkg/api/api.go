@@ -1,67 +1,111 @@
 package api
 
 import (
-	"fmt"
+	"context"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/gorilla/mux"
+	"github.com/kuberlab/pluk/pkg/audit"
+	"github.com/kuberlab/pluk/pkg/auth"
 	"github.com/kuberlab/pluk/pkg/datasets"
 	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/gc"
 	plukio "github.com/kuberlab/pluk/pkg/io"
-	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/jobs"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
 )
 
 type API struct {
-	ds      *datasets.Manager
-	mgr     db.DataMgr
-	cache   *utils.RequestCache
-	fsCache *utils.RequestCache
-	client  *http.Client
-	hub     *types.Hub
-	watcher *Watcher
+	ds       *datasets.Manager
+	mgr      db.DataMgr
+	store    *plukio.Store
+	settings *utils.Settings
+	cache    *utils.RequestCache
+	fsCache  *utils.RequestCache
+	client   *http.Client
+	hub      *types.Hub
+	watcher  *Watcher
+	jobs     *jobs.Manager
+	audit    *audit.Logger
+	tokens   *auth.Manager
+	jwt      *auth.JWTVerifier
+	jwtKeys  *auth.KeySet
+	gc       *gc.Collector
 
 	lock      sync.RWMutex
 	saveLocks map[string]*sync.RWMutex
-}
 
-var (
-	GlobalAPI *API
-)
+	grpcState struct {
+		sync.RWMutex
+		addr string
+		err  error
+	}
+}
 
-func Build() *API {
+// New builds the API serving the database and the chunk store.
+// The collector is triggered when entities are deleted with force.
+func New(mgr db.DataMgr, store *plukio.Store, collector *gc.Collector) *API {
 	hub := types.NewHub()
-	GlobalAPI = &API{
+	api := &API{
+		store:     store,
+		settings:  store.Settings,
 		cache:     utils.NewRequestCache(),
 		fsCache:   utils.NewRequestCache(),
-		client:    &http.Client{Timeout: time.Minute},
-		ds:        datasets.NewManager(db.DbMgr, hub),
-		mgr:       db.DbMgr,
+		client:    &http.Client{Timeout: time.Minute, Transport: clientTransport()},
+		ds:        datasets.NewManager(mgr, hub, store),
+		mgr:       mgr,
 		hub:       hub,
+		jobs:      jobs.NewManager(mgr),
+		audit:     audit.NewLogger(mgr, utils.AuditLogFile()),
+		tokens:    auth.NewManager(mgr, store.Settings),
+		gc:        collector,
 		saveLocks: make(map[string]*sync.RWMutex),
 	}
-	return GlobalAPI
+	api.ds.SetGCTrigger(collector.Trigger)
+	if api.settings.JWTAuth() {
+		conf := api.settings.JWT
+		api.jwtKeys = auth.NewKeySet(conf.Keys)
+		api.jwt = auth.NewJWTVerifier(api.jwtKeys, conf.Audience, conf.Issuer, conf.UserClaim, conf.ScopesClaim)
+	}
+	return api
 }
 
-func Start(api *API) {
-	logrus.Info("Starting pluke...")
-	utils.PrintEnvInfo()
+// Store returns the chunk store of the API.
+func (api *API) Store() *plukio.Store {
+	return api.store
+}
 
-	port := utils.HttpPort()
-	if err := http.ListenAndServe(fmt.Sprintf(":%v", port), GlobalHandler(api)); err != nil {
-		logrus.Error(err)
-		os.Exit(1)
+// Close stops the watcher and closes websockets of slaves.
+func (api *API) Close() {
+	if api.watcher != nil {
+		api.watcher.close()
 	}
+	api.hub.Close()
+}
+
+// ShutdownJobs stops background jobs, see jobs.Manager.Shutdown.
+func (api *API) ShutdownJobs(ctx context.Context) error {
+	return api.jobs.Shutdown(ctx)
+}
+
+// CloseWebsockets tells slaves to reconnect elsewhere.
+func (api *API) CloseWebsockets() {
+	api.hub.Close()
+}
+
+// clientTransport is used for outbound calls to the auth service and masters.
+func clientTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = utils.ClientTLSConfig()
+	return transport
 }
 
 func GlobalHandler(api *API) http.Handler {
-	plukio.MasterClient = plukclient.NewInternalMasterClient()
 	restful.PrettyPrintResponses = utils.PrettyPrintEnabled()
 
 	r := mux.NewRouter()
@@ -80,13 +124,18 @@ func GlobalHandler(api *API) http.Handler {
 
 	r.Path("/probe").HandlerFunc(
 		func(resp http.ResponseWriter, req *http.Request) {
+			setRoute(resp, "/probe")
 			resp.Write([]byte("Ok\n"))
 		},
 	)
-
-	port := utils.HttpPort()
-
-	logrus.Infof("Listen at *:%v", port)
+	r.Path("/healthz").HandlerFunc(api.healthz)
+	r.Path("/readyz").HandlerFunc(api.readyz)
+	r.Path("/metrics").HandlerFunc(
+		func(resp http.ResponseWriter, req *http.Request) {
+			setRoute(resp, "/metrics")
+			metrics.Handler().ServeHTTP(resp, req)
+		},
+	)
 
 	// Request master via websocket here (deleted version - invalidate cache)
 	api.StartWatcher()
@@ -106,33 +155,73 @@ func NewApiContainer(api *API, prefix string) *restful.Container {
 	ws.Route(ws.GET("/workspaces/{workspace}").To(api.checkWorkspace))
 	ws.Route(ws.GET("/workspaces/{workspace}/{entityType}/{dataset}").To(api.checkDatasetExists))
 	ws.Route(ws.GET("/workspaces/{workspace}/{entityType}/{dataset}/permission").To(api.checkDatasetPermission))
-	ws.Route(ws.POST("/workspaces/{workspace}/{entityType}/{dataset}/spec").To(api.postSpec))
-	ws.Route(ws.POST("/workspaces/{workspace}/{entityType}/{dataset}/versions/{version}/spec").To(api.postVersionSpec))
+	ws.Route(ws.POST("/workspaces/{workspace}/{entityType}/{dataset}/spec").Filter(api.Audit("post-spec")).To(api.postSpec))
+	ws.Route(ws.POST("/workspaces/{workspace}/{entityType}/{dataset}/versions/{version}/spec").Filter(api.Audit("post-version-spec")).To(api.postVersionSpec))
 
 	// Items
 	ws.Route(ws.GET("/{entityType}").To(api.datasets))
 	ws.Route(ws.GET("/{entityType}/{workspace}").To(api.datasets))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}").To(api.getDataset))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}").To(api.downloadDataset))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}").To(api.createDataset))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/fork/{targetWorkspace}").To(api.forkDataset))
-	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}").To(api.deleteDataset))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}").Filter(api.Audit("create")).To(api.createDataset))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/fork/{targetWorkspace}").Filter(api.Audit("fork")).To(api.forkDataset))
+	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}").Filter(api.Audit("delete")).To(api.deleteDataset))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/rename/{targetName}").Filter(api.Audit("rename")).To(api.renameDataset))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/move/{targetWorkspace}").Filter(api.Audit("move")).To(api.renameDataset))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/restore").Filter(api.Audit("restore")).To(api.restoreDataset))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/retention").To(api.getRetentionPolicy))
+	ws.Route(ws.PUT("/{entityType}/{workspace}/{name}/retention").Filter(api.Audit("set-retention")).To(api.setRetentionPolicy))
+	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/retention").Filter(api.Audit("delete-retention")).To(api.deleteRetentionPolicy))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/retention/dry-run").To(api.retentionDryRun))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/acl").To(api.getEntityACL))
+	ws.Route(ws.PUT("/{entityType}/{workspace}/{name}/acl").Filter(api.Audit("set-acl")).To(api.setEntityACL))
+	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/acl").Filter(api.Audit("delete-acl")).To(api.deleteEntityACL))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/stats").To(api.storageStats))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions").To(api.versions))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}").To(api.createVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}").Filter(api.Audit("create-version")).To(api.createVersion))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/get").To(api.getVersion))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/clone/{targetVersion}").To(api.cloneVersion))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/commit").To(api.commitVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/clone/{targetVersion}").Filter(api.Audit("clone-version")).To(api.cloneVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/commit").Filter(api.Audit("commit-version")).To(api.commitVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/merge/{theirs}").Filter(api.Audit("merge-version")).To(api.mergeVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/reopen").Filter(api.Audit("reopen-version")).Filter(api.AdminHook).To(api.reopenVersion))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/manifest.sig").To(api.getManifestSignature))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/fs").To(api.getDatasetFS))
-	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/versions/{version}").To(api.deleteVersion))
+	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/versions/{version}").Filter(api.Audit("delete-version")).To(api.deleteVersion))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/restore").Filter(api.Audit("restore-version")).To(api.restoreVersion))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/tarsize").To(api.datasetTarSize))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/stats").To(api.storageStats))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/tree").To(api.fsReadDir))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/tree/{path:*}").To(api.fsReadDir))
 	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/raw/{path:*}").To(api.fsReadFile))
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/upload/{path:*}").To(api.uploadDatasetFile))
-	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/versions/{version}/upload/{path:*}").To(api.deleteDatasetFile))
+	ws.Route(ws.GET("/{entityType}/{workspace}/{name}/versions/{version}/signed-url").Filter(api.Audit("sign-url")).To(api.signVersionURL))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/upload/{path:*}").Filter(api.Audit("upload-file")).To(api.uploadDatasetFile))
+	ws.Route(ws.DELETE("/{entityType}/{workspace}/{name}/versions/{version}/upload/{path:*}").Filter(api.Audit("delete-file")).To(api.deleteDatasetFile))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/move").Filter(api.Audit("move-files")).To(api.moveFiles))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/copy").Filter(api.Audit("copy-files")).To(api.copyFiles))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/versions/{version}/ingest").Filter(api.Audit("ingest-archive")).To(api.ingestArchive))
 
 	// Save file structure for version.
-	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/{version}").To(api.saveFS))
+	ws.Route(ws.POST("/{entityType}/{workspace}/{name}/{version}").Filter(api.Audit("save-fs")).To(api.saveFS))
+
+	// Trash
+	ws.Route(ws.GET("/trash/{entityType}/{workspace}").To(api.listTrash))
+
+	// Workspace default ACLs
+	ws.Route(ws.GET("/acl/{entityType}/{workspace}").To(api.getWorkspaceACL))
+	ws.Route(ws.PUT("/acl/{entityType}/{workspace}").Filter(api.Audit("set-acl")).Filter(api.AdminHook).To(api.setWorkspaceACL))
+	ws.Route(ws.DELETE("/acl/{entityType}/{workspace}").Filter(api.Audit("delete-acl")).Filter(api.AdminHook).To(api.deleteWorkspaceACL))
+
+	// Jobs
+	ws.Route(ws.GET("/jobs").Filter(api.AdminHook).To(api.listJobs))
+	ws.Route(ws.GET("/jobs/{workspace}").To(api.listJobs))
+	ws.Route(ws.GET("/jobs/{workspace}/{id}").To(api.getJob))
+	ws.Route(ws.POST("/jobs/{workspace}/{id}/cancel").Filter(api.Audit("cancel-job")).To(api.cancelJob))
+
+	// Storage usage and quotas
+	ws.Route(ws.GET("/usage/{workspace}").To(api.workspaceUsage))
+	ws.Route(ws.GET("/quotas/{workspace}").To(api.getWorkspaceQuota))
+	ws.Route(ws.PUT("/quotas/{workspace}").Filter(api.Audit("set-quota")).Filter(api.AdminHook).To(api.setWorkspaceQuota))
+	ws.Route(ws.DELETE("/quotas/{workspace}").Filter(api.Audit("delete-quota")).Filter(api.AdminHook).To(api.deleteWorkspaceQuota))
 
 	// Chunks
 	// Check if chunk exists
@@ -140,6 +229,7 @@ func NewApiContainer(api *API, prefix string) *restful.Container {
 	ws.Route(ws.GET("/chunks/{hash}/{version}").To(api.checkChunk))
 	ws.Route(ws.GET("/chunks/{hash}/download").To(api.downloadChunk))
 	ws.Route(ws.GET("/chunks/{hash}/download/{version}").To(api.downloadChunk))
+	ws.Route(ws.GET("/chunks/{hash}/signed-url").Filter(api.Audit("sign-url")).To(api.signChunkURL))
 	// Save hashed file chunk
 	ws.Route(ws.POST("/chunks/{hash}").To(api.saveChunk))
 	ws.Route(ws.POST("/chunks/{hash}/{version}").To(api.saveChunk))
@@ -151,9 +241,19 @@ func NewApiContainer(api *API, prefix string) *restful.Container {
 	ws.Route(ws.GET("/websocket/messages").To(api.lastReceivedMessages))
 
 	// admin
-	ws.Route(ws.GET("/admin/gc").To(api.runGC))
-	ws.Route(ws.GET("/admin/clear-chunks").To(api.runClearChunks))
+	ws.Route(ws.GET("/admin/audit").Filter(api.AdminHook).To(api.listAudit))
+	ws.Route(ws.GET("/admin/config").Filter(api.AdminHook).To(api.getConfig))
+	ws.Route(ws.GET("/admin/users").Filter(api.AdminHook).To(api.listUsers))
+	ws.Route(ws.POST("/admin/users").Filter(api.Audit("create-user")).Filter(api.AdminHook).To(api.createUser))
+	ws.Route(ws.DELETE("/admin/users/{user}").Filter(api.Audit("delete-user")).Filter(api.AdminHook).To(api.deleteUser))
+	ws.Route(ws.GET("/admin/tokens").Filter(api.AdminHook).To(api.listTokens))
+	ws.Route(ws.POST("/admin/tokens").Filter(api.Audit("create-token")).Filter(api.AdminHook).To(api.createToken))
+	ws.Route(ws.DELETE("/admin/tokens/{id}").Filter(api.Audit("revoke-token")).Filter(api.AdminHook).To(api.deleteToken))
+	ws.Route(ws.GET("/admin/gc").Filter(api.Audit("gc")).Filter(api.AdminHook).To(api.runGC))
+	ws.Route(ws.GET("/admin/clear-chunks").Filter(api.Audit("clear-chunks")).Filter(api.AdminHook).To(api.runClearChunks))
+	ws.Route(ws.GET("/admin/jobs/{id}").Filter(api.AdminHook).To(api.getAnyJob))
 
+	ws.Filter(recordRoute)
 	ws.Filter(setCurrentType)
 
 	container.Add(ws)
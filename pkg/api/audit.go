@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+const defaultAuditLimit = 100
+
+// Audit records who called the route, on which entity and with which outcome.
+// It goes before other route filters so that calls denied by them, e.g. by
+// AdminHook, are recorded too. Requests rejected by AuthHook don't reach it.
+func (api *API) Audit(action string) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
+		filter.ProcessFilter(req, resp)
+
+		status := resp.StatusCode()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		name := req.PathParameter("name")
+		if name == "" {
+			name = req.PathParameter("dataset")
+		}
+		api.audit.Record(&db.AuditRecord{
+			Actor:      api.requestActor(req),
+			RemoteAddr: remoteAddr(req.Request),
+			Action:     action,
+			Method:     req.Request.Method,
+			Path:       req.Request.URL.Path,
+			Workspace:  req.PathParameter("workspace"),
+			EntityType: req.PathParameter("entityType"),
+			Name:       name,
+			Version:    req.PathParameter("version"),
+			Status:     status,
+		})
+	}
+}
+
+// remoteAddr returns the client address: the peer one or, if the peer is
+// a trusted proxy, the last address of X-Forwarded-For not added by a
+// trusted proxy.
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	proxies := utils.TrustedProxies()
+	if !trustedProxy(proxies, host) {
+		return host
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		host = addr
+		if !trustedProxy(proxies, addr) {
+			break
+		}
+	}
+	return host
+}
+
+func trustedProxy(proxies []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *API) listAudit(req *restful.Request, resp *restful.Response) {
+	filter := db.AuditFilter{
+		AuditRecord: db.AuditRecord{
+			Actor:      req.QueryParameter("actor"),
+			Action:     req.QueryParameter("action"),
+			Workspace:  req.QueryParameter("workspace"),
+			EntityType: req.QueryParameter("type"),
+			Name:       req.QueryParameter("name"),
+			Version:    req.QueryParameter("version"),
+			Outcome:    req.QueryParameter("outcome"),
+		},
+		Limit: defaultAuditLimit,
+	}
+	for param, t := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := req.QueryParameter(param)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			WriteStatusError(resp, http.StatusBadRequest, fmt.Errorf("Invalid %v: %v", param, err))
+			return
+		}
+		*t = &parsed
+	}
+	if raw := req.QueryParameter("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			WriteErrorString(resp, http.StatusBadRequest, "Invalid limit: must be a non-negative number")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	items, err := api.audit.List(filter)
+	if err != nil {
+		WriteStatusError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	resp.WriteEntity(types.AuditList{Items: items})
+}
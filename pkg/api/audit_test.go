@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/audit"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func listAudit(t *testing.T, query string) []types.AuditRecord {
+	resp, err := client.Get(buildURL("admin/audit?" + query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var list types.AuditList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+func TestAuditLog(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	sink := fname + ".audit.jsonl"
+	defer os.Remove(sink)
+	testAPI.audit = audit.NewLogger(testMgr, sink)
+
+	dbPrepare(t)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0")
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+
+	req, _ = http.NewRequest(http.MethodDelete, buildURL("dataset/workspace/dataset/versions/2.0.0"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	items := listAudit(t, "action=delete-version")
+	utils.Assert(2, len(items), t)
+	utils.Assert("2.0.0", items[0].Version, t)
+	utils.Assert(db.AuditFailure, items[0].Outcome, t)
+	utils.Assert(http.StatusNotFound, items[0].Status, t)
+
+	deleted := items[1]
+	utils.Assert(db.AuditSuccess, deleted.Outcome, t)
+	utils.Assert("workspace", deleted.Workspace, t)
+	utils.Assert("dataset", deleted.EntityType, t)
+	utils.Assert("dataset", deleted.Name, t)
+	utils.Assert("1.0.0", deleted.Version, t)
+	utils.Assert("[anonymous]", deleted.Actor, t)
+
+	utils.Assert(1, len(listAudit(t, "action=delete-version&outcome=success")), t)
+	utils.Assert(0, len(listAudit(t, "action=delete-version&since=2100-01-01T00:00:00Z")), t)
+	// Reads are not audited.
+	all := listAudit(t, "")
+	for _, r := range all {
+		if r.Method == http.MethodGet {
+			t.Fatalf("Read %v is audited", r.Path)
+		}
+	}
+
+	f, err := os.Open(sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record types.AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	utils.Assert(len(all), lines, t)
+}
+
+func TestRequestActor(t *testing.T) {
+	dealer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login": "alice"}`))
+	}))
+	defer dealer.Close()
+	testAPI.settings.AuthURL = dealer.URL + "/api/v0.2/me"
+	defer func() { testAPI.settings.AuthURL = "" }()
+
+	actor := func(headers map[string]string) string {
+		r, _ := http.NewRequest(http.MethodPost, buildURL("dataset/workspace/dataset"), nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return testAPI.requestActor(restful.NewRequest(r))
+	}
+	utils.Assert("[user=alice]", actor(map[string]string{"Authorization": "Bearer token"}), t)
+	utils.Assert("[workspace=workspace]", actor(map[string]string{
+		"X-Workspace-Name":   "workspace",
+		"X-Workspace-Secret": "secret",
+	}), t)
+	// The user is unknown.
+	utils.Assert(true, strings.HasPrefix(actor(map[string]string{"Authorization": "Bearer other"}), "[token="), t)
+	utils.Assert("[anonymous]", actor(nil), t)
+}
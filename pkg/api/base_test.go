@@ -9,13 +9,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/gc"
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -24,10 +27,14 @@ var (
 
 	// client is needed to make request to the server.
 	client *http.Client
+
+	// testMgr and testAPI are the database and the API of the server.
+	testMgr *db.DatabaseMgr
+	testAPI *API
 )
 
 func runGC() {
-	go gc.Start()
+	go testAPI.gc.Run()
 }
 
 func getFname() string {
@@ -39,11 +46,14 @@ func getFname() string {
 func setup(fname string) {
 	// test server
 	//os.Setenv("DEBUG", "true")
-	db.DbMgr = db.NewFakeDatabaseMgr(fname)
+	testMgr = db.NewFakeDatabaseMgr(fname)
 	logrus.SetLevel(logrus.DebugLevel)
-	server = httptest.NewServer(GlobalHandler(Build()))
+	settings := utils.SettingsFromEnv()
+	settings.ChunkDir = "/tmp/tmp_pluk"
+	store := plukio.NewStore(settings, nil)
+	testAPI = New(testMgr, store, gc.New(testMgr, store))
+	server = httptest.NewServer(GlobalHandler(testAPI))
 	client = &http.Client{Timeout: time.Second * 10}
-	os.Setenv("DATA_DIR", "/tmp/tmp_pluk")
 	runGC()
 }
 
@@ -57,17 +67,60 @@ func teardown(fname string) {
 		"dataset_versions",
 		"datasets",
 		"file_chunks",
+		"version_manifests",
+		"retention_policies",
+		"jobs",
+		"workspace_quotas",
+		"audit_records",
+		"users",
+		"tokens",
+		"entity_acls",
 	}
 
 	for _, t := range allTables {
-		db.DbMgr.DB().Exec(fmt.Sprintf("DELETE FROM %v", t))
+		testMgr.DB().Exec(fmt.Sprintf("DELETE FROM %v", t))
 	}
 
-	db.DbMgr.Close()
+	testMgr.Close()
 	os.RemoveAll("/tmp/tmp_pluk")
 	os.Remove(fname)
 }
 
+// startMaster starts another server with its own database and data dir.
+// Tests make testAPI its slave by setting MasterURLs.
+func startMaster(t *testing.T) (*httptest.Server, func()) {
+	return startInstance(t, nil)
+}
+
+// startSlave starts a slave of the master, it authenticates to the master
+// with the test internal key.
+func startSlave(t *testing.T, master string) (*httptest.Server, func()) {
+	return startInstance(t, []string{master})
+}
+
+func startInstance(t *testing.T, masters []string) (*httptest.Server, func()) {
+	fname := getFname()
+	mgr := db.NewFakeDatabaseMgr(fname)
+	settings := utils.SettingsFromEnv()
+	settings.ChunkDir = fname + "-data"
+	settings.MasterURLs = masters
+	var master plukio.PlukClient
+	if len(masters) > 0 {
+		settings.SetAuth("", []string{testInternalKey})
+		master = plukclient.NewInternalMasterClient(settings)
+	}
+	store := plukio.NewStore(settings, master)
+	instance := New(mgr, store, gc.New(mgr, store))
+	srv := httptest.NewServer(GlobalHandler(instance))
+	return srv, func() {
+		srv.Close()
+		instance.Close()
+		mgr.Close()
+		os.RemoveAll(settings.ChunkDir)
+		os.Remove(fname)
+	}
+}
+
 func buildURL(urlStr string) string {
 	strings.TrimPrefix(urlStr, "/")
 	return fmt.Sprintf("%v%v/%v", server.URL, utils.ApiPrefix, urlStr)
@@ -1,14 +1,16 @@
 package api
 
 import (
-	"github.com/kuberlab/pluk/pkg/types"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
-	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/auth"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
 )
 
 func (api *API) chunkVersion(req *restful.Request) byte {
@@ -30,7 +32,7 @@ func (api *API) chunkVersion(req *restful.Request) byte {
 func (api *API) checkChunk(req *restful.Request, resp *restful.Response) {
 	hash := req.PathParameter("hash")
 
-	chunkCheck, err := plukio.CheckChunk(hash, api.chunkVersion(req))
+	chunkCheck, err := api.store.CheckChunk(hash, api.chunkVersion(req))
 	if err != nil {
 		WriteError(resp, err)
 		return
@@ -40,7 +42,13 @@ func (api *API) checkChunk(req *restful.Request, resp *restful.Response) {
 
 func (api *API) downloadChunk(req *restful.Request, resp *restful.Response) {
 	hash := req.PathParameter("hash")
-	file, err := plukio.GetChunkByHash(hash, api.chunkVersion(req))
+	if size, exists := api.store.CheckLocalChunk(hash, api.chunkVersion(req)); exists {
+		if err := checkSignedSize(req, size); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+	file, err := api.store.GetChunkByHash(hash, api.chunkVersion(req))
 	if err != nil {
 		WriteStatusError(resp, http.StatusNotFound, err)
 		return
@@ -56,13 +64,73 @@ func (api *API) downloadChunk(req *restful.Request, resp *restful.Response) {
 
 func (api *API) saveChunk(req *restful.Request, resp *restful.Response) {
 	hash := req.PathParameter("hash")
+	version := api.chunkVersion(req)
 
-	written, err := plukio.SaveChunk(hash, api.chunkVersion(req), req.Request.Body, true)
+	// Chunks are not bound to a workspace, so they are accounted to the
+	// workspace of the client until the file structure is saved. Already
+	// stored chunks take no extra space.
+	workspace := ""
+	_, exists := api.store.CheckLocalChunk(hash, version)
+	if !exists {
+		var err error
+		if workspace, err = api.uploadWorkspace(req); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		if err = api.ds.CheckQuota(workspace, req.Request.ContentLength); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		if err = api.store.CheckDiskSpace(req.Request.ContentLength); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	written, err := api.store.SaveChunk(hash, version, req.Request.Body, true)
 	if err != nil {
-		WriteStatusError(resp, http.StatusInternalServerError, err)
+		WriteError(resp, err)
 		return
 	}
+	if !exists {
+		api.ds.AddUpload(workspace, written)
+	}
 
 	chunkCheck := &types.ChunkCheck{Size: written, Hash: hash}
 	_ = resp.WriteHeaderAndEntity(http.StatusCreated, chunkCheck)
 }
+
+// uploadWorkspace returns the workspace the uploaded chunk is accounted to:
+// the X-Workspace-Name header the client may write to, or the only
+// workspace of its identity. It is required while quotas are enforced.
+// Chunks pushed by slaves are accounted when the file structure is saved.
+func (api *API) uploadWorkspace(req *restful.Request) (string, error) {
+	if req.Attribute("internal") == "true" {
+		return "", nil
+	}
+	workspace := req.HeaderParameter("X-Workspace-Name")
+	if id, ok := req.Attribute("identity").(*auth.Identity); ok && id != nil {
+		if workspace == "" {
+			workspace = id.WriteWorkspace()
+		} else if !id.Can(workspace, true) {
+			return "", errors.NewStatus(
+				http.StatusForbidden,
+				fmt.Sprintf("Access to workspace %v denied.", workspace),
+			)
+		}
+	}
+	if workspace != "" {
+		return workspace, nil
+	}
+	enabled, err := api.ds.QuotasEnabled()
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", errors.NewStatus(
+			http.StatusBadRequest,
+			"Set X-Workspace-Name header to the workspace the chunk is uploaded to.",
+		)
+	}
+	return "", nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestConfigFile(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	dir, err := ioutil.TempDir("", "pluk-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "pluk.yaml")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv(utils.ConfigFileVar, file)
+	defer func() {
+		os.Unsetenv(utils.ConfigFileVar)
+		utils.LoadConfig()
+	}()
+
+	write(`
+auth:
+  mode: local
+  internal_keys: [` + testInternalKey + `, old-key]
+db:
+  password: secret
+gc:
+  interval: 30m
+  trash_retention: 48h
+concurrency:
+  upload: 2
+`)
+	if err = utils.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(30*time.Minute, utils.GCInterval(), t)
+	utils.Assert(48*time.Hour, utils.TrashRetention(), t)
+	utils.Assert(true, utils.IsInternalKey("old-key"), t)
+
+	// Environment overrides the file.
+	os.Setenv("TRASH_RETENTION", "24h")
+	utils.Assert(24*time.Hour, utils.TrashRetention(), t)
+	os.Unsetenv("TRASH_RETENTION")
+
+	setLocalAuth()
+	resp := authRequest(t, http.MethodGet, "admin/config", "", "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	body := mustRead(resp.Body)
+	utils.Assert(false, strings.Contains(body, "secret"), t)
+	utils.Assert(false, strings.Contains(body, testInternalKey), t)
+	var conf map[string]interface{}
+	if err = json.Unmarshal([]byte(body), &conf); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("30m0s", conf["gc"].(map[string]interface{})["interval"], t)
+	// Settings of this server, not of the environment.
+	utils.Assert("/tmp/tmp_pluk", conf["data_dir"], t)
+	utils.Assert("local", conf["auth"].(map[string]interface{})["mode"], t)
+	utils.Assert(1, len(conf["auth"].(map[string]interface{})["internal_keys"].([]interface{})), t)
+	utils.Assert(server.URL, fmt.Sprintf("http://127.0.0.1:%v", conf["http_port"]), t)
+	utils.Assert("<redacted>", conf["db"].(map[string]interface{})["password"], t)
+	resp = authRequest(t, http.MethodGet, "admin/config", "bad-token", "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	// All invalid settings are reported and the current config is kept.
+	write("http_port: 70000\nmasters: [ftp://master]\nconcurrency:\n  upload: -1\n")
+	err = utils.ReloadConfig()
+	utils.Assert(true, err != nil, t)
+	utils.Assert(true, strings.Contains(err.Error(), "http_port"), t)
+	utils.Assert(true, strings.Contains(err.Error(), "masters"), t)
+	utils.Assert(true, strings.Contains(err.Error(), "concurrency.upload"), t)
+	utils.Assert(48*time.Hour, utils.TrashRetention(), t)
+	write("unknown: 1\n")
+	utils.Assert(true, utils.ReloadConfig() != nil, t)
+
+	// Only settings safe to change are reloaded.
+	write(`
+db:
+  user: other
+auth:
+  mode: local
+  internal_keys: [` + testInternalKey + `]
+gc:
+  trash_retention: 72h
+`)
+	if err = utils.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(72*time.Hour, utils.TrashRetention(), t)
+	utils.Assert(false, utils.IsInternalKey("old-key"), t)
+	utils.Assert("", utils.DBUser(), t)
+	utils.Assert(int64(2), utils.UploadConcurrency(), t)
+}
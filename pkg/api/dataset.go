@@ -1,22 +1,24 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/dealerclient"
 	"github.com/kuberlab/lib/pkg/errors"
 	"github.com/kuberlab/pluk/pkg/datasets"
-	"github.com/kuberlab/pluk/pkg/gc"
+	"github.com/kuberlab/pluk/pkg/db"
 	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/jobs"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/types"
-	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func (api *API) masterClient(req *restful.Request) plukio.PlukClient {
@@ -38,6 +40,9 @@ func (api *API) allDatasets(req *restful.Request, resp *restful.Response) {
 	}
 	ds := types.DataSetList{}
 	for _, d := range sets {
+		if !api.readable(req, d.Type, d.Workspace, d.Name) {
+			continue
+		}
 		ds.Items = append(ds.Items, types.Dataset{Name: d.Name, Workspace: d.Workspace})
 	}
 	if len(ds.Items) == 0 {
@@ -57,6 +62,9 @@ func (api *API) datasets(req *restful.Request, resp *restful.Response) {
 	}
 	ds := types.DataSetList{}
 	for _, d := range sets {
+		if !api.readable(req, d.Type, d.Workspace, d.Name) {
+			continue
+		}
 		ds.Items = append(
 			ds.Items,
 			types.Dataset{Name: d.Name, Workspace: d.Workspace, DType: d.Type},
@@ -99,6 +107,10 @@ func (api *API) downloadDataset(req *restful.Request, resp *restful.Response) {
 		WriteStatusError(resp, http.StatusInternalServerError, err)
 		return
 	}
+	if err = checkSignedSize(req, sz); err != nil {
+		WriteError(resp, err)
+		return
+	}
 
 	resp.Header().Add("Content-Type", "application/tar")
 	resp.Header().Add("Content-Length", fmt.Sprintf("%v", sz))
@@ -166,18 +178,18 @@ func (api *API) deleteDataset(req *restful.Request, resp *restful.Response) {
 		master = api.masterClient(req)
 	}
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 	ds, _ := api.ds.GetDataset(currentType(req), workspace, name, master)
 
 	api.invalidateCache(ds)
-	err := api.ds.DeleteDataset(currentType(req), workspace, name, master, true)
+	err := api.ds.DeleteDataset(currentType(req), workspace, name, master, getBoolQueryParam(req, "force"))
 	if err != nil {
 		WriteError(resp, err)
 		return
 	}
 
-	if utils.AuthValidationURL() != "" && !skipDealer {
+	if api.settings.AuthValidationURL() != "" && !skipDealer {
 		// The below causes kind of "recursive" deleting
 		err = api.deleteDatasetOnDealer(req, workspace, name)
 		if err != nil {
@@ -201,9 +213,9 @@ func (api *API) createDataset(req *restful.Request, resp *restful.Response) {
 	}
 
 	// Wait
-	acquireConcurrency()
-	defer releaseConcurrency()
-	//gc.WaitGCCompleted()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+	//api.gc.Wait()
 
 	if ds, err := api.ds.NewDataset(currentType(req), workspace, name, master); err != nil {
 		WriteError(resp, err)
@@ -233,34 +245,102 @@ func (api *API) forkDataset(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
+	// Forking requires write access to the target as well.
+	if _, err := api.checkEntityAccessFor(req, targetType, targetWS, targetName, true); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
 	master := api.masterClient(req)
+	src := types.Dataset{Workspace: workspace, Name: name, DType: currentType(req)}
+	target := types.Dataset{Workspace: targetWS, Name: targetName, DType: targetType}
 
-	checkTarget, _ := api.ds.GetDataset(targetType, targetWS, targetName, master)
-	if checkTarget != nil && force {
-		// Clean old dataset
-		err := api.ds.DeleteDataset(targetType, targetWS, targetName, master, true)
-		if err != nil {
+	record := &db.Job{
+		Type:       jobs.TypeFork,
+		Workspace:  workspace,
+		Name:       name,
+		EntityType: currentType(req),
+		Target:     fmt.Sprintf("%v %v/%v", targetType, targetWS, targetName),
+	}
+	fork := func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		checkTarget, _ := api.ds.GetDataset(targetType, targetWS, targetName, master)
+		if checkTarget != nil && force {
+			// Clean old dataset
+			err := api.ds.DeleteDataset(targetType, targetWS, targetName, master, true)
+			if err != nil {
+				return nil, err
+			}
+			api.invalidateCache(checkTarget)
+			time.Sleep(time.Millisecond * 30)
+			api.gc.Wait()
+		}
+
+		api.acquireConcurrency()
+		defer api.releaseConcurrency()
+
+		return api.ds.ForkDataset(src, target, master, func(done, total int64) error {
+			job.SetProgress(done, total)
+			return ctx.Err()
+		})
+	}
+	api.submitJob(resp, record, true, getBoolQueryParam(req, "async"), http.StatusCreated, fork)
+}
+
+// renameDataset moves the entity to another workspace and/or name.
+func (api *API) renameDataset(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	targetWS := req.PathParameter("targetWorkspace")
+	targetName := req.PathParameter("targetName")
+	if targetWS == "" {
+		targetWS = workspace
+	}
+	if targetName == "" {
+		targetName = req.QueryParameter("name")
+	}
+	if targetName == "" {
+		targetName = name
+	}
+	skipDealer := getBoolQueryParam(req, "skip_dealer")
+	master := api.masterClient(req)
+
+	if targetWS != workspace || targetName != name {
+		// Moving requires write access to the target as well.
+		if _, err := api.checkEntityAccessFor(req, currentType(req), targetWS, targetName, true); err != nil {
 			WriteError(resp, err)
 			return
 		}
-		api.invalidateCache(checkTarget)
-		time.Sleep(time.Millisecond * 30)
-		gc.WaitGCCompleted()
 	}
 
-	acquireConcurrency()
-	defer releaseConcurrency()
-
-	src := types.Dataset{Workspace: workspace, Name: name, DType: currentType(req)}
-	target := types.Dataset{Workspace: targetWS, Name: targetName, DType: targetType}
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
-	dataset, err := api.ds.ForkDataset(src, target, master)
+	ds, _ := api.ds.GetDataset(currentType(req), workspace, name, master)
+	api.invalidateCache(ds)
+	err := api.ds.RenameDataset(currentType(req), workspace, name, targetWS, targetName, master)
 	if err != nil {
 		WriteError(resp, err)
 		return
 	}
 
-	resp.WriteHeaderAndEntity(http.StatusCreated, dataset)
+	if api.settings.AuthValidationURL() != "" && !skipDealer {
+		if err = api.createDatasetOnDealer(req, targetWS, targetName, false); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		if err = api.deleteDatasetOnDealer(req, workspace, name); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	dataset, err := api.ds.GetDataset(currentType(req), targetWS, targetName, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, targetName, err))
+		return
+	}
+	api.invalidateCache(dataset)
+	resp.WriteEntity(dataset)
 }
 
 func (api *API) fsCacheKey(dataset *datasets.Dataset, version, filter string) string {
@@ -274,6 +354,7 @@ func (api *API) fsCacheKeyPrefix(ds *datasets.Dataset) string {
 func (api *API) getFS(dataset *datasets.Dataset, version, filter string) (fs *plukio.ChunkedFileFS, err error) {
 	fsRaw := api.fsCache.GetRaw(api.fsCacheKey(dataset, version, filter))
 	if fsRaw == nil {
+		metrics.FSCache.WithLabelValues("miss").Inc()
 		logrus.Infof("Caching FS %v:%v...", dataset.Name, version)
 		fs, err = dataset.GetFSStructure(version, filter)
 		if err != nil {
@@ -282,6 +363,7 @@ func (api *API) getFS(dataset *datasets.Dataset, version, filter string) (fs *pl
 		api.fsCache.SetRaw(api.fsCacheKey(dataset, version, filter), fs)
 		logrus.Infof("Successfully cached FS %v:%v.", dataset.Name, version)
 	} else {
+		metrics.FSCache.WithLabelValues("hit").Inc()
 		fs = fsRaw.(*plukio.ChunkedFileFS)
 	}
 
@@ -328,11 +410,11 @@ func (api *API) invalidateVersionCache(ds *datasets.Dataset, version string) {
 }
 
 func (api *API) dealerClient(req *restful.Request) (*dealerclient.Client, error) {
-	return dealerclient.NewClient(utils.AuthValidationURL(), &dealerclient.AuthOpts{Headers: req.Request.Header})
+	return dealerclient.NewClient(api.settings.AuthValidationURL(), &dealerclient.AuthOpts{Headers: req.Request.Header})
 }
 
 func (api *API) reportNewVersion(req *restful.Request, version dealerclient.NewVersion) {
-	if utils.AuthValidationURL() == "" {
+	if api.settings.AuthValidationURL() == "" {
 		return
 	}
 
@@ -348,7 +430,7 @@ func (api *API) reportNewVersion(req *restful.Request, version dealerclient.NewV
 }
 
 func (api *API) createDatasetOnDealer(req *restful.Request, ws, name string, public bool) error {
-	if utils.AuthValidationURL() == "" {
+	if api.settings.AuthValidationURL() == "" {
 		return nil
 	}
 
@@ -385,7 +385,7 @@ func TestForkDatasetForce(t *testing.T) {
 	dbPrepare(t)
 	defer teardown(fname)
 
-	_ = db.DbMgr.CreateDataset(&db.Dataset{
+	_ = testMgr.CreateDataset(&db.Dataset{
 		Name:      "dataset",
 		Workspace: "another-ws",
 		Type:      "dataset",
@@ -560,7 +560,7 @@ func TestUploadCorrectChunk(t *testing.T) {
 
 func dbPrepare(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
-	if err := db.DbMgr.CreateDataset(
+	if err := testMgr.CreateDataset(
 		&db.Dataset{
 			Workspace: "workspace",
 			Name:      "dataset",
@@ -569,7 +569,7 @@ func dbPrepare(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := db.DbMgr.CreateDatasetVersion(
+	if err := testMgr.CreateDatasetVersion(
 		&db.DatasetVersion{
 			Workspace: "workspace",
 			Name:      "dataset",
@@ -580,3 +580,100 @@ func dbPrepare(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRenameDataset(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file1.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/commit")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/rename/renamed")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/renamed/versions/1.0.0/raw/file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	url = buildURL("dataset/workspace/renamed/move/another-ws?name=moved")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/another-ws/moved/versions/1.0.0/raw/file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/renamed/versions/1.0.0/raw/file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	// Target must not exist.
+	resp, err = client.Post(buildURL("dataset/another-ws/other"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp, err = client.Post(buildURL("dataset/another-ws/moved/rename/other"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+}
+
+func TestSlaveRenameMasterFails(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	// The master doesn't have the dataset, so the rename fails there
+	// and the local copy keeps its name.
+	master, closeMaster := startMaster(t)
+	defer closeMaster()
+	testAPI.settings.MasterURLs = []string{master.URL}
+
+	resp, err := client.Post(buildURL("dataset/workspace/dataset/rename/renamed"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+	_, err = testMgr.GetDataset("dataset", "workspace", "dataset")
+	utils.Assert(nil, err, t)
+	_, err = testMgr.GetDataset("dataset", "workspace", "renamed")
+	utils.Assert(true, err != nil, t)
+}
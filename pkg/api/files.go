@@ -13,13 +13,12 @@ import (
 	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/errors"
 	"github.com/kuberlab/pluk/pkg/datasets"
-	plukio "github.com/kuberlab/pluk/pkg/io"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func (api *API) fsReadDir(req *restful.Request, resp *restful.Response) {
@@ -73,6 +72,10 @@ func (api *API) fsReadFile(req *restful.Request, resp *restful.Response) {
 		WriteErrorString(resp, http.StatusNotFound, fmt.Sprintf("No such file: %v", filepath))
 		return
 	}
+	if err = checkSignedSize(req, file.Size); err != nil {
+		WriteError(resp, err)
+		return
+	}
 	file = file.Clone()
 
 	resp.Header().Add("Content-Length", fmt.Sprintf("%v", file.Size))
@@ -117,10 +120,7 @@ func (api *API) findDatasetVersion(ds *datasets.Dataset, version string, allowEd
 	}
 
 	if !vs.Editing && !allowEditing {
-		return nil, errors.NewStatus(
-			http.StatusForbidden,
-			fmt.Sprintf("%v already committed", ds.Type),
-		)
+		return nil, datasets.CommittedError(ds.Type, ds.Workspace, ds.Name, version)
 	}
 	return &vs, nil
 }
@@ -160,8 +160,8 @@ func (api *API) deleteDatasetFile(req *restful.Request, resp *restful.Response)
 	//	return
 	//}
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
 	tx := api.mgr.Begin()
 	defer func() {
@@ -171,7 +171,7 @@ func (api *API) deleteDatasetFile(req *restful.Request, resp *restful.Response)
 			tx.Commit()
 		}
 	}()
-	if err = datasets.DeleteFiles(tx, currentType(req), workspace, name, version, filepath, false, true); err != nil {
+	if err = datasets.DeleteFiles(tx, api.store, currentType(req), workspace, name, version, filepath, false, true); err != nil {
 		WriteError(resp, err)
 		return
 	}
@@ -193,8 +193,8 @@ func (api *API) uploadDatasetFile(req *restful.Request, resp *restful.Response)
 	filepath := req.PathParameter("path")
 	master := api.masterClient(req)
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
 	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
 	if err != nil {
@@ -213,7 +213,38 @@ func (api *API) uploadDatasetFile(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	f, err := api.readAndSaveFile(req, resp)
+	// The file is overwritten, so only the difference counts against the quota.
+	// Content length is unknown for chunked requests, so the quota is checked
+	// again with the actual size once the file is read.
+	var previous int64 = 0
+	if existing, err := api.mgr.GetFile(workspace, name, currentType(req), filepath, version); err == nil {
+		previous = existing.Size
+	}
+	if req.Request.ContentLength > 0 {
+		if err = api.ds.CheckQuota(workspace, req.Request.ContentLength-previous); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		if err = api.store.CheckDiskSpace(req.Request.ContentLength); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	// Chunks are checked against the quota before they are written.
+	left, err := api.ds.QuotaLeft(workspace)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	checkQuota := func(size int64) error {
+		if left < 0 || size-previous <= left {
+			return nil
+		}
+		return api.ds.CheckQuota(workspace, size-previous)
+	}
+
+	f, err := api.readAndSaveFile(req, checkQuota)
 	if err != nil {
 		WriteError(resp, err)
 		return
@@ -222,6 +253,10 @@ func (api *API) uploadDatasetFile(req *restful.Request, resp *restful.Response)
 
 	api.lockForSave(workspace, name, version)
 	defer api.unlockForSave(workspace, name, version)
+	if err = api.ds.CheckQuota(workspace, f.Size-previous); err != nil {
+		WriteError(resp, err)
+		return
+	}
 	if err := dataset.Save(fs, version, "", false, false, true, true); err != nil {
 		WriteError(resp, err)
 		return
@@ -252,7 +287,7 @@ func (api *API) unlockForSave(ws, ds, version string) {
 	}
 }
 
-func (api *API) readAndSaveFile(req *restful.Request, resp *restful.Response) (f *types.HashedFile, err error) {
+func (api *API) readAndSaveFile(req *restful.Request, checkQuota func(size int64) error) (f *types.HashedFile, err error) {
 	workspace := req.PathParameter("workspace")
 	name := req.PathParameter("name")
 	version := req.PathParameter("version")
@@ -278,7 +313,7 @@ func (api *API) readAndSaveFile(req *restful.Request, resp *restful.Response) (f
 		// File exists, need overwrite
 		// Delete related chunks
 		err = datasets.DeleteFiles(
-			tx, currentType(req), workspace, name, version, filepath, true, false,
+			tx, api.store, currentType(req), workspace, name, version, filepath, true, false,
 		)
 		if err != nil {
 			return nil, err
@@ -297,15 +332,15 @@ func (api *API) readAndSaveFile(req *restful.Request, resp *restful.Response) (f
 		read, errRead := reader.Read(buf)
 		if errRead != nil {
 			if errRead != io.EOF {
-				return nil, err
+				return nil, errRead
 			}
 		}
 		total += int64(read)
 
 		// Calc hash
-		hash := utils.CalcHash(buf)
+		hash := utils.CalcHash(buf[:read])
 		// Check and save
-		check, err = plukio.CheckChunk(hash, types.ChunkVersion)
+		check, err = api.store.CheckChunk(hash, types.ChunkVersion)
 		if err != nil {
 			return nil, err
 		}
@@ -320,7 +355,10 @@ func (api *API) readAndSaveFile(req *restful.Request, resp *restful.Response) (f
 			continue
 		}
 
-		if _, err = plukio.SaveChunk(hash, types.ChunkVersion, ioutil.NopCloser(bytes.NewBuffer(buf[:read])), true); err != nil {
+		if err = checkQuota(total); err != nil {
+			return nil, err
+		}
+		if _, err = api.store.SaveChunk(hash, types.ChunkVersion, ioutil.NopCloser(bytes.NewBuffer(buf[:read])), true); err != nil {
 			return nil, err
 		}
 
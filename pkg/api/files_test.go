@@ -697,7 +697,7 @@ func TestCommitNoMoreUpload(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
 }
 
 func TestCommitNoDelete(t *testing.T) {
@@ -730,7 +730,7 @@ func TestCommitNoDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
 }
 
 func TestFilter(t *testing.T) {
@@ -6,12 +6,13 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/dealerclient"
+	"github.com/kuberlab/pluk/pkg/datasets"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func (api *API) getDatasetFS(req *restful.Request, resp *restful.Response) {
@@ -116,16 +117,20 @@ func (api *API) saveFS(req *restful.Request, resp *restful.Response) {
 	}
 
 	// Wait
-	//gc.WaitGCCompleted()
+	//api.gc.Wait()
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
 	dataset, err := api.ds.NewDataset(currentType(req), workspace, name, master)
 	if err != nil {
 		WriteError(resp, err)
 		return
 	}
+	if err = api.ds.CheckSaveQuota(dataset, *structure, version); err != nil {
+		WriteError(resp, err)
+		return
+	}
 	logrus.Infof("Saving %v for %v/%v:%v...", dataset.Type, workspace, name, version)
 
 	err = dataset.Save(*structure, version, comment, create, publish, editing, true)
@@ -133,16 +138,26 @@ func (api *API) saveFS(req *restful.Request, resp *restful.Response) {
 		WriteStatusError(resp, http.StatusInternalServerError, err)
 		return
 	}
+	api.ds.SavedUploads(workspace, datasets.StructureSize(*structure))
 
+	result, err := api.finishSave(req, dataset, version, comment, create, publish, editing)
+	if err != nil {
+		WriteStatusError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, result)
+}
+
+// finishSave commits the saved version unless it stays editing
+// and registers it on the dealer.
+func (api *API) finishSave(req *restful.Request, dataset *datasets.Dataset,
+	version, comment string, create, publish, editing bool) (interface{}, error) {
+	workspace := dataset.Workspace
+	name := dataset.Name
 	if !editing {
 		dsv, err := dataset.CommitVersion(version, comment)
 		if err != nil {
-			WriteStatusError(
-				resp,
-				http.StatusInternalServerError,
-				fmt.Errorf("Failed to commit version %v: %v", version, err.Error()),
-			)
-			return
+			return nil, fmt.Errorf("Failed to commit version %v: %v", version, err.Error())
 		}
 		logrus.Infof("Done saving %v/%v:%v.", workspace, name, version)
 
@@ -151,14 +166,12 @@ func (api *API) saveFS(req *restful.Request, resp *restful.Response) {
 
 		if create {
 			if err = api.createDatasetOnDealer(req, workspace, name, publish); err != nil {
-				WriteStatusError(resp, http.StatusInternalServerError, err)
-				return
+				return nil, err
 			}
 		}
 		vers, err := dataset.Versions()
 		if err != nil {
-			WriteError(resp, err)
-			return
+			return nil, err
 		}
 		api.reportNewVersion(
 			req,
@@ -170,18 +183,14 @@ func (api *API) saveFS(req *restful.Request, resp *restful.Response) {
 				Latest:    len(vers) > 0 && vers[0].Version == version,
 			},
 		)
-		resp.WriteHeaderAndEntity(http.StatusCreated, dsv)
-		return
+		return dsv, nil
 	}
 
-	resp.WriteHeaderAndEntity(
-		http.StatusCreated,
-		&db.DatasetVersion{
-			Version:   version,
-			Name:      name,
-			Type:      currentType(req),
-			Workspace: workspace,
-			Editing:   true,
-		},
-	)
+	return &db.DatasetVersion{
+		Version:   version,
+		Name:      name,
+		Type:      currentType(req),
+		Workspace: workspace,
+		Editing:   true,
+	}, nil
 }
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+const (
+	healthOk   = "ok"
+	healthFail = "fail"
+)
+
+var healthClient = &http.Client{Timeout: time.Second * 5, Transport: clientTransport()}
+
+// SetGrpcState records the result of starting gRPC listener at the address.
+func (api *API) SetGrpcState(addr string, err error) {
+	api.grpcState.Lock()
+	defer api.grpcState.Unlock()
+	api.grpcState.addr = addr
+	api.grpcState.err = err
+}
+
+// healthz reports whether this instance itself is functional:
+// database, data directory and gRPC listener. Low disk space doesn't make
+// it fail, restarting won't free the space.
+func (api *API) healthz(resp http.ResponseWriter, req *http.Request) {
+	setRoute(resp, "/healthz")
+	writeHealth(resp, api.localChecks())
+}
+
+// readyz additionally requires free disk space and slaves to be connected
+// to master and to reach all masters, which file structures are saved to.
+func (api *API) readyz(resp http.ResponseWriter, req *http.Request) {
+	setRoute(resp, "/readyz")
+	checks := append(api.localChecks(), api.checkDiskSpace())
+	if api.settings.HasMasters() {
+		checks = append(checks, api.checkWatcher())
+		for _, master := range api.settings.Masters() {
+			checks = append(checks, checkMaster(master))
+		}
+	}
+	writeHealth(resp, checks)
+}
+
+func (api *API) localChecks() []types.HealthCheck {
+	checks := []types.HealthCheck{api.checkDB(), api.checkDataDir(), api.checkGrpc()}
+	if api.jwtKeys != nil {
+		checks = append(checks, api.checkJWTKeys())
+	}
+	return checks
+}
+
+func (api *API) checkJWTKeys() types.HealthCheck {
+	keys, err := api.jwtKeys.Keys()
+	return healthCheck("jwt_keys", err, fmt.Sprintf("%v keys", len(keys)))
+}
+
+func writeHealth(resp http.ResponseWriter, checks []types.HealthCheck) {
+	health := types.Health{Status: healthOk, Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if c.Status != healthOk {
+			health.Status = healthFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	json.NewEncoder(resp).Encode(health)
+}
+
+func healthCheck(name string, err error, message string) types.HealthCheck {
+	if err != nil {
+		return types.HealthCheck{Name: name, Status: healthFail, Message: err.Error()}
+	}
+	return types.HealthCheck{Name: name, Status: healthOk, Message: message}
+}
+
+func (api *API) checkDB() types.HealthCheck {
+	err := api.mgr.DB().DB().Ping()
+	return healthCheck("db", err, api.mgr.DBType())
+}
+
+func (api *API) checkDataDir() types.HealthCheck {
+	dir := api.settings.DataDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return healthCheck("data_dir", err, "")
+	}
+	f, err := ioutil.TempFile(dir, ".healthz")
+	if err != nil {
+		return healthCheck("data_dir", fmt.Errorf("%v is not writable: %v", dir, err), "")
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return healthCheck("data_dir", nil, fmt.Sprintf("%v is writable", dir))
+}
+
+func (api *API) checkDiskSpace() types.HealthCheck {
+	dir := api.settings.DataDir()
+	free, inodes, err := plukio.DiskFree(dir)
+	if err != nil {
+		return healthCheck("disk_space", err, "")
+	}
+	err = api.store.CheckDiskSpace(0)
+	return healthCheck("disk_space", err, fmt.Sprintf("%v has %v bytes and %v inodes free", dir, free, inodes))
+}
+
+func (api *API) checkGrpc() types.HealthCheck {
+	api.grpcState.RLock()
+	defer api.grpcState.RUnlock()
+	if api.grpcState.err != nil {
+		return healthCheck("grpc", api.grpcState.err, "")
+	}
+	if api.grpcState.addr == "" {
+		return healthCheck("grpc", fmt.Errorf("gRPC server is not listening"), "")
+	}
+	return healthCheck("grpc", nil, fmt.Sprintf("listening at %v", api.grpcState.addr))
+}
+
+func (api *API) checkWatcher() types.HealthCheck {
+	if api.watcher == nil {
+		return healthCheck("watcher", fmt.Errorf("Watcher is not started"), "")
+	}
+	if mode, attempt := api.watcher.status(); mode != receive {
+		return healthCheck(
+			"watcher",
+			fmt.Errorf("Disconnected from %v, reconnect attempt %v", api.watcher.master, attempt),
+			"",
+		)
+	}
+	return healthCheck("watcher", nil, fmt.Sprintf("connected to %v", api.watcher.master))
+}
+
+func checkMaster(master string) types.HealthCheck {
+	u, err := url.Parse(master)
+	if err != nil {
+		return healthCheck("master", err, "")
+	}
+	u.Path = "/probe"
+	u.RawQuery = ""
+	r, err := healthClient.Get(u.String())
+	if err != nil {
+		return healthCheck("master", err, "")
+	}
+	r.Body.Close()
+	if r.StatusCode >= 400 {
+		err = fmt.Errorf("%v responded with %v", u, r.Status)
+	}
+	return healthCheck("master", err, fmt.Sprintf("%v is reachable", master))
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func getHealth(t *testing.T, path string, status int) types.Health {
+	resp, err := client.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(status, resp.StatusCode, t)
+	var health types.Health
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	return health
+}
+
+func healthStatuses(health types.Health) map[string]string {
+	statuses := make(map[string]string)
+	for _, c := range health.Checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestHealth(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	testAPI.SetGrpcState(":9100", nil)
+	health := getHealth(t, "/healthz", http.StatusOK)
+	utils.Assert(healthOk, health.Status, t)
+	utils.Assert(
+		map[string]string{"db": healthOk, "data_dir": healthOk, "grpc": healthOk},
+		healthStatuses(health),
+		t,
+	)
+	health = getHealth(t, "/readyz", http.StatusOK)
+	utils.Assert(4, len(health.Checks), t)
+
+	testAPI.SetGrpcState("", fmt.Errorf("address already in use"))
+	health = getHealth(t, "/healthz", http.StatusServiceUnavailable)
+	utils.Assert(healthFail, health.Status, t)
+	utils.Assert(healthFail, healthStatuses(health)["grpc"], t)
+	testAPI.SetGrpcState(":9100", nil)
+
+	// Low disk space makes the instance unready, not dead.
+	testAPI.settings.MinFreeSpace = math.MaxInt64
+	getHealth(t, "/healthz", http.StatusOK)
+	health = getHealth(t, "/readyz", http.StatusServiceUnavailable)
+	utils.Assert(healthFail, healthStatuses(health)["disk_space"], t)
+	testAPI.settings.MinFreeSpace = 0
+}
+
+func TestReadyDisconnectedSlave(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	testAPI.SetGrpcState(":9100", nil)
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer master.Close()
+	testAPI.settings.MasterURLs = []string{master.URL, "http://127.0.0.1:1"}
+
+	getHealth(t, "/healthz", http.StatusOK)
+	health := getHealth(t, "/readyz", http.StatusServiceUnavailable)
+	utils.Assert(
+		map[string]string{
+			"db": healthOk, "data_dir": healthOk, "grpc": healthOk, "disk_space": healthOk,
+			"watcher": healthFail, "master": healthFail,
+		},
+		healthStatuses(health),
+		t,
+	)
+	// Every master is checked.
+	masters := make([]string, 0)
+	for _, c := range health.Checks {
+		if c.Name == "master" {
+			masters = append(masters, c.Status)
+		}
+	}
+	utils.Assert([]string{healthOk, healthFail}, masters, t)
+}
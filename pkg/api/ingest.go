@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/lib/pkg/errors"
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const ingestChunkSize = 1024000
+
+// ingestArchive saves the uploaded tar, tgz or zip archive as the version.
+// With progress=true the response is streamed as JSON lines of types.IngestProgress.
+func (api *API) ingestArchive(req *restful.Request, resp *restful.Response) {
+	comment := req.QueryParameter("comment")
+	create := getBoolQueryParam(req, "create")
+	publish := getBoolQueryParam(req, "publish")
+	editing := getBoolQueryParam(req, "editing")
+	streamProgress := getBoolQueryParam(req, "progress")
+	format := req.QueryParameter("format")
+	prefix := req.QueryParameter("prefix")
+	version := req.PathParameter("version")
+	name := req.PathParameter("name")
+	workspace := req.PathParameter("workspace")
+	master := api.masterClient(req)
+
+	if err := utils.CheckVersion(version); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+	switch format {
+	case "", plukio.ArchiveTar, plukio.ArchiveTgz, plukio.ArchiveZip:
+	case "tar.gz":
+		format = plukio.ArchiveTgz
+	default:
+		WriteErrorString(resp, http.StatusBadRequest, "Wrong format: allowed tar, tgz and zip")
+		return
+	}
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	dataset, err := api.ds.NewDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if err = dataset.CheckEditable(version); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	if err = api.store.CheckDiskSpace(req.Request.ContentLength); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	body := bufio.NewReader(req.Request.Body)
+	if format == "" {
+		if format, err = plukio.DetectArchiveFormat(body); err != nil {
+			WriteStatusError(resp, http.StatusBadRequest, err)
+			return
+		}
+	}
+	// Tar and tgz are chunked as they are received. Zip needs random
+	// access and the progress can't be written until the request body is
+	// read, so then the body is stored in the data dir first.
+	var archive io.Reader = body
+	if format == plukio.ArchiveZip || streamProgress {
+		spooled, err := api.spoolArchive(body, workspace, req.Request.ContentLength)
+		if err != nil {
+			WriteError(resp, err)
+			return
+		}
+		defer func() {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}()
+		archive = spooled
+	}
+
+	api.lockForSave(workspace, name, version)
+	defer api.unlockForSave(workspace, name, version)
+
+	var report func(p types.IngestProgress)
+	if streamProgress {
+		resp.Header().Set("Content-Type", "application/x-ndjson")
+		resp.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(resp)
+		var last time.Time
+		report = func(p types.IngestProgress) {
+			if !p.Done && time.Since(last) < time.Second {
+				return
+			}
+			last = time.Now()
+			_ = enc.Encode(p)
+			if f, ok := resp.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+	// fail responds with the status unless the error has its own one,
+	// e.g. 507 of the low disk space.
+	fail := func(status int, err error) {
+		if report != nil {
+			report(types.IngestProgress{Done: true, Error: err.Error()})
+			return
+		}
+		if _, ok := err.(*errors.Error); ok {
+			WriteError(resp, err)
+			return
+		}
+		WriteStatusError(resp, status, err)
+	}
+
+	logrus.Infof("Ingesting archive into %v %v/%v:%v...", dataset.Type, workspace, name, version)
+	// Chunks are checked against the quota before they are written.
+	left, err := api.ds.QuotaLeft(workspace)
+	if err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	checkQuota := func(size int64) error {
+		if left < 0 || size <= left {
+			return nil
+		}
+		return api.ds.CheckQuota(workspace, size)
+	}
+	structure, err := api.store.IngestArchive(archive, format, prefix, ingestChunkSize, checkQuota, report)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+
+	if err = api.ds.CheckSaveQuota(dataset, *structure, version); err != nil {
+		fail(http.StatusInsufficientStorage, err)
+		return
+	}
+
+	if err = dataset.Save(*structure, version, comment, create, publish, editing, true); err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	api.invalidateVersionCache(dataset, version)
+
+	result, err := api.finishSave(req, dataset, version, comment, create, publish, editing)
+	if err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+
+	if report != nil {
+		var size int64
+		for _, f := range structure.Files {
+			size += f.Size
+		}
+		report(types.IngestProgress{Files: len(structure.Files), Bytes: size, Done: true, Result: result})
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, result)
+}
+
+// spoolArchive stores the request body of the size in a temp file in the
+// data dir if the workspace quota allows it.
+func (api *API) spoolArchive(body io.Reader, workspace string, size int64) (*os.File, error) {
+	if err := api.ds.CheckQuota(workspace, size); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(api.settings.DataDir(), ".ingest-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(f, body); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Failed to read the archive: %v", err))
+	}
+	return f, nil
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func tgzArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := bytes.NewBuffer([]byte{})
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf
+}
+
+func zipArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := bytes.NewBuffer([]byte{})
+	zw := zip.NewWriter(buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	return buf
+}
+
+func TestIngestArchive(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	archive := tgzArchive(t, map[string]string{"dir/file1.txt": fileData1, "../file2.txt": fileData2})
+	url := buildURL("dataset/workspace/ingested/versions/1.0.0/ingest?create=true")
+	resp, err := client.Post(url, "application/octet-stream", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/ingested/versions/1.0.0/raw/dir/file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/ingested/versions/1.0.0/raw/file2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData2, mustRead(resp.Body), t)
+
+	// Committed version can not be overwritten.
+	archive = zipArchive(t, map[string]string{"file3.txt": fileData1})
+	resp, err = client.Post(url, "application/octet-stream", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+
+	archive = zipArchive(t, map[string]string{"file3.txt": fileData1})
+	url = buildURL("dataset/workspace/ingested/versions/1.1.0/ingest?editing=true&progress=true&prefix=data")
+	resp, err = client.Post(url, "application/octet-stream", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var last types.IngestProgress
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err = json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	utils.Assert(true, last.Done, t)
+	utils.Assert("", last.Error, t)
+	utils.Assert(1, last.Files, t)
+
+	// The zip archive is stored in the data dir only while it is ingested.
+	spooled, _ := filepath.Glob(filepath.Join(testAPI.settings.DataDir(), ".ingest-*"))
+	utils.Assert(0, len(spooled), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/ingested/versions/1.1.0/raw/data/file3.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	resp, err = client.Post(url, "application/octet-stream", bytes.NewBufferString("not an archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	last = types.IngestProgress{}
+	if err = json.NewDecoder(resp.Body).Decode(&last); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(true, last.Error != "", t)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/jobs"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// submitJob runs fn as a background job. If async is set, the job is returned
+// at once with 202, otherwise the response is the job result with the given status.
+func (api *API) submitJob(resp *restful.Response, record *db.Job,
+	cancelable, async bool, status int, fn jobs.Func) {
+	job, err := api.jobs.Submit(record, cancelable, fn)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.AddHeader("X-Job-Id", fmt.Sprintf("%v", job.ID()))
+
+	if async {
+		resp.WriteHeaderAndEntity(http.StatusAccepted, job.Info())
+		return
+	}
+
+	result, err := job.Wait()
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(status, result)
+}
+
+func (api *API) listJobs(req *restful.Request, resp *restful.Response) {
+	filter := db.Job{
+		Workspace: req.PathParameter("workspace"),
+		State:     req.QueryParameter("state"),
+		Type:      req.QueryParameter("type"),
+	}
+	if filter.Workspace == "" {
+		filter.Workspace = req.QueryParameter("workspace")
+	}
+
+	items, err := api.jobs.List(filter)
+	if err != nil {
+		WriteStatusError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	resp.WriteEntity(types.JobList{Items: items})
+}
+
+func (api *API) getJob(req *restful.Request, resp *restful.Response) {
+	job, err := api.workspaceJob(req)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(job)
+}
+
+// getAnyJob returns the job of any workspace or of none, e.g. GC.
+func (api *API) getAnyJob(req *restful.Request, resp *restful.Response) {
+	id, err := jobID(req)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	job, err := api.jobs.Get(id)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(job)
+}
+
+func (api *API) cancelJob(req *restful.Request, resp *restful.Response) {
+	job, err := api.workspaceJob(req)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	if err = api.jobs.Cancel(job.ID); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// workspaceJob returns the job from the request path; jobs of other workspaces are not found.
+func (api *API) workspaceJob(req *restful.Request) (*types.Job, error) {
+	workspace := req.PathParameter("workspace")
+	id, err := jobID(req)
+	if err != nil {
+		return nil, err
+	}
+	job, err := api.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Workspace != workspace {
+		return nil, errors.NewStatus(http.StatusNotFound, fmt.Sprintf("Job %v not found", id))
+	}
+	return job, nil
+}
+
+func jobID(req *restful.Request) (uint, error) {
+	id, err := strconv.ParseUint(req.PathParameter("id"), 10, 64)
+	if err != nil {
+		return 0, errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Wrong job id: %v", err))
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/jobs"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func waitJob(t *testing.T, workspace string, id uint) types.Job {
+	var job types.Job
+	for i := 0; i < 50; i++ {
+		resp, err := client.Get(buildURL(fmt.Sprintf("jobs/%v/%v", workspace, id)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusOK, resp.StatusCode, t)
+		if err = json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+		if job.State != db.JobPending && job.State != db.JobRunning {
+			return job
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	t.Fatalf("Job %v is not finished", id)
+	return job
+}
+
+func TestAsyncForkJob(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file1.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp, err = client.Post(buildURL("dataset/workspace/dataset/versions/1.0.0/commit"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/fork/another-ws?async=true")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusAccepted, resp.StatusCode, t)
+	var job types.Job
+	if err = json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("fork", job.Type, t)
+
+	job = waitJob(t, "workspace", job.ID)
+	utils.Assert(db.JobSucceeded, job.State, t)
+	utils.Assert(int64(1), job.Done, t)
+	utils.Assert(int64(1), job.Total, t)
+
+	resp, err = client.Get(buildURL("dataset/another-ws/dataset/versions/1.0.0/raw/file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	// Finished job can't be cancelled.
+	url = buildURL(fmt.Sprintf("jobs/workspace/%v/cancel", job.ID))
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+
+	// Jobs are visible only in their workspace.
+	resp, err = client.Get(buildURL(fmt.Sprintf("jobs/another-ws/%v", job.ID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("jobs/workspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var list types.JobList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(1, len(list.Items), t)
+
+	// Synchronous fork still responds with the dataset.
+	url = buildURL("dataset/workspace/dataset/fork/third-ws")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	utils.Assert(true, resp.Header.Get("X-Job-Id") != "", t)
+}
+
+func TestAdminJob(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	resp, err := client.Get(buildURL("admin/gc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusAccepted, resp.StatusCode, t)
+	var job types.Job
+	if err = json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("", job.Workspace, t)
+
+	// GC jobs have no workspace, admins get them by ID.
+	for i := 0; i < 50 && job.State != db.JobSucceeded; i++ {
+		time.Sleep(time.Millisecond * 100)
+		resp, err = client.Get(buildURL(fmt.Sprintf("admin/jobs/%v", job.ID)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusOK, resp.StatusCode, t)
+		if err = json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	utils.Assert(db.JobSucceeded, job.State, t)
+	utils.Assert("gc", job.Type, t)
+}
+
+func TestCancelledForkIsDeleted(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	src := types.Dataset{Workspace: "workspace", Name: "dataset", DType: "dataset"}
+	target := types.Dataset{Workspace: "another-ws", Name: "dataset", DType: "dataset"}
+	_, err := testAPI.ds.ForkDataset(src, target, nil, func(done, total int64) error {
+		return context.Canceled
+	})
+	utils.Assert(context.Canceled, err, t)
+
+	resp, err := client.Get(buildURL("dataset/another-ws/dataset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+}
+
+func TestShutdownJobs(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	release := make(chan struct{})
+	defer close(release)
+	cancelable, err := testAPI.jobs.Submit(&db.Job{Type: "fork", Workspace: "workspace"}, true, func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocking, err := testAPI.jobs.Submit(&db.Job{Type: "gc"}, false, func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	utils.Assert(context.DeadlineExceeded, testAPI.ShutdownJobs(ctx), t)
+
+	job, err := testAPI.jobs.Get(cancelable.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(db.JobCancelled, job.State, t)
+	job, err = testAPI.jobs.Get(blocking.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(db.JobFailed, job.State, t)
+
+	_, err = testAPI.jobs.Submit(&db.Job{Type: "gc"}, false, func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		return nil, nil
+	})
+	utils.Assert(true, err != nil, t)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	var err error
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwtClaims(sub string, ttl time.Duration, scopes interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":         sub,
+		"aud":         []string{"pluk"},
+		"exp":         time.Now().Add(ttl).Unix(),
+		"pluk_scopes": scopes,
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	dir, err := ioutil.TempDir("", "pluk-jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keysFile := filepath.Join(dir, "jwks.json")
+	jwks := fmt.Sprintf(
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": %q}, {"kty": "RSA", "kid": "rsa", "n": %q, "e": "AQAB"}]}`,
+		base64.RawURLEncoding.EncodeToString(edPub),
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+	)
+	if err = ioutil.WriteFile(keysFile, []byte(jwks), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("AUTH_MODE", "jwt")
+	os.Setenv("JWT_KEYS", keysFile)
+	// Tokens of other services must not be accepted.
+	err = utils.LoadConfig()
+	utils.Assert(true, err != nil && strings.Contains(err.Error(), "JWT_AUDIENCE"), t)
+	os.Setenv("JWT_AUDIENCE", "pluk")
+	defer os.Unsetenv("AUTH_MODE")
+	defer os.Unsetenv("JWT_KEYS")
+	defer os.Unsetenv("JWT_AUDIENCE")
+
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	writer := signJWT(t, "EdDSA", "ed", edKey, jwtClaims("alice", time.Hour, "workspace:write other:read"))
+	reader := signJWT(t, "RS256", "rsa", rsaKey, jwtClaims("bob", time.Hour, []string{"workspace:read"}))
+
+	resp := authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", writer, fileData1)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", reader, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file2.txt", reader, fileData2)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	// gRPC and plukefs pass the token as the workspace secret.
+	ok, _ := testAPI.CheckAuth(http.MethodGet, "dataset", "", "", "", "workspace", reader, nil)
+	utils.Assert(true, ok, t)
+
+	rejected := map[string]string{
+		"expired":      signJWT(t, "EdDSA", "ed", edKey, jwtClaims("alice", -time.Hour, "workspace:read")),
+		"wrong key":    signJWT(t, "RS256", "rsa", unknownRSAKey(t), jwtClaims("alice", time.Hour, "workspace:read")),
+		"alg mismatch": signJWT(t, "RS256", "ed", rsaKey, jwtClaims("alice", time.Hour, "workspace:read")),
+		"no exp":       signJWT(t, "EdDSA", "ed", edKey, map[string]interface{}{"sub": "alice", "aud": "pluk"}),
+		"garbage":      "not.a.jwt",
+	}
+	wrongAud := jwtClaims("alice", time.Hour, "workspace:read")
+	wrongAud["aud"] = "other"
+	rejected["wrong audience"] = signJWT(t, "EdDSA", "ed", edKey, wrongAud)
+	for name, token := range rejected {
+		resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", token, "")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%v: want 401, got %v", name, resp.StatusCode)
+		}
+	}
+
+	// Admin scope grants admin routes.
+	admin := signJWT(t, "EdDSA", "ed", edKey, jwtClaims("root", time.Hour, "admin"))
+	resp = authRequest(t, http.MethodGet, "admin/audit", writer, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "admin/audit", admin, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	// Keys are reloaded when the file changes; the PEM format is accepted too.
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err = ioutil.WriteFile(keysFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(keysFile, future, future)
+
+	ecToken := signJWT(t, "ES256", "", ecKey, jwtClaims("carol", time.Hour, "workspace:read"))
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", ecToken, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", writer, "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	// Broken file keeps the previous keys.
+	ioutil.WriteFile(keysFile, []byte("broken"), 0644)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", ecToken, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+}
+
+// unknownRSAKey returns the RSA key missing in the key set.
+func unknownRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/gob"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/manifest"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func prepareSigningKey(t *testing.T) (ed25519.PublicKey, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := getFname()
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err = ioutil.WriteFile(keyFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pub, keyFile
+}
+
+func TestSignedManifest(t *testing.T) {
+	pub, keyFile := prepareSigningKey(t)
+	defer os.Remove(keyFile)
+	os.Setenv("MANIFEST_SIGNING_KEY", keyFile)
+	defer os.Unsetenv("MANIFEST_SIGNING_KEY")
+
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file1.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/upload/folder/file2.txt")
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(fileData2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	// Not signed until commit.
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/manifest.sig")
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/commit")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/manifest.sig")
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	sig := new(types.ManifestSignature)
+	if err = json.NewDecoder(resp.Body).Decode(sig); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(manifest.KeyID(pub), sig.KeyID, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/fs?format=gob")
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := new(plukio.ChunkedFileFS)
+	if err = gob.NewDecoder(resp.Body).Decode(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	m := manifest.FromFS("dataset", "workspace", "dataset", "1.0.0", fs)
+	utils.Assert(2, len(m.Files), t)
+	utils.Assert(nil, manifest.Verify(pub, m, sig), t)
+
+	// Downloaded archive matches the manifest.
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0")
+	resp, err = client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := manifest.NewTarVerifier(m)
+	if _, err = io.Copy(verifier, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(nil, verifier.Close(), t)
+
+	// Any change of the structure breaks the signature.
+	m.Files[0].Size++
+	if err = manifest.Verify(pub, m, sig); err == nil {
+		t.Fatal("Verification must fail for the changed manifest")
+	}
+}
+
+func TestManifestFailureKeepsVersionEditing(t *testing.T) {
+	_, keyFile := prepareSigningKey(t)
+	defer os.Remove(keyFile)
+	os.Setenv("MANIFEST_SIGNING_KEY", keyFile)
+	defer os.Unsetenv("MANIFEST_SIGNING_KEY")
+
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	uploadFile(t, "1.0.0", "file1.txt", fileData1)
+
+	// The manifest can't be stored, so the commit is rolled back.
+	if err := testMgr.DB().Exec("DROP TABLE version_manifests").Error; err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Post(buildURL("dataset/workspace/dataset/versions/1.0.0/commit"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInternalServerError, resp.StatusCode, t)
+	dsv, err := testMgr.GetDatasetVersion("dataset", "workspace", "dataset", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(true, dsv.Editing, t)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+func (api *API) mergeVersion(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	theirs := req.PathParameter("theirs")
+	base := req.QueryParameter("base")
+	master := api.masterClient(req)
+
+	if base == "" {
+		WriteErrorString(resp, http.StatusBadRequest, "Provide base version")
+		return
+	}
+	mergeReq := types.MergeRequest{}
+	if req.Request.ContentLength > 0 {
+		if err := req.ReadEntity(&mergeReq); err != nil {
+			WriteStatusError(resp, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+	if _, err = api.findDatasetVersion(dataset, version, false); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	for _, v := range []string{theirs, base} {
+		if _, err = api.findDatasetVersion(dataset, v, true); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	api.lockForSave(workspace, name, version)
+	defer api.unlockForSave(workspace, name, version)
+	result, err := dataset.MergeVersion(version, theirs, base, mergeReq.Resolutions)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	api.invalidateVersionCache(dataset, version)
+
+	resp.WriteEntity(result)
+}
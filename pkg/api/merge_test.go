@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func uploadFile(t *testing.T, version, path, data string) {
+	url := buildURL("dataset/workspace/dataset/versions/" + version + "/upload/" + path)
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+}
+
+func mergeVersions(t *testing.T, body string) types.MergeResult {
+	url := buildURL("dataset/workspace/dataset/versions/1.1.0/merge/1.2.0?base=1.0.0")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var result types.MergeResult
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestMergeVersions(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	uploadFile(t, "1.0.0", "a.txt", fileData1)
+	uploadFile(t, "1.0.0", "b.txt", fileData1)
+	resp, err := client.Post(buildURL("dataset/workspace/dataset/versions/1.0.0/commit"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	for _, v := range []string{"1.1.0", "1.2.0"} {
+		resp, err = client.Post(buildURL("dataset/workspace/dataset/versions/1.0.0/clone/"+v), "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+
+	otherData := "theirs data"
+	uploadFile(t, "1.1.0", "b.txt", fileData2)
+	uploadFile(t, "1.2.0", "b.txt", otherData)
+	uploadFile(t, "1.2.0", "new.txt", fileData2)
+	req, _ := http.NewRequest(http.MethodDelete, buildURL("dataset/workspace/dataset/versions/1.2.0/upload/a.txt"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+
+	result := mergeVersions(t, "")
+	utils.Assert([]string{"new.txt"}, result.Added, t)
+	utils.Assert([]string{"a.txt"}, result.Deleted, t)
+	utils.Assert(0, len(result.Modified), t)
+	utils.Assert([]types.MergeConflict{{Path: "b.txt", Ours: "modified", Theirs: "modified"}}, result.Conflicts, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.1.0/raw/new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData2, mustRead(resp.Body), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.1.0/raw/a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	// Resolve the conflict with their side.
+	result = mergeVersions(t, `{"resolutions": {"b.txt": "theirs"}}`)
+	utils.Assert([]string{"b.txt"}, result.Modified, t)
+	utils.Assert(0, len(result.Added)+len(result.Deleted)+len(result.Conflicts), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.1.0/raw/b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(otherData, mustRead(resp.Body), t)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestMetrics(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	resp, err := client.Get(buildURL("dataset/workspace/dataset/versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	body := mustRead(resp.Body)
+
+	expected := []string{
+		`pluk_http_requests_total{method="GET",route="` + utils.ApiPrefix + `/{entityType}/{workspace}/{name}/versions",status="200"}`,
+		`pluk_http_request_duration_seconds_count{method="GET",route="` + utils.ApiPrefix + `/{entityType}/{workspace}/{name}/versions"}`,
+		"pluk_websocket_connections",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Fatalf("Metric %v not found", e)
+		}
+	}
+}
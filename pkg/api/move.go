@@ -0,0 +1,112 @@
+package api
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/datasets"
+)
+
+func (api *API) moveFiles(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	from := req.QueryParameter("from")
+	to := req.QueryParameter("to")
+	master := api.masterClient(req)
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	if _, err = api.findDatasetVersion(dataset, version, false); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	api.lockForSave(workspace, name, version)
+	defer api.unlockForSave(workspace, name, version)
+	if err = dataset.MoveFiles(version, from, to); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	api.invalidateVersionCache(dataset, version)
+
+	api.writeVersion(resp, dataset, version)
+}
+
+func (api *API) copyFiles(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	from := req.QueryParameter("from")
+	to := req.QueryParameter("to")
+	srcWorkspace := req.QueryParameter("source_workspace")
+	srcName := req.QueryParameter("source_name")
+	srcVersion := req.QueryParameter("source_version")
+	master := api.masterClient(req)
+
+	if srcWorkspace == "" {
+		srcWorkspace = workspace
+	}
+	if srcName == "" {
+		srcName = name
+	}
+	if srcVersion == "" {
+		srcVersion = version
+	}
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	if _, err = api.findDatasetVersion(dataset, version, false); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	src := dataset
+	if srcWorkspace != workspace || srcName != name {
+		// Reading from another entity requires read access to it.
+		if _, err = api.checkEntityAccessFor(req, currentType(req), srcWorkspace, srcName, false); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		src, err = api.ds.GetDataset(currentType(req), srcWorkspace, srcName, master)
+		if err != nil {
+			WriteError(resp, EntityNotFoundError(req, srcName, err))
+			return
+		}
+	}
+	if _, err = api.findDatasetVersion(src, srcVersion, true); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	api.lockForSave(workspace, name, version)
+	defer api.unlockForSave(workspace, name, version)
+	if err = dataset.CopyFiles(src, srcVersion, from, version, to); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	api.invalidateVersionCache(dataset, version)
+
+	api.writeVersion(resp, dataset, version)
+}
+
+func (api *API) writeVersion(resp *restful.Response, dataset *datasets.Dataset, version string) {
+	vs, err := api.findDatasetVersion(dataset, version, true)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(vs)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestMoveCopyFiles(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	for path, data := range map[string]string{"dir/file1.txt": fileData1, "dir/file2.txt": fileData2} {
+		url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/" + path)
+		resp, err := client.Post(url, "application/json", bytes.NewBufferString(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/move?from=dir&to=moved")
+	resp, err := client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var vs types.Version
+	if err = json.NewDecoder(resp.Body).Decode(&vs); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(int64(len(fileData1)+len(fileData2)), vs.SizeBytes, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/moved/file2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData2, mustRead(resp.Body), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/dir/file2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	// Overwrite existing file by copy.
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/copy?from=moved/file1.txt&to=moved/file2.txt")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/moved/file2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/move?from=missing&to=other")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/move?from=moved&to=moved/sub")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+}
+
+func TestMoveFilesWildcards(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	for path, data := range map[string]string{"img_1/a.txt": fileData1, "imgX1/b.txt": fileData2} {
+		url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/" + path)
+		resp, err := client.Post(url, "application/json", bytes.NewBufferString(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+
+	// "_" must not match any character.
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/move?from=img_1&to=moved")
+	resp, err := client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	for path, status := range map[string]int{
+		"moved/a.txt": http.StatusOK,
+		"img_1/a.txt": http.StatusNotFound,
+		"imgX1/b.txt": http.StatusOK,
+		"moved/b.txt": http.StatusNotFound,
+	} {
+		resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/" + path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(status, resp.StatusCode, t)
+	}
+}
@@ -179,7 +179,7 @@ func TestPushSameChunksOldNewAccessible(t *testing.T) {
 	}
 
 	data, _ := json.Marshal(structure)
-	url := buildURL("dataset/workspace/new/1.0.0")
+	url := buildURL("dataset/workspace/new/1.0.0?editing=true")
 	resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		t.Fatal(err)
@@ -275,7 +275,7 @@ func TestPushSameChunksNewOldAccessible(t *testing.T) {
 	}
 
 	data, _ := json.Marshal(structure)
-	url := buildURL("dataset/workspace/new/1.0.0")
+	url := buildURL("dataset/workspace/new/1.0.0?editing=true")
 	resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		t.Fatal(err)
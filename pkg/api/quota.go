@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+func (api *API) workspaceUsage(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	master := api.masterClient(req)
+
+	usage, err := api.ds.WorkspaceUsage(workspace, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(usage)
+}
+
+func (api *API) getWorkspaceQuota(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	master := api.masterClient(req)
+
+	quota, err := api.ds.WorkspaceQuota(workspace, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(quota)
+}
+
+func (api *API) setWorkspaceQuota(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	master := api.masterClient(req)
+
+	quota := new(types.WorkspaceQuota)
+	if err := req.ReadEntity(quota); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := api.ds.SetWorkspaceQuota(workspace, quota, master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(quota)
+}
+
+func (api *API) deleteWorkspaceQuota(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	master := api.masterClient(req)
+
+	if err := api.ds.DeleteWorkspaceQuota(workspace, master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
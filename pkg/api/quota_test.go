@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	libtypes "github.com/kuberlab/lib/pkg/types"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func getUsage(t *testing.T) types.WorkspaceUsage {
+	resp, err := client.Get(buildURL("usage/workspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var usage types.WorkspaceUsage
+	if err = json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		t.Fatal(err)
+	}
+	return usage
+}
+
+func TestWorkspaceQuota(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	size := int64(len(fileData1))
+	uploadFile(t, "1.0.0", "file1.txt", fileData1)
+
+	usage := getUsage(t)
+	utils.Assert(size, usage.LogicalBytes, t)
+	utils.Assert(size, usage.PhysicalBytes, t)
+	utils.Assert(int64(0), usage.SharedBytes, t)
+	utils.Assert(int64(0), usage.QuotaBytes, t)
+
+	url := buildURL("quotas/workspace")
+	quota := fmt.Sprintf(`{"bytes": %v}`, size+5)
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(quota))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(size+5, getUsage(t).QuotaBytes, t)
+
+	// Replacing the file with the same size does not grow the workspace.
+	uploadFile(t, "1.0.0", "file1.txt", fileData1)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file2.txt")
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(fileData2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+
+	req, _ = http.NewRequest(http.MethodPost, buildURL("chunks/somehash"), bytes.NewBufferString(fileData2))
+	req.Header.Set("X-Workspace-Name", "workspace")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+
+	// Chunks are not accounted to an empty workspace.
+	req, _ = http.NewRequest(http.MethodPost, buildURL("chunks/somehash"), bytes.NewBufferString(fileData2))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+
+	// The size of chunked uploads is unknown, the chunks over quota are not written.
+	body := io.MultiReader(bytes.NewBufferString(fileData2))
+	resp, err = client.Post(url, "application/octet-stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+	_, exists := testAPI.store.CheckLocalChunk(utils.CalcHash([]byte(fileData2)), types.ChunkVersion)
+	utils.Assert(false, exists, t)
+
+	req, _ = http.NewRequest(http.MethodDelete, buildURL("quotas/workspace"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+
+	uploadFile(t, "1.0.0", "file2.txt", fileData2)
+	utils.Assert(size+int64(len(fileData2)), getUsage(t).LogicalBytes, t)
+}
+
+func TestQuotaUnsavedUploads(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	req, _ := http.NewRequest(http.MethodPut, buildURL("quotas/workspace"), bytes.NewBufferString(`{"bytes": 100}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	first, second := strings.Repeat("a", 60), strings.Repeat("b", 60)
+	postChunk := func(data string) int {
+		req, _ := http.NewRequest(http.MethodPost, buildURL("chunks/"+utils.CalcHash([]byte(data))), bytes.NewBufferString(data))
+		req.Header.Set("X-Workspace-Name", "workspace")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Each chunk fits into the quota, both don't: uploaded chunks count
+	// until they are saved.
+	utils.Assert(http.StatusCreated, postChunk(first), t)
+	utils.Assert(http.StatusInsufficientStorage, postChunk(second), t)
+
+	// The saved chunk is not counted twice.
+	structure := &types.FileStructure{Files: []*types.HashedFile{{
+		Size:     60,
+		Path:     "first.txt",
+		Mode:     0644,
+		Hashes:   []types.Hash{{Hash: utils.CalcHash([]byte(first)), Size: 60}},
+		ModeTime: time.Now(),
+	}}}
+	data, _ := json.Marshal(structure)
+	resp, err = client.Post(buildURL("dataset/workspace/new/1.0.0"), "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	utils.Assert(int64(60), getUsage(t).LogicalBytes, t)
+
+	// Chunks sent via websocket are checked as well.
+	header := http.Header{}
+	header.Set("X-Workspace-Name", "workspace")
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + utils.ApiPrefix + "/websocket-chunks"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	chunk := &types.ChunkData{Hash: utils.CalcHash([]byte(second)), Data: []byte(second)}
+	if err = conn.WriteJSON(libtypes.Message{Type: chunk.Type(), Content: chunk}); err != nil {
+		t.Fatal(err)
+	}
+	var msg libtypes.Message
+	if err = conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert("error", msg.Type, t)
+	utils.Assert(float64(http.StatusInsufficientStorage), msg.Content.(map[string]interface{})["status"], t)
+
+	// Ingested archives stop at the quota before the chunk is written.
+	archive := tgzArchive(t, map[string]string{"second.txt": second})
+	resp, err = client.Post(buildURL("dataset/workspace/new/versions/1.1.0/ingest?create=true"), "application/octet-stream", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+	_, exists := testAPI.store.CheckLocalChunk(chunk.Hash, types.ChunkVersion)
+	utils.Assert(false, exists, t)
+}
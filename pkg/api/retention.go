@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+func (api *API) getRetentionPolicy(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	policy, err := api.ds.RetentionPolicy(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(policy)
+}
+
+func (api *API) setRetentionPolicy(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	policy := new(types.RetentionPolicy)
+	if err := req.ReadEntity(policy); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := api.ds.GetDataset(currentType(req), workspace, name, master); err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	if err := api.ds.SetRetentionPolicy(currentType(req), workspace, name, policy, master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(policy)
+}
+
+func (api *API) deleteRetentionPolicy(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	if err := api.ds.DeleteRetentionPolicy(currentType(req), workspace, name, master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) retentionDryRun(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	versions, err := api.ds.RetentionCandidates(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(types.VersionList{Versions: versions})
+}
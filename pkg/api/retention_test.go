@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	libtypes "github.com/kuberlab/lib/pkg/types"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	versions := []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3", "1.0.4"}
+	for i, v := range versions {
+		// 1.0.0 is created by dbPrepare.
+		if i > 0 {
+			url := buildURL(fmt.Sprintf("dataset/workspace/dataset/versions/%v", v))
+			resp, err := client.Post(url, "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			utils.Assert(http.StatusCreated, resp.StatusCode, t)
+		}
+
+		url := buildURL(fmt.Sprintf("dataset/workspace/dataset/versions/%v/upload/file.txt", v))
+		resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+		if v != "1.0.4" {
+			url = buildURL(fmt.Sprintf("dataset/workspace/dataset/versions/%v/commit", v))
+			resp, err = client.Post(url, "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			utils.Assert(http.StatusOK, resp.StatusCode, t)
+		}
+		date := libtypes.Time{Time: time.Now().Add(-time.Hour * 24 * time.Duration(10-i))}
+		if err = testMgr.UpdateDatasetVersionDate("dataset", "workspace", "dataset", v, date); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	url := buildURL("dataset/workspace/dataset/retention")
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	// Patterns are stored comma-separated.
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(`{"exclude": ["1.0.0,1.0.1"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+
+	policy := `{"keep_last": 2, "editing_days": 3, "exclude": ["1.0.0"]}`
+	req, _ = http.NewRequest(http.MethodPut, url, bytes.NewBufferString(policy))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/retention/dry-run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var list types.VersionList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	// 1.0.0 is excluded, 1.0.2 and 1.0.3 are the last committed ones.
+	deleted := make([]string, 0)
+	for _, v := range list.Versions {
+		deleted = append(deleted, v.Version)
+	}
+	utils.Assert([]string{"1.0.4", "1.0.1"}, deleted, t)
+
+	testAPI.gc.GoGC()
+
+	trash := listTrash(t)
+	utils.Assert(2, len(trash.Items), t)
+}
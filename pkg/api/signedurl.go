@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/auth"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+// signVersionURL mints the signed URL of the file if the path is given
+// or of the version tar archive otherwise.
+func (api *API) signVersionURL(req *restful.Request, resp *restful.Response) {
+	version := req.PathParameter("version")
+	name := req.PathParameter("name")
+	workspace := req.PathParameter("workspace")
+	filePath := strings.TrimPrefix(req.QueryParameter("path"), "/")
+	master := api.masterClient(req)
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+	fs, err := api.getFS(dataset, version, "")
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	target := strings.TrimSuffix(req.Request.URL.Path, "/signed-url")
+	if filePath != "" {
+		file := fs.GetFile(filePath)
+		if file == nil || file.Dir {
+			WriteErrorString(resp, http.StatusNotFound, fmt.Sprintf("No such file: %v", filePath))
+			return
+		}
+		target += "/raw/" + filePath
+	}
+	api.writeSignedURL(req, resp, target)
+}
+
+func (api *API) signChunkURL(req *restful.Request, resp *restful.Response) {
+	hash := req.PathParameter("hash")
+	chunk, err := api.mgr.GetChunk(hash)
+	if err != nil {
+		WriteErrorString(resp, http.StatusNotFound, fmt.Sprintf("Chunk %v not found", hash))
+		return
+	}
+	target := fmt.Sprintf("%v/download/%v", strings.TrimSuffix(req.Request.URL.Path, "/signed-url"), chunk.Version)
+	api.writeSignedURL(req, resp, target)
+}
+
+func (api *API) writeSignedURL(req *restful.Request, resp *restful.Response, target string) {
+	key := api.settings.URLSigningKey
+	if key == "" {
+		WriteErrorString(resp, http.StatusNotImplemented, "Signed URLs are not enabled: URL_SIGNING_KEY is not set.")
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if raw := req.QueryParameter("expires"); raw != "" {
+		var err error
+		ttl, err = time.ParseDuration(raw)
+		if err != nil || ttl <= 0 || ttl > maxSignedURLTTL {
+			WriteErrorString(resp, http.StatusBadRequest, fmt.Sprintf("Invalid expires %q: must be a duration up to %v", raw, maxSignedURLTTL))
+			return
+		}
+	}
+	ip := req.QueryParameter("ip")
+	if ip != "" {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			WriteErrorString(resp, http.StatusBadRequest, fmt.Sprintf("Invalid ip %q: must be an address or CIDR", ip))
+			return
+		}
+	}
+	var maxSize int64
+	if raw := req.QueryParameter("max_size"); raw != "" {
+		var err error
+		maxSize, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxSize < 0 {
+			WriteErrorString(resp, http.StatusBadRequest, fmt.Sprintf("Invalid max_size %q", raw))
+			return
+		}
+	}
+
+	expires := time.Now().Add(ttl)
+	scheme := "http"
+	if req.Request.TLS != nil || req.HeaderParameter("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     req.Request.Host,
+		Path:     target,
+		RawQuery: auth.SignURL(key, target, expires, ip, maxSize).Encode(),
+	}
+	resp.WriteEntity(types.SignedURL{URL: u.String(), ExpiresAt: expires.UTC().Truncate(time.Second)})
+}
+
+// signedURLHook serves requests with a signature instead of credentials.
+func (api *API) signedURLHook(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
+	if req.Request.Method != http.MethodGet && req.Request.Method != http.MethodHead {
+		WriteErrorString(resp, http.StatusForbidden, "Signed URLs allow only GET requests.")
+		return
+	}
+	maxSize, err := auth.VerifySignedURL(
+		api.settings.URLSigningKey,
+		req.Request.URL.Path,
+		req.Request.URL.Query(),
+		remoteAddr(req.Request),
+	)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	req.SetAttribute("signed_max_size", maxSize)
+	// Slaves get entities missing locally from the master with the internal key.
+	req.SetAttribute("masterclient", api.store.Master)
+	filter.ProcessFilter(req, resp)
+}
+
+// checkSignedSize rejects downloads via signed URLs exceeding their size limit.
+func checkSignedSize(req *restful.Request, size int64) error {
+	maxSize, _ := req.Attribute("signed_max_size").(int64)
+	if maxSize > 0 && size > maxSize {
+		return errors.NewStatus(
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Size %v exceeds the signed URL limit %v.", size, maxSize),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/auth"
+	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func signedURL(t *testing.T, path string) string {
+	resp := authRequest(t, http.MethodGet, path, "", "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var signed types.SignedURL
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		t.Fatal(err)
+	}
+	return signed.URL
+}
+
+func getStatus(t *testing.T, u string) int {
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSignedURL(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	resp := authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/dir/file1.txt", "", fileData1)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt", "", "")
+	utils.Assert(http.StatusNotImplemented, resp.StatusCode, t)
+
+	testAPI.settings.URLSigningKey = "test-signing-key"
+
+	u := signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt&expires=1m")
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	// The signature covers the path and the restrictions.
+	utils.Assert(http.StatusForbidden, getStatus(t, strings.Replace(u, "file1.txt", "file2.txt", 1)), t)
+	utils.Assert(http.StatusForbidden, getStatus(t, u+"&max_size=100000"), t)
+	parsed, _ := url.Parse(u)
+	utils.Assert(http.StatusUnauthorized, getStatus(t, strings.Split(u, "?")[0]), t)
+	upload := strings.Replace(parsed.Path, "/raw/", "/upload/", 1)
+	query := auth.SignURL("test-signing-key", upload, time.Now().Add(time.Minute), "", 0)
+	resp, err = client.Post(server.URL+upload+"?"+query.Encode(), "application/json", strings.NewReader(fileData2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	expired := auth.SignURL("test-signing-key", parsed.Path, time.Now().Add(-time.Second), "", 0)
+	utils.Assert(http.StatusForbidden, getStatus(t, server.URL+parsed.Path+"?"+expired.Encode()), t)
+
+	utils.Assert(http.StatusForbidden, getStatus(t, signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt&ip=10.0.0.1")), t)
+	utils.Assert(http.StatusOK, getStatus(t, signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt&ip=127.0.0.0/8")), t)
+
+	// X-Forwarded-For is taken only from trusted proxies.
+	forwarded := func(u, header string) int {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		req.Header.Set("X-Forwarded-For", header)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	u = signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt&ip=10.0.0.1")
+	utils.Assert(http.StatusForbidden, forwarded(u, "10.0.0.1"), t)
+	os.Setenv("TRUSTED_PROXIES", "127.0.0.1,192.168.0.0/16")
+	defer os.Unsetenv("TRUSTED_PROXIES")
+	utils.Assert(http.StatusOK, forwarded(u, "10.0.0.1"), t)
+	utils.Assert(http.StatusOK, forwarded(u, "10.0.0.1, 192.168.1.1"), t)
+	utils.Assert(http.StatusForbidden, forwarded(u, "10.0.0.1, 10.0.0.2"), t)
+	os.Unsetenv("TRUSTED_PROXIES")
+	utils.Assert(http.StatusRequestEntityTooLarge, getStatus(t, signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=dir/file1.txt&max_size=5")), t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions/1.0.0/signed-url?path=missing.txt", "", "")
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions/1.0.0/signed-url?expires=720h", "", "")
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+
+	// Version archive and chunks.
+	resp, err = client.Get(signedURL(t, "dataset/workspace/dataset/versions/1.0.0/signed-url"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert("application/tar", resp.Header.Get("Content-Type"), t)
+	mustRead(resp.Body)
+
+	var hash string
+	if err = testMgr.DB().Table("chunks").Select("hash").Row().Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Get(signedURL(t, "chunks/"+hash+"/signed-url"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(true, len(mustRead(resp.Body)) > 0, t)
+
+	// Slaves serve signed URLs of versions they get from the master.
+	master, closeMaster := startMaster(t)
+	defer closeMaster()
+	for _, path := range []string{"", "/versions/1.0.0", "/versions/1.0.0/upload/file2.txt"} {
+		body := ""
+		if strings.HasSuffix(path, ".txt") {
+			body = fileData2
+		}
+		resp, err = client.Post(master.URL+utils.ApiPrefix+"/dataset/workspace/remote"+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	}
+	resp, err = client.Post(master.URL+utils.ApiPrefix+"/dataset/workspace/remote/versions/1.0.0/commit", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	testAPI.settings.MasterURLs = []string{master.URL}
+	testAPI.store.Master = plukclient.NewInternalMasterClient(testAPI.settings)
+	raw := utils.ApiPrefix + "/dataset/workspace/remote/versions/1.0.0/raw/file2.txt"
+	query = auth.SignURL("test-signing-key", raw, time.Now().Add(time.Minute), "", 0)
+	resp, err = client.Get(server.URL + raw + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData2, mustRead(resp.Body), t)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func TestLowDiskSpace(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	testAPI.settings.MinFreeSpace = math.MaxInt64
+
+	chunkHash := utils.CalcHash([]byte(fileData1))
+	url := buildURL(fmt.Sprintf("chunks/%v", chunkHash))
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+	if body := mustRead(resp.Body); !strings.Contains(body, "Not enough disk space") {
+		t.Fatalf("Unexpected error: %v", body)
+	}
+	_, exists := testAPI.store.CheckLocalChunk(chunkHash, types.ChunkVersion)
+	utils.Assert(false, exists, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file1.txt")
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+
+	testAPI.settings.MinFreeSpace = 0
+	uploadFile(t, "1.0.0", "file1.txt", fileData1)
+	_, exists = testAPI.store.CheckLocalChunk(chunkHash, types.ChunkVersion)
+	utils.Assert(true, exists, t)
+}
+
+func TestLowDiskSpaceStatus(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	// The 507 of the chunk write itself is kept, so clients don't retry.
+	chunkHash := utils.CalcHash([]byte(fileData1))
+	url := buildURL(fmt.Sprintf("chunks/%v", chunkHash))
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	testAPI.settings.MinFreeSpace = math.MaxInt64
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+
+	archive := tgzArchive(t, map[string]string{"file1.txt": fileData2})
+	resp, err = client.Post(buildURL("dataset/workspace/ingested/versions/1.0.0/ingest?create=true"), "application/octet-stream", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusInsufficientStorage, resp.StatusCode, t)
+}
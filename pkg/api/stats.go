@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/emicklei/go-restful"
+)
+
+func (api *API) storageStats(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	perVersion := getBoolQueryParam(req, "versions")
+	master := api.masterClient(req)
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+	if version != "" {
+		if _, err = api.findDatasetVersion(dataset, version, true); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	stats, err := api.ds.StorageStats(currentType(req), workspace, name, version, perVersion, master)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(stats)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func getStats(t *testing.T, path string) types.StorageStats {
+	resp, err := client.Get(buildURL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var stats types.StorageStats
+	if err = json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestStorageStats(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	size1 := int64(len(fileData1))
+	size2 := int64(len(fileData2))
+	uploadFile(t, "1.0.0", "file1.txt", fileData1)
+	uploadFile(t, "1.0.0", "file2.txt", fileData2)
+
+	resp, err := client.Post(buildURL("dataset/workspace/dataset/versions/1.1.0"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	uploadFile(t, "1.1.0", "copy.txt", fileData1)
+
+	stats := getStats(t, "dataset/workspace/dataset/versions/1.0.0/stats")
+	utils.Assert(int64(2), stats.Files, t)
+	utils.Assert(size1+size2, stats.LogicalBytes, t)
+	utils.Assert(int64(2), stats.UniqueChunks, t)
+	utils.Assert(size1, stats.SharedBytes, t)
+	utils.Assert(size2, stats.ExclusiveBytes, t)
+	utils.Assert(1.0, stats.DedupRatio, t)
+
+	stats = getStats(t, "dataset/workspace/dataset/versions/1.1.0/stats")
+	utils.Assert(size1, stats.SharedBytes, t)
+	utils.Assert(int64(0), stats.ExclusiveBytes, t)
+
+	stats = getStats(t, "dataset/workspace/dataset/stats?versions=true")
+	utils.Assert(int64(3), stats.Files, t)
+	utils.Assert(2*size1+size2, stats.LogicalBytes, t)
+	utils.Assert(size1+size2, stats.UniqueBytes, t)
+	utils.Assert(int64(0), stats.SharedBytes, t)
+	utils.Assert(size1+size2, stats.ExclusiveBytes, t)
+	utils.Assert(float64(2*size1+size2)/float64(size1+size2), stats.DedupRatio, t)
+	utils.Assert(2, len(stats.Versions), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/2.0.0/stats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+// writeCert issues the certificate for 127.0.0.1 signed by the CA
+// (self-signed CA if ca is nil) and writes it with the key as PEM files.
+func writeCert(t *testing.T, certFile, keyFile string, serial int64, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "pluk-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		ca, caKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if keyFile != "" {
+		ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// tlsGet makes the request over a new connection and returns the serial
+// number of the server certificate.
+func tlsGet(u string) (int64, error) {
+	c := &http.Client{Timeout: time.Second * 5, Transport: clientTransport()}
+	resp, err := c.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	c.CloseIdleConnections()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestTLS(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	dir, err := ioutil.TempDir("", "pluk-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ca, caKey := writeCert(t, caFile, "", 1, nil, nil)
+	writeCert(t, certFile, keyFile, 2, ca, caKey)
+
+	os.Setenv("TLS_CERT_FILE", certFile)
+	defer os.Unsetenv("TLS_CERT_FILE")
+	_, err = utils.ServerTLSConfig()
+	utils.Assert(true, err != nil, t)
+	os.Setenv("TLS_KEY_FILE", keyFile)
+	defer os.Unsetenv("TLS_KEY_FILE")
+
+	tlsConfig, err := utils.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: server.Config.Handler}
+	go srv.Serve(ln)
+	defer srv.Close()
+	u := "https://" + ln.Addr().String() + "/probe"
+
+	// The certificate is verified unless the CA is trusted.
+	_, err = tlsGet(u)
+	utils.Assert(true, err != nil, t)
+	os.Setenv("TLS_CA_FILE", caFile)
+	defer os.Unsetenv("TLS_CA_FILE")
+	serial, err := tlsGet(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(int64(2), serial, t)
+
+	// The renewed certificate is served without restart.
+	writeCert(t, certFile, keyFile, 3, ca, caKey)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	serial, err = tlsGet(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(int64(3), serial, t)
+
+	// Verification may be disabled explicitly.
+	os.Unsetenv("TLS_CA_FILE")
+	os.Setenv("TLS_INSECURE_SKIP_VERIFY", "true")
+	defer os.Unsetenv("TLS_INSECURE_SKIP_VERIFY")
+	_, err = tlsGet(u)
+	utils.Assert(nil, err, t)
+}
+
+func TestMutualTLS(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	defer teardown(fname)
+
+	dir, err := ioutil.TempDir("", "pluk-mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ca, caKey := writeCert(t, caFile, "", 1, nil, nil)
+	writeCert(t, certFile, keyFile, 2, ca, caKey)
+
+	testAPI.settings.AuthMode = "local"
+	testAPI.settings.SetAuth("", []string{testInternalKey, "old-key"})
+	env := map[string]string{
+		"INTERNAL_KEY":             testInternalKey + ",old-key",
+		"TLS_CERT_FILE":            certFile,
+		"TLS_KEY_FILE":             keyFile,
+		"TLS_CA_FILE":              caFile,
+		"TLS_CLIENT_CA_FILE":       caFile,
+		"INTERNAL_CLIENT_SUBJECTS": "pluk-test",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	utils.Assert(testInternalKey, utils.InternalKey(), t)
+
+	tlsConfig, err := utils.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: server.Config.Handler}
+	go srv.Serve(ln)
+	defer srv.Close()
+	base := "https://" + ln.Addr().String()
+
+	get := func(conf *tls.Config, path, key string) int {
+		c := &http.Client{Timeout: time.Second * 5, Transport: &http.Transport{TLSClientConfig: conf}}
+		defer c.CloseIdleConnections()
+		req, _ := http.NewRequest(http.MethodGet, base+path, nil)
+		if key != "" {
+			req.Header.Set("Internal", key)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Without the client certificate only the internal keys are accepted.
+	utils.Assert(http.StatusUnauthorized, get(utils.NodeTLSConfig(), "/pluk/v1/admin/users", ""), t)
+	utils.Assert(http.StatusUnauthorized, get(utils.NodeTLSConfig(), "/internal/admin/users", ""), t)
+	utils.Assert(http.StatusOK, get(utils.NodeTLSConfig(), "/internal/admin/users", "old-key"), t)
+	utils.Assert(http.StatusUnauthorized, get(utils.NodeTLSConfig(), "/internal/admin/users", "bad-key"), t)
+
+	os.Setenv("TLS_CLIENT_CERT_FILE", certFile)
+	os.Setenv("TLS_CLIENT_KEY_FILE", keyFile)
+	defer os.Unsetenv("TLS_CLIENT_CERT_FILE")
+	defer os.Unsetenv("TLS_CLIENT_KEY_FILE")
+	utils.Assert(http.StatusOK, get(utils.NodeTLSConfig(), "/pluk/v1/admin/users", ""), t)
+	utils.Assert(http.StatusOK, get(utils.NodeTLSConfig(), "/internal/admin/users", ""), t)
+	// Requests on behalf of users don't present the certificate.
+	utils.Assert(http.StatusUnauthorized, get(utils.ClientTLSConfig(), "/pluk/v1/admin/users", ""), t)
+
+	// The certificate subject must be allowed.
+	os.Setenv("INTERNAL_CLIENT_SUBJECTS", "other-node")
+	utils.Assert(http.StatusUnauthorized, get(utils.NodeTLSConfig(), "/internal/admin/users", ""), t)
+}
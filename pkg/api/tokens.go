@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/auth"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// localAuthEnabled tells whether this instance authenticates requests itself,
+// with its own tokens or JWTs. Slaves always delegate authentication to master.
+func (api *API) localAuthEnabled() bool {
+	return (api.settings.LocalAuth() || api.settings.JWTAuth()) && !api.settings.HasMasters()
+}
+
+// localIdentity authenticates the token (API token or JWT) passed either
+// as the bearer token or as the workspace secret. Requests without a token are anonymous and
+// get nil identity: they pass only where an ACL allows public reading.
+func (api *API) localIdentity(authHeader, secret string) (*auth.Identity, error) {
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" {
+		token = secret
+	}
+	if token == "" {
+		return nil, nil
+	}
+	if api.jwt != nil {
+		return api.jwt.Verify(token)
+	}
+	return api.tokens.Authenticate(token)
+}
+
+// authorizePath checks access of the identity to the resource the request
+// path points to: a dataset, a chunk or a workspace.
+func (api *API) authorizePath(id *auth.Identity, method, path string) error {
+	write := method != http.MethodGet && method != http.MethodHead
+	if hash, ok := pathChunk(path); ok {
+		// Chunk websocket is used only for uploads.
+		write = write || hash == ""
+		return api.tokens.AuthorizeChunk(id, write, hash)
+	}
+	eType, workspace, name := pathEntity(path)
+	if eType != "" && workspace == "" && !write {
+		// The listing of all workspaces is filtered by readable, see
+		// datasets.
+		return nil
+	}
+	return api.tokens.Authorize(id, write, eType, workspace, name)
+}
+
+// readable tells whether the entity may be read by the request identity
+// of the built-in or JWT authentication or by the dealer user if the
+// entity has an ACL.
+func (api *API) readable(req *restful.Request, eType, workspace, name string) bool {
+	if req.Attribute("internal") == "true" {
+		return true
+	}
+	if api.dealerAuth() {
+		decided, err := api.authorizeDealerACL(req, false, eType, workspace, name)
+		return !decided || err == nil
+	}
+	if !api.localAuthEnabled() {
+		return true
+	}
+	id, _ := req.Attribute("identity").(*auth.Identity)
+	return api.tokens.Authorize(id, false, eType, workspace, name) == nil
+}
+
+// CheckChunkAuth checks access to the chunk requested via gRPC.
+func (api *API) CheckChunkAuth(workspace, secret, hash string) (bool, error) {
+	if !api.localAuthEnabled() {
+		return api.CheckAuth(http.MethodGet, "dataset", "", "", "", workspace, secret, nil)
+	}
+	id, err := api.localIdentity("", secret)
+	if err == nil {
+		err = api.tokens.AuthorizeChunk(id, false, hash)
+	}
+	return err == nil, err
+}
+
+func (api *API) listUsers(req *restful.Request, resp *restful.Response) {
+	users, err := api.tokens.ListUsers()
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(types.UserList{Items: users})
+}
+
+func (api *API) createUser(req *restful.Request, resp *restful.Response) {
+	user := new(types.User)
+	if err := req.ReadEntity(user); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+	if err := api.tokens.CreateUser(user); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, user)
+}
+
+func (api *API) deleteUser(req *restful.Request, resp *restful.Response) {
+	if err := api.tokens.DeleteUser(req.PathParameter("user")); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) listTokens(req *restful.Request, resp *restful.Response) {
+	tokens, err := api.tokens.ListTokens(req.QueryParameter("user"))
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(types.TokenList{Items: tokens})
+}
+
+func (api *API) createToken(req *restful.Request, resp *restful.Response) {
+	token := new(types.Token)
+	if err := req.ReadEntity(token); err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, err)
+		return
+	}
+	created, err := api.tokens.CreateToken(token)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, created)
+}
+
+func (api *API) deleteToken(req *restful.Request, resp *restful.Response) {
+	id, err := strconv.ParseUint(req.PathParameter("id"), 10, 32)
+	if err != nil {
+		WriteStatusError(resp, http.StatusBadRequest, fmt.Errorf("Invalid token id: %v", err))
+		return
+	}
+	if err = api.tokens.DeleteToken(uint(id)); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
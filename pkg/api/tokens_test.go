@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+const testInternalKey = "test-internal-key"
+
+// authRequest makes the request with the bearer token or, if the token
+// is empty, with the internal key.
+// setLocalAuth switches the test server to the built-in authentication
+// accepting testInternalKey.
+func setLocalAuth() {
+	testAPI.settings.AuthMode = "local"
+	testAPI.settings.SetAuth("", []string{testInternalKey})
+}
+
+func authRequest(t *testing.T, method, path, token, body string) *http.Response {
+	req, _ := http.NewRequest(method, buildURL(path), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("Internal", testInternalKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func createToken(t *testing.T, body string) types.Token {
+	resp := authRequest(t, http.MethodPost, "admin/tokens", "", body)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	var token types.Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLocalAuth(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	resp, err := client.Get(buildURL("dataset/workspace/dataset/versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodPost, "admin/users", "", `{"name": "alice"}`)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "admin/users", "", `{"name": "alice"}`)
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "admin/tokens", "", `{"user": "alice", "scopes": [{"workspace": "workspace", "access": "admin"}]}`)
+	utils.Assert(http.StatusBadRequest, resp.StatusCode, t)
+
+	writer := createToken(t, `{"user": "alice", "name": "ci", "scopes": [{"workspace": "workspace", "access": "write"}]}`)
+	reader := createToken(t, `{"user": "alice", "scopes": [{"workspace": "other", "access": "read"}, {"workspace": "workspace", "access": "read"}]}`)
+	other := createToken(t, `{"user": "alice", "scopes": [{"workspace": "other", "access": "write"}]}`)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", writer.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", writer.Token, fileData1)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", reader.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file2.txt", reader.Token, fileData2)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", other.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", "pluk_invalid", "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	// gRPC passes the token as the workspace secret.
+	ok, _ := testAPI.CheckAuth(http.MethodGet, "dataset", "", "", "", "workspace", reader.Token, nil)
+	utils.Assert(true, ok, t)
+	ok, _ = testAPI.CheckAuth(http.MethodGet, "dataset", "", "", "", "workspace", "pluk_invalid", nil)
+	utils.Assert(false, ok, t)
+
+	// Only admins manage tokens.
+	resp = authRequest(t, http.MethodGet, "admin/tokens", writer.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "admin/users", "", `{"name": "root", "admin": true}`)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	admin := createToken(t, `{"user": "root", "scopes": []}`)
+	resp = authRequest(t, http.MethodGet, "admin/tokens?user=alice", admin.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var tokens types.TokenList
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(3, len(tokens.Items), t)
+	utils.Assert("ci", tokens.Items[0].Name, t)
+	utils.Assert("", tokens.Items[0].Token, t)
+	utils.Assert([]types.TokenScope{{Workspace: "workspace", Access: "write"}}, tokens.Items[0].Scopes, t)
+
+	// Audit records the user instead of the token fingerprint.
+	records, err := testMgr.ListAuditRecords(db.AuditFilter{AuditRecord: db.AuditRecord{Actor: "[user=alice]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(1, len(records), t)
+	utils.Assert("upload-file", records[0].Action, t)
+
+	// Expired and revoked tokens are rejected.
+	past := time.Now().Add(-time.Minute)
+	testMgr.DB().Model(&db.Token{}).Where("id = ?", reader.ID).Update("expires_at", past)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", reader.Token, "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodDelete, fmt.Sprintf("admin/tokens/%v", writer.ID), admin.Token, "")
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", writer.Token, "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	resp = authRequest(t, http.MethodDelete, "admin/users/alice", admin.Token, "")
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions", other.Token, "")
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+}
+
+func TestLocalAuthCrossEntity(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	if err := testMgr.CreateDataset(&db.Dataset{Workspace: "evil", Name: "mine", Type: "dataset"}); err != nil {
+		t.Fatal(err)
+	}
+	err := testMgr.CreateDatasetVersion(
+		&db.DatasetVersion{Workspace: "evil", Name: "mine", Version: "1.0.0", Editing: true, Type: "dataset"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := authRequest(t, http.MethodPost, "dataset/workspace/dataset/versions/1.0.0/upload/file1.txt", "", fileData1)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "admin/users", "", `{"name": "mallory"}`)
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+	evil := createToken(t, `{"user": "mallory", "scopes": [{"workspace": "evil", "access": "write"}]}`)
+
+	resp = authRequest(t, http.MethodGet, "dataset/workspace/dataset/versions/1.0.0/raw/file1.txt", evil.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+
+	// Neither the copy source nor the fork and move targets may be foreign.
+	resp = authRequest(t, http.MethodPost,
+		"dataset/evil/mine/versions/1.0.0/copy?source_workspace=workspace&source_name=dataset&from=file1.txt&to=file1.txt",
+		evil.Token, "",
+	)
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/evil/mine/fork/workspace?name=stolen", evil.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/evil/mine/move/workspace", evil.Token, "")
+	utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	resp = authRequest(t, http.MethodPost, "dataset/evil/mine/fork/evil?name=copy", evil.Token, "")
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	// Listings of all workspaces show only the scoped ones, other routes
+	// without a workspace are admin only.
+	resp = authRequest(t, http.MethodGet, "dataset", evil.Token, "")
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var list types.DataSetList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(true, len(list.Items) > 0, t)
+	for _, d := range list.Items {
+		utils.Assert("evil", d.Workspace, t)
+	}
+	resp = authRequest(t, http.MethodGet, "dataset", "", "")
+	list = types.DataSetList{}
+	json.NewDecoder(resp.Body).Decode(&list)
+	utils.Assert(3, len(list.Items), t)
+	for _, path := range []string{"websocket/connections", "admin/gc", "admin/clear-chunks"} {
+		resp = authRequest(t, http.MethodGet, path, evil.Token, "")
+		utils.Assert(http.StatusForbidden, resp.StatusCode, t)
+	}
+}
+
+func TestLocalAuthInternalRoutes(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	setLocalAuth()
+
+	url := server.URL + utils.InternalPrefix + "/dataset/workspace/dataset/versions"
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusUnauthorized, resp.StatusCode, t)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Internal", testInternalKey)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+}
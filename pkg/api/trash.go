@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+func (api *API) listTrash(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+
+	items, err := api.ds.Trash(currentType(req), workspace)
+	if err != nil {
+		WriteStatusError(resp, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp.WriteEntity(types.TrashList{Items: items})
+}
+
+func (api *API) restoreDataset(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	master := api.masterClient(req)
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	if err := api.ds.RestoreDataset(currentType(req), workspace, name, master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+	api.invalidateCache(dataset)
+
+	if !getBoolQueryParam(req, "skip_dealer") {
+		// Deleting the entity removes it from the dealer, so register it again.
+		if err = api.createDatasetOnDealer(req, workspace, name, false); err != nil {
+			WriteError(resp, err)
+			return
+		}
+	}
+
+	resp.WriteEntity(dataset)
+}
+
+func (api *API) restoreVersion(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	master := api.masterClient(req)
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	if err = dataset.RestoreVersion(version); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	api.invalidateVersionCache(dataset, version)
+	api.ds.PushMessageVersion(
+		&types.Version{Workspace: workspace, Name: name, DType: currentType(req), Version: version},
+	)
+
+	vs, err := api.findDatasetVersion(dataset, version, true)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(vs)
+}
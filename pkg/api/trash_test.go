@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func listTrash(t *testing.T) types.TrashList {
+	resp, err := client.Get(buildURL("trash/dataset/workspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	var trash types.TrashList
+	if err = json.NewDecoder(resp.Body).Decode(&trash); err != nil {
+		t.Fatal(err)
+	}
+	return trash
+}
+
+func TestTrashRestoreDataset(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	req, _ := http.NewRequest(http.MethodDelete, buildURL("dataset/workspace/dataset"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+
+	trash := listTrash(t)
+	utils.Assert(2, len(trash.Items), t)
+
+	resp, err = client.Post(buildURL("dataset/workspace/dataset/restore"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(0, len(listTrash(t).Items), t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+}
+
+func TestTrashRestoreVersion(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	req, _ := http.NewRequest(http.MethodDelete, buildURL("dataset/workspace/dataset/versions/1.0.0"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+
+	trash := listTrash(t)
+	utils.Assert(1, len(trash.Items), t)
+	utils.Assert("1.0.0", trash.Items[0].Version, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/restore")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	resp, err = client.Get(buildURL("dataset/workspace/dataset/versions/1.0.0/raw/file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(fileData1, mustRead(resp.Body), t)
+
+	// Forced deletion bypasses trash.
+	req, _ = http.NewRequest(http.MethodDelete, buildURL("dataset/workspace/dataset/versions/1.0.0?force=true"), nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNoContent, resp.StatusCode, t)
+	utils.Assert(0, len(listTrash(t).Items), t)
+}
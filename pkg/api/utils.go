@@ -11,14 +11,16 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/json-iterator/go"
 	"github.com/kuberlab/lib/pkg/dealerclient"
 	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/auth"
 	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -26,6 +28,8 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 type LogRecordHandler struct {
 	http.ResponseWriter
 	status int
+	// route is the matched route template used as the metrics label.
+	route string
 }
 
 func (r *LogRecordHandler) WriteHeader(status int) {
@@ -61,6 +65,13 @@ func WrapLogger(f http.Handler) http.Handler {
 			record.status = http.StatusOK
 		}
 
+		route := record.route
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(record.status)).Inc()
+		metrics.Since(metrics.HTTPDuration.WithLabelValues(r.Method, route), t)
+
 		authHeader := r.Header.Get("Authorization")
 		cookie := r.Header.Get("Cookie")
 		secret := r.Header.Get("X-Workspace-Secret")
@@ -180,36 +191,150 @@ func getBoolQueryParam(req *restful.Request, param string) bool {
 	return bVal
 }
 
+// internalRequest tells whether the request is made by a slave: it is
+// signed with one of the internal keys or made with the client certificate
+// of an allowed node. The node name is saved for audit.
+func (api *API) internalRequest(req *restful.Request) bool {
+	if node, ok := utils.NodeIdentity(req.Request.TLS); ok {
+		req.SetAttribute("node", node)
+		return true
+	}
+	return api.settings.IsInternalKey(req.HeaderParameter("Internal"))
+}
+
+// authConfigured tells whether requests are authenticated at all: by any
+// auth mode, via masters or with the internal keys of slaves.
+func (api *API) authConfigured() bool {
+	return api.settings.AuthValidationURL() != "" || api.settings.HasMasters() || api.settings.LocalAuth() || api.settings.JWTAuth() ||
+		api.settings.HasInternalKeys() || len(utils.InternalClientSubjects()) > 0
+}
+
+// InternalHook requires the internal key or the node certificate unless
+// the authentication is not configured at all.
 func (api *API) InternalHook(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
-	masterClient := plukclient.NewInternalMasterClient()
-	req.SetAttribute("masterclient", masterClient)
+	if api.authConfigured() && !api.internalRequest(req) {
+		WriteErrorString(resp, http.StatusUnauthorized, "Internal key or node certificate required.")
+		return
+	}
+	req.SetAttribute("masterclient", api.store.Master)
+
+	filter.ProcessFilter(req, resp)
+}
 
+// AdminHook allows the route only for internal requests of slaves, made by
+// admin users of the built-in or JWT authentication or if the
+// authentication is not configured at all.
+func (api *API) AdminHook(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
+	admin, _ := req.Attribute("admin").(bool)
+	if api.authConfigured() && !admin && !api.internalRequest(req) {
+		WriteErrorString(resp, http.StatusForbidden, "Admin access required.")
+		return
+	}
 	filter.ProcessFilter(req, resp)
 }
 
+func (api *API) requestActor(req *restful.Request) string {
+	if node, ok := req.Attribute("node").(string); ok {
+		return "[node=" + node + "]"
+	}
+	if user, ok := req.Attribute("user").(string); ok && user != "" {
+		return "[user=" + user + "]"
+	}
+	authHeader := req.HeaderParameter("Authorization")
+	cookie := req.HeaderParameter("Cookie")
+	ws := req.HeaderParameter("X-Workspace-Name")
+	secret := req.HeaderParameter("X-Workspace-Secret")
+	if api.dealerAuth() {
+		if ws != "" && secret != "" {
+			return "[workspace=" + ws + "]"
+		}
+		if login := api.dealerLogin(authHeader, cookie); login != "" {
+			return "[user=" + login + "]"
+		}
+	}
+	actor := authInfo(api.cache, authHeader, cookie, ws, secret, req.HeaderParameter("Internal"))
+	if actor == "" {
+		return "[anonymous]"
+	}
+	return actor
+}
+
+// dealerAuth tells whether requests are authenticated by AUTH_VALIDATION.
+func (api *API) dealerAuth() bool {
+	return !api.localAuthEnabled() && !api.settings.HasMasters() && api.settings.AuthValidationURL() != ""
+}
+
+// dealerUser is the user AUTH_VALIDATION responds with.
+type dealerUser struct {
+	Login string `json:"login"`
+}
+
+// dealerLogin returns the login of the user of the token or cookie from
+// AUTH_VALIDATION, empty if it is unknown.
+func (api *API) dealerLogin(authHeader, cookie string) string {
+	if authHeader == "" && cookie == "" {
+		return ""
+	}
+	key := "login-" + authHeader + cookie
+	if login := api.cache.GetString(key); login != "" {
+		return login
+	}
+	request, _ := http.NewRequest("GET", api.settings.AuthValidationURL(), nil)
+	request.Header.Add("Cookie", cookie)
+	request.Header.Add("Authorization", authHeader)
+	r, err := api.client.Do(request)
+	if err != nil {
+		logrus.Errorf("Get user from %v: %v", request.URL.Host, err)
+		return ""
+	}
+	defer r.Body.Close()
+	user := &dealerUser{}
+	if r.StatusCode >= 400 || json.NewDecoder(r.Body).Decode(user) != nil {
+		return ""
+	}
+	api.cache.SetString(key, user.Login)
+	return user.Login
+}
+
 const checkWorkspace = "check-for-auth-workspace"
 
+// masterPermissionTTL is how long slaves cache permissions the master granted.
+const masterPermissionTTL = time.Minute
+
 func (api *API) CheckAuth(method, entityType, authHeader,
 	requestWorkspace, cookie, ws, secret string, masterClient io.PlukClient) (bool, error) {
 	key := authHeader + requestWorkspace + cookie + ws + secret
 
-	authURL := utils.AuthValidationURL()
-	if authURL == "" && !utils.HasMasters() {
+	if api.localAuthEnabled() {
+		id, err := api.localIdentity(authHeader, secret)
+		if err == nil {
+			write := method != http.MethodGet && method != http.MethodHead
+			workspace := requestWorkspace
+			if workspace == "" {
+				workspace = ws
+			}
+			err = api.tokens.Authorize(id, write, entityType, workspace, "")
+		}
+		return err == nil, err
+	}
+
+	authURL := api.settings.AuthValidationURL()
+	if authURL == "" && !api.settings.HasMasters() {
 		return true, nil
 	}
 
 	if api.cache.Get(key) {
 		return true, nil
 	} else {
-		if utils.HasMasters() {
+		if api.settings.HasMasters() {
 			// Talk to master.
-			logrus.Debugf("Auth request to master %v", utils.Masters()[0])
+			logrus.Debugf("Auth request to master %v", api.settings.Masters()[0])
 			ws := requestWorkspace
 			if ws == "" {
 				ws = "kuberlab"
 			}
 			if masterClient == nil && ws != "" && secret != "" {
-				masterClient = plukclient.NewMasterClientWithSecret(ws, secret)
+				masterClient = plukclient.NewMasterClientWithSecret(api.settings.Masters(), ws, secret)
 			}
 			_, err := masterClient.ListEntities(entityType, ws)
 			if err != nil {
@@ -335,15 +460,13 @@ func (api *API) CheckAuth(method, entityType, authHeader,
 }
 
 func (api *API) AuthHook(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
-	internal := req.HeaderParameter("Internal")
-	if internal != "" && utils.InternalKey() == internal {
-		req.SetAttribute("internal", "true")
-		filter.ProcessFilter(req, resp)
+	if req.QueryParameter(auth.SignatureParam) != "" {
+		api.signedURLHook(req, resp, filter)
 		return
 	}
 
-	authURL := utils.AuthValidationURL()
-	if authURL == "" && !utils.HasMasters() {
+	if api.internalRequest(req) {
+		req.SetAttribute("internal", "true")
 		filter.ProcessFilter(req, resp)
 		return
 	}
@@ -352,20 +475,60 @@ func (api *API) AuthHook(req *restful.Request, resp *restful.Response, filter *r
 	cookie := req.HeaderParameter("Cookie")
 	secret := req.HeaderParameter("X-Workspace-Secret")
 	ws := req.HeaderParameter("X-Workspace-Name")
+	requestWorkspace := pathWorkspace(req.Request.URL.Path)
 
-	// /pluk/v1/entity-type/workspace/
-	splitted := strings.Split(req.Request.URL.Path, "/")
-	var requestWorkspace string
-	if len(splitted) >= 5 {
-		if splitted[3] == "workspaces" {
-			requestWorkspace = splitted[4]
-		} else if _, ok := plukclient.AllowedTypes[splitted[3]]; ok {
-			requestWorkspace = splitted[4]
+	if api.localAuthEnabled() {
+		id, err := api.localIdentity(authHeader, secret)
+		if err == nil {
+			err = api.authorizePath(id, req.Request.Method, req.Request.URL.Path)
+		}
+		if err != nil {
+			WriteError(resp, err)
+			return
 		}
+		if id != nil {
+			req.SetAttribute("user", id.User)
+			req.SetAttribute("admin", id.Admin)
+			req.SetAttribute("identity", id)
+		}
+		filter.ProcessFilter(req, resp)
+		return
 	}
 
-	masterClient := plukclient.NewMasterClientFromHeaders(req.Request.Header)
-	req.SetAttribute("masterclient", masterClient)
+	authURL := api.settings.AuthValidationURL()
+	if authURL == "" && !api.settings.HasMasters() {
+		filter.ProcessFilter(req, resp)
+		return
+	}
+
+	var masterClient io.PlukClient
+	if api.settings.HasMasters() {
+		masterClient = plukclient.NewMasterClientFromHeaders(api.settings.Masters(), req.Request.Header)
+		req.SetAttribute("masterclient", masterClient)
+	}
+
+	write := req.Request.Method != http.MethodGet && req.Request.Method != http.MethodHead
+	eType, workspace, name := pathEntity(req.Request.URL.Path)
+	if api.settings.HasMasters() && workspace != "" && name != "" {
+		// Only the master knows ACLs of the dataset.
+		key := authHeader + cookie + ws + secret
+		if err := api.checkMasterPermission(key, write, eType, workspace, name, masterClient); err != nil {
+			WriteError(resp, err)
+			return
+		}
+		filter.ProcessFilter(req, resp)
+		return
+	}
+	if api.dealerAuth() {
+		if decided, err := api.authorizeDealerACL(req, write, eType, workspace, name); decided {
+			if err != nil {
+				WriteError(resp, err)
+				return
+			}
+			filter.ProcessFilter(req, resp)
+			return
+		}
+	}
 
 	_, err := api.CheckAuth(
 		req.Request.Method,
@@ -384,6 +547,105 @@ func (api *API) AuthHook(req *restful.Request, resp *restful.Response, filter *r
 	filter.ProcessFilter(req, resp)
 }
 
+// checkMasterPermission asks the master whether the credentials (key) allow
+// access to the dataset. Allowed requests are cached for a short time, so
+// changes of ACLs on the master apply soon. As in CheckAuth, credentials
+// allowed earlier pass while the master is unreachable.
+func (api *API) checkMasterPermission(key string, write bool, eType, workspace, name string, master io.PlukClient) error {
+	key = fmt.Sprintf("permission-%v-%v/%v/%v-%v", key, eType, workspace, name, write)
+	if api.cache.Get(key) {
+		return nil
+	}
+	if _, err := master.CheckEntityPermission(eType, workspace, name, write); err != nil {
+		if strings.Contains(err.Error(), ": dial tcp") && strings.Contains(err.Error(), ": connect:") {
+			if _, dbErr := api.mgr.GetAuth(key); dbErr == nil {
+				return nil
+			}
+			return err
+		}
+		if _, ok := err.(*errors.Error); ok {
+			return err
+		}
+		return errors.NewStatus(http.StatusUnauthorized, err.Error())
+	}
+	api.cache.Cache.Set(key, true, masterPermissionTTL)
+	if err := api.mgr.CreateAuth(key); err != nil {
+		logrus.Warning(err)
+	}
+	return nil
+}
+
+// pathWorkspace returns the workspace the request path belongs to,
+// e.g. /pluk/v1/entity-type/workspace/...
+func pathWorkspace(path string) string {
+	splitted := strings.Split(path, "/")
+	if len(splitted) < 5 {
+		return ""
+	}
+	if splitted[3] == "workspaces" {
+		return splitted[4]
+	} else if (splitted[3] == "trash" || splitted[3] == "acl") && len(splitted) >= 6 {
+		return splitted[5]
+	} else if splitted[3] == "jobs" || splitted[3] == "usage" || splitted[3] == "quotas" {
+		return splitted[4]
+	} else if _, ok := plukclient.AllowedTypes[splitted[3]]; ok {
+		return splitted[4]
+	}
+	return ""
+}
+
+// pathEntity returns the entity type, workspace and name the request path
+// belongs to, e.g. /pluk/v1/entity-type/workspace/name/... or
+// /pluk/v1/workspaces/workspace/entity-type/name/...
+func pathEntity(path string) (eType, workspace, name string) {
+	workspace = pathWorkspace(path)
+	splitted := strings.Split(path, "/")
+	if len(splitted) < 4 {
+		return
+	}
+	if (splitted[3] == "trash" || splitted[3] == "acl") && len(splitted) >= 5 {
+		eType = splitted[4]
+	} else if splitted[3] == "workspaces" && len(splitted) >= 7 {
+		// /pluk/v1/workspaces/workspace/entity-type/name/...
+		if _, ok := plukclient.AllowedTypes[splitted[5]]; ok {
+			eType, name = splitted[5], splitted[6]
+		}
+	} else if _, ok := plukclient.AllowedTypes[splitted[3]]; ok {
+		eType = splitted[3]
+		if len(splitted) >= 6 {
+			name = splitted[5]
+		}
+	}
+	return
+}
+
+// pathChunk returns the chunk hash if the request path is a chunk one.
+func pathChunk(path string) (string, bool) {
+	splitted := strings.Split(path, "/")
+	if len(splitted) < 4 {
+		return "", false
+	}
+	if splitted[3] == "websocket-chunks" {
+		return "", true
+	}
+	if splitted[3] == "chunks" && len(splitted) >= 5 {
+		return splitted[4], true
+	}
+	return "", false
+}
+
+// recordRoute passes the matched route to WrapLogger.
+func recordRoute(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
+	setRoute(resp.ResponseWriter, req.SelectedRoutePath())
+	filter.ProcessFilter(req, resp)
+}
+
+func setRoute(w http.ResponseWriter, route string) {
+	if record, ok := w.(*LogRecordHandler); ok {
+		record.route = route
+	}
+}
+
 func setCurrentType(req *restful.Request, resp *restful.Response, filter *restful.FilterChain) {
 	eType, ok := req.PathParameters()["entityType"]
 	if !ok {
@@ -411,10 +673,10 @@ func currentType(req *restful.Request) string {
 	return sType
 }
 
-func acquireConcurrency() {
-	utils.AcqureSem(1)
+func (api *API) acquireConcurrency() {
+	api.store.Acquire()
 }
 
-func releaseConcurrency() {
-	utils.ReleaseSem(1)
+func (api *API) releaseConcurrency() {
+	api.store.Release()
 }
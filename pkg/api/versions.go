@@ -1,17 +1,19 @@
 package api
 
 import (
+	"context"
 	"fmt"
-	plukio "github.com/kuberlab/pluk/pkg/io"
 	"net/http"
 
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/dealerclient"
 	"github.com/kuberlab/pluk/pkg/datasets"
 	"github.com/kuberlab/pluk/pkg/db"
-	"github.com/kuberlab/pluk/pkg/gc"
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/jobs"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func (api *API) versions(req *restful.Request, resp *restful.Response) {
@@ -74,9 +76,9 @@ func (api *API) createVersion(req *restful.Request, resp *restful.Response) {
 	master := api.masterClient(req)
 
 	// Wait
-	acquireConcurrency()
-	defer releaseConcurrency()
-	gc.WaitGCCompleted()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+	api.gc.Wait()
 
 	dataset, _ := api.ds.GetDataset(currentType(req), workspace, name, master)
 	if dataset == nil {
@@ -105,8 +107,9 @@ func (api *API) createVersion(req *restful.Request, resp *restful.Response) {
 			WriteStatusError(
 				resp,
 				http.StatusConflict,
-				fmt.Errorf("Version %v for %v %v/%v already exists", currentType(req), version, workspace, name),
+				fmt.Errorf("Version %v for %v %v/%v already exists", version, currentType(req), workspace, name),
 			)
+			return
 		}
 	}
 
@@ -119,7 +122,7 @@ func (api *API) createVersion(req *restful.Request, resp *restful.Response) {
 		Type:      currentType(req),
 	}
 
-	if err := datasets.SaveDatasetVersion(api.mgr, dsv); err != nil {
+	if err := datasets.SaveDatasetVersion(api.mgr, api.store, dsv); err != nil {
 		WriteError(resp, err)
 		return
 	}
@@ -153,8 +156,8 @@ func (api *API) deleteVersion(req *restful.Request, resp *restful.Response) {
 		master = api.masterClient(req)
 	}
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
 	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
 	if err != nil {
@@ -162,7 +165,7 @@ func (api *API) deleteVersion(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	err = dataset.DeleteVersion(version, true)
+	err = dataset.DeleteVersion(version, getBoolQueryParam(req, "force"))
 	if err != nil {
 		WriteStatusError(resp, http.StatusInternalServerError, err)
 		return
@@ -185,9 +188,6 @@ func (api *API) cloneVersion(req *restful.Request, resp *restful.Response) {
 	message := req.QueryParameter("message")
 	master := api.masterClient(req)
 
-	acquireConcurrency()
-	defer releaseConcurrency()
-
 	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
 	if err != nil {
 		WriteError(resp, EntityNotFoundError(req, name, err))
@@ -198,19 +198,30 @@ func (api *API) cloneVersion(req *restful.Request, resp *restful.Response) {
 		WriteStatusError(resp, http.StatusBadRequest, err)
 		return
 	}
-	api.invalidateVersionCache(dataset, targetVersion)
 
-	dsv, err := dataset.CloneVersion(version, targetVersion, message)
-	if err != nil {
-		WriteStatusError(resp, http.StatusInternalServerError, err)
-		return
+	record := &db.Job{
+		Type:       jobs.TypeClone,
+		Workspace:  workspace,
+		Name:       name,
+		EntityType: currentType(req),
+		Target:     fmt.Sprintf("%v -> %v", version, targetVersion),
 	}
+	clone := func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		api.acquireConcurrency()
+		defer api.releaseConcurrency()
 
-	api.ds.PushMessageVersion(
-		&types.Version{Workspace: workspace, Name: name, DType: currentType(req), Version: version},
-	)
+		api.invalidateVersionCache(dataset, targetVersion)
+		dsv, err := dataset.CloneVersion(version, targetVersion, message)
+		if err != nil {
+			return nil, err
+		}
 
-	resp.WriteHeaderAndEntity(http.StatusCreated, dsv)
+		api.ds.PushMessageVersion(
+			&types.Version{Workspace: workspace, Name: name, DType: currentType(req), Version: version},
+		)
+		return dsv, nil
+	}
+	api.submitJob(resp, record, false, getBoolQueryParam(req, "async"), http.StatusCreated, clone)
 }
 
 func (api *API) commitVersion(req *restful.Request, resp *restful.Response) {
@@ -220,8 +231,8 @@ func (api *API) commitVersion(req *restful.Request, resp *restful.Response) {
 	message := req.QueryParameter("message")
 	master := api.masterClient(req)
 
-	acquireConcurrency()
-	defer releaseConcurrency()
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
 
 	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
 	if err != nil {
@@ -252,3 +263,62 @@ func (api *API) commitVersion(req *restful.Request, resp *restful.Response) {
 
 	resp.WriteEntity(dsv)
 }
+
+func (api *API) reopenVersion(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	master := api.masterClient(req)
+
+	api.acquireConcurrency()
+	defer api.releaseConcurrency()
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	// Admin operation is forwarded to master on behalf of this instance.
+	if err = dataset.ReopenVersion(version, api.store.Master); err != nil {
+		WriteError(resp, err)
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"audit": "reopen-version",
+		"actor": api.requestActor(req),
+	}).Warnf("Reopened committed %v %v/%v:%v", dataset.Type, workspace, name, version)
+
+	api.invalidateVersionCache(dataset, version)
+	api.ds.PushMessageVersion(
+		&types.Version{Workspace: workspace, Name: name, DType: currentType(req), Version: version},
+	)
+
+	vs, err := api.findDatasetVersion(dataset, version, true)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+	resp.WriteEntity(vs)
+}
+
+func (api *API) getManifestSignature(req *restful.Request, resp *restful.Response) {
+	workspace := req.PathParameter("workspace")
+	name := req.PathParameter("name")
+	version := req.PathParameter("version")
+	master := api.masterClient(req)
+
+	dataset, err := api.ds.GetDataset(currentType(req), workspace, name, master)
+	if err != nil {
+		WriteError(resp, EntityNotFoundError(req, name, err))
+		return
+	}
+
+	sig, err := dataset.ManifestSignature(version)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
+
+	resp.WriteEntity(sig)
+}
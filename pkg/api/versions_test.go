@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/utils"
 )
 
@@ -82,3 +83,104 @@ func TestCloneManyFiles(t *testing.T) {
 		utils.Assert(fmt.Sprintf("test%v test%v", i, i), data, t)
 	}
 }
+
+func TestCommittedVersionReadOnly(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	url := buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file1.txt")
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(fileData1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/clone/1.0.1")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+
+	for _, v := range []string{"1.0.0", "1.0.1"} {
+		url = buildURL(fmt.Sprintf("dataset/workspace/dataset/versions/%v/commit", v))
+		resp, err = client.Post(url, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.Assert(http.StatusOK, resp.StatusCode, t)
+	}
+
+	// Save file structure
+	url = buildURL("dataset/workspace/dataset/1.0.0")
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(`{"files": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+
+	// Clone into committed version
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/clone/1.0.1")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+
+	// Create existing version
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusConflict, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/reopen")
+	resp, err = client.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	url = buildURL("dataset/workspace/dataset/versions/1.0.0/upload/file2.txt")
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(fileData2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusCreated, resp.StatusCode, t)
+}
+
+func TestSlaveReopenMasterFails(t *testing.T) {
+	fname := getFname()
+	setup(fname)
+	dbPrepare(t)
+	defer teardown(fname)
+
+	resp, err := client.Post(buildURL("dataset/workspace/dataset/versions/1.0.0/commit"), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+
+	// The master doesn't have the version, so the local one stays committed.
+	master, closeMaster := startMaster(t)
+	defer closeMaster()
+	testAPI.settings.MasterURLs = []string{master.URL}
+	testAPI.settings.SetAuth("", []string{testInternalKey})
+	testAPI.store.Master = plukclient.NewInternalMasterClient(testAPI.settings)
+
+	req, _ := http.NewRequest(http.MethodPost, buildURL("dataset/workspace/dataset/versions/1.0.0/reopen"), nil)
+	req.Header.Set("Internal", testInternalKey)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(http.StatusNotFound, resp.StatusCode, t)
+	dsv, err := testMgr.GetDatasetVersion("dataset", "workspace", "dataset", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(false, dsv.Editing, t)
+}
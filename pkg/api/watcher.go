@@ -1,22 +1,22 @@
 package api
 
 import (
-	"crypto/tls"
 	jsonStd "encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/gorilla/websocket"
 	libtypes "github.com/kuberlab/lib/pkg/types"
 	"github.com/kuberlab/pluk/pkg/datasets"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -39,27 +39,69 @@ type Watcher struct {
 	queue        chan *libtypes.Message
 	lastMessages []libtypes.Message
 	getLast      chan *Req
+
+	lock sync.Mutex
+	done chan struct{}
 }
 
 func (api *API) StartWatcher() {
 	// Start watcher for masters
-	if len(utils.Masters()) > 0 {
+	if len(api.settings.Masters()) > 0 {
 		api.watcher = &Watcher{
-			master:  utils.Masters()[0],
+			master:  api.settings.Masters()[0],
 			mode:    "connect",
 			queue:   make(chan *libtypes.Message, 10),
 			api:     api,
 			getLast: make(chan *Req, 2),
+			done:    make(chan struct{}),
 		}
 		go api.watcher.runWatcher()
 		go api.watcher.processQueue()
 	}
 }
 
+// close stops the watcher and closes the connection to the master.
+func (w *Watcher) close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	close(w.done)
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
+
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// status returns the connection mode and the reconnect attempt.
+func (w *Watcher) status() (mode string, attempt int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.mode, w.attempt
+}
+
+func (w *Watcher) setMode(mode string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.mode = mode
+}
+
 func (w *Watcher) runWatcher() {
 	logrus.Info("Starting gc watcher...")
-	for {
-		switch w.mode {
+	for !w.closed() {
+		mode, _ := w.status()
+		switch mode {
 		case connect:
 			// Connect
 			w.continuousConnect()
@@ -76,7 +118,7 @@ func (w *Watcher) continuousConnect() {
 		err := w.connect()
 		if err == nil {
 			// Now receive
-			w.mode = receive
+			w.setMode(receive)
 			return
 		}
 
@@ -86,8 +128,14 @@ func (w *Watcher) continuousConnect() {
 			toSleep = sleepLimit
 		}
 		logrus.Warnf("[Watcher] %v; reconnect in %vs", err, toSleep)
-		time.Sleep(time.Second * time.Duration(toSleep))
+		select {
+		case <-w.done:
+			return
+		case <-time.After(time.Second * time.Duration(toSleep)):
+		}
+		w.lock.Lock()
 		w.attempt++
+		w.lock.Unlock()
 	}
 }
 
@@ -107,10 +155,7 @@ func (w *Watcher) connect() error {
 	case "http":
 		scheme = "ws"
 	case "https":
-		tlsConf := &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		dialer.TLSClientConfig = tlsConf
+		dialer.TLSClientConfig = utils.NodeTLSConfig()
 		scheme = "wss"
 	}
 	urlStr := fmt.Sprintf("%v://%v/%v", scheme, base.Host, strings.TrimPrefix(base.Path, "/"))
@@ -118,7 +163,7 @@ func (w *Watcher) connect() error {
 
 	//urlStr := strings.TrimSuffix(w.master, "/") + "/websocket"
 	headers := http.Header{}
-	headers.Set("Internal", utils.InternalKey())
+	headers.Set("Internal", w.api.settings.InternalKey())
 	conn, resp, err := dialer.Dial(urlStr, headers)
 	if err != nil {
 		return fmt.Errorf("Failed to connect: %v", err.Error())
@@ -128,6 +173,12 @@ func (w *Watcher) connect() error {
 		return fmt.Errorf("Failed to connect: %v", string(msg))
 	}
 
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed() {
+		conn.Close()
+		return nil
+	}
 	logrus.Infof("[Watcher] Established connection to %v.", urlStr)
 	w.conn = conn
 	w.attempt = 0
@@ -136,12 +187,13 @@ func (w *Watcher) connect() error {
 
 func (w *Watcher) pinger() {
 	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
 	for range ticker.C {
-		if w.mode == receive {
+		if mode, _ := w.status(); mode == receive && !w.closed() {
 			err := w.conn.WriteMessage(websocket.TextMessage, []byte("ping"))
 			if err != nil {
 				logrus.Errorf("Error during ping: %v", err)
-				w.mode = connect
+				w.setMode(connect)
 				return
 			}
 		} else {
@@ -159,13 +211,20 @@ func (w *Watcher) continuousReceive() {
 				// Probably "pong" sent, receive again
 				continue
 			}
+			if w.closed() {
+				return
+			}
 			logrus.Errorf("[Watcher] Receive: %v", err)
 			// Now connect
-			w.mode = connect
+			w.setMode(connect)
 			return
 		}
 		logrus.Debugf("[Watcher] Received message: %v", *msg)
-		w.queue <- msg
+		select {
+		case w.queue <- msg:
+		case <-w.done:
+			return
+		}
 	}
 }
 
@@ -187,6 +246,8 @@ func (w *Watcher) processQueue() {
 
 	for {
 		select {
+		case <-w.done:
+			return
 		case req := <-w.getLast:
 			req.Messages <- w.lastMessages
 		case m := <-w.queue:
@@ -202,7 +263,7 @@ func (w *Watcher) processQueue() {
 					logrus.Error(err)
 					break
 				}
-				acquireConcurrency()
+				w.api.acquireConcurrency()
 
 				// Delete dataset
 				logrus.Infof("[Watcher] Delete %v %v/%v", ds.DType, ds.Workspace, ds.Name)
@@ -214,7 +275,7 @@ func (w *Watcher) processQueue() {
 						Workspace: ds.Workspace,
 					},
 				})
-				releaseConcurrency()
+				w.api.releaseConcurrency()
 			case "dataset_version":
 				dsv := &types.Version{}
 				err := utils.LoadAsJson(m.Content.(map[string]interface{}), dsv)
@@ -222,7 +283,7 @@ func (w *Watcher) processQueue() {
 					logrus.Error(err)
 					break
 				}
-				acquireConcurrency()
+				w.api.acquireConcurrency()
 
 				// Delete version
 				logrus.Infof("[Watcher] Delete %v version %v/%v:%v", dsv.DType, dsv.Workspace, dsv.Name, dsv.Version)
@@ -236,18 +297,18 @@ func (w *Watcher) processQueue() {
 				w.api.invalidateVersionCache(ds, dsv.Version)
 				dataset, err := w.api.ds.GetDataset(dsv.DType, dsv.Workspace, dsv.Name, nil)
 				if err != nil {
-					releaseConcurrency()
+					w.api.releaseConcurrency()
 					logrus.Errorf("[Watcher] %v %v/%v not found: %v", dsv.DType, dsv.Workspace, dsv.Name, err)
 					return
 				}
 
 				err = dataset.DeleteVersion(dsv.Version, true)
 				if err != nil {
-					releaseConcurrency()
+					w.api.releaseConcurrency()
 					logrus.Errorf("[Watcher] %v", err)
 					return
 				}
-				releaseConcurrency()
+				w.api.releaseConcurrency()
 				//default:
 				//	logrus.Errorf("Unrecognized message type: %v", m.Type)
 			}
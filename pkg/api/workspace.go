@@ -12,23 +12,23 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/dealerclient"
 	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/auth"
 	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/types"
-	"github.com/kuberlab/pluk/pkg/utils"
 )
 
 func (api *API) checkWorkspace(req *restful.Request, resp *restful.Response) {
 	workspace := req.PathParameter("workspace")
 
-	u := utils.AuthValidationURL()
-	if (u == "" && !utils.HasMasters()) || req.Attribute("internal") == "true" {
+	u := api.settings.AuthValidationURL()
+	if (u == "" && !api.settings.HasMasters()) || req.Attribute("internal") == "true" {
 		resp.WriteEntity(&types.Workspace{Name: workspace})
 		return
 	}
 
-	if u == "" && utils.HasMasters() {
+	if u == "" && api.settings.HasMasters() {
 		// Request master.
-		masters := plukclient.NewMasterClientFromHeaders(req.Request.Header)
+		masters := plukclient.NewMasterClientFromHeaders(api.settings.Masters(), req.Request.Header)
 		ws, err := masters.CheckWorkspace(workspace)
 		if err != nil {
 			WriteError(resp, err)
@@ -58,26 +58,46 @@ func (api *API) checkEntityAccess(req *restful.Request, write bool) (*types.Data
 	if name == "" {
 		name = req.PathParameter("name")
 	}
+	return api.checkEntityAccessFor(req, currentType(req), workspace, name, write)
+}
+
+// checkEntityAccessFor checks access to the entity which is not necessarily
+// the one from the request path.
+func (api *API) checkEntityAccessFor(req *restful.Request, eType, workspace, name string, write bool) (*types.Dataset, error) {
+	allowed := &types.Dataset{Name: name, Workspace: workspace, DType: eType}
+	if req.Attribute("internal") == "true" {
+		return allowed, nil
+	}
+	if api.localAuthEnabled() {
+		id, _ := req.Attribute("identity").(*auth.Identity)
+		if err := api.tokens.Authorize(id, write, eType, workspace, name); err != nil {
+			return nil, err
+		}
+		return allowed, nil
+	}
 
-	u := utils.AuthValidationURL()
-	if (u == "" && !utils.HasMasters()) || req.Attribute("internal") == "true" {
-		return &types.Dataset{
-			Name:      name,
-			Workspace: workspace,
-			DType:     currentType(req),
-		}, nil
+	u := api.settings.AuthValidationURL()
+	if u == "" && !api.settings.HasMasters() {
+		return allowed, nil
 	}
 
-	if u == "" && utils.HasMasters() {
+	if u == "" && api.settings.HasMasters() {
 		// Request master.
-		masters := plukclient.NewMasterClientFromHeaders(req.Request.Header)
-		ds, err := masters.CheckEntityPermission(currentType(req), workspace, name, write)
+		masters := plukclient.NewMasterClientFromHeaders(api.settings.Masters(), req.Request.Header)
+		ds, err := masters.CheckEntityPermission(eType, workspace, name, write)
 		if err != nil {
 			return nil, err
 		}
 		return ds, nil
 	}
 
+	if decided, err := api.authorizeDealerACL(req, write, eType, workspace, name); decided {
+		if err != nil {
+			return nil, err
+		}
+		return allowed, nil
+	}
+
 	dealer, err := api.dealerClient(req)
 	if err != nil {
 		return nil, err
@@ -88,8 +108,8 @@ func (api *API) checkEntityAccess(req *restful.Request, write bool) (*types.Data
 		return nil, err
 	}
 
-	var entityName = currentType(req)
-	if currentType(req) == "model" {
+	var entityName = eType
+	if eType == "model" {
 		entityName = "mlmodel"
 	}
 
@@ -103,11 +123,11 @@ func (api *API) checkEntityAccess(req *restful.Request, write bool) (*types.Data
 
 	if strings.Contains(strings.Join(ws.Can, " "), neededPerm) {
 		// Found needed permission
-		return &types.Dataset{Name: name, Workspace: workspace, DType: currentType(req)}, nil
+		return &types.Dataset{Name: name, Workspace: workspace, DType: eType}, nil
 	} else {
 		// If read, then check if item exists.
 		if !write {
-			switch currentType(req) {
+			switch eType {
 			case "model":
 				_, err = dealer.GetModel(workspace, name)
 			case "dataset":
@@ -116,12 +136,12 @@ func (api *API) checkEntityAccess(req *restful.Request, write bool) (*types.Data
 			if err != nil {
 				return nil, err
 			} else {
-				return &types.Dataset{Name: name, Workspace: workspace, DType: currentType(req)}, nil
+				return &types.Dataset{Name: name, Workspace: workspace, DType: eType}, nil
 			}
 		}
 		return nil, errors.NewStatus(
 			http.StatusForbidden,
-			fmt.Sprintf("Failed to %v %v", modificator, currentType(req)),
+			fmt.Sprintf("Failed to %v %v", modificator, eType),
 		)
 	}
 }
@@ -158,8 +178,8 @@ func (api *API) checkDatasetPermission(req *restful.Request, resp *restful.Respo
 }
 
 func (api *API) checkEntityExists(req *restful.Request, ws, name string) error {
-	u := utils.AuthValidationURL()
-	if u == "" && !utils.HasMasters() {
+	u := api.settings.AuthValidationURL()
+	if u == "" && !api.settings.HasMasters() {
 		return nil
 	}
 
@@ -167,9 +187,9 @@ func (api *API) checkEntityExists(req *restful.Request, ws, name string) error {
 		return nil
 	}
 
-	if u == "" && utils.HasMasters() {
+	if u == "" && api.settings.HasMasters() {
 		// Request master.
-		masters := plukclient.NewMasterClientFromHeaders(req.Request.Header)
+		masters := plukclient.NewMasterClientFromHeaders(api.settings.Masters(), req.Request.Header)
 		_, err := masters.CheckEntityExists(currentType(req), ws, name)
 		return err
 	}
@@ -192,14 +212,14 @@ func (api *API) checkEntityExists(req *restful.Request, ws, name string) error {
 }
 
 func (api *API) postSpecToDealer(req *restful.Request, ws, name, version string, spec interface{}) error {
-	u := utils.AuthValidationURL()
-	if u == "" && !utils.HasMasters() {
+	u := api.settings.AuthValidationURL()
+	if u == "" && !api.settings.HasMasters() {
 		return nil
 	}
 
-	if u == "" && utils.HasMasters() {
+	if u == "" && api.settings.HasMasters() {
 		// Request master.
-		masters := plukclient.NewMasterClientFromHeaders(req.Request.Header)
+		masters := plukclient.NewMasterClientFromHeaders(api.settings.Masters(), req.Request.Header)
 		var err error
 		if version != "" {
 			err = masters.PostEntitySpecForVersion(currentType(req), ws, name, version, spec)
@@ -2,17 +2,17 @@ package api
 
 import (
 	"bytes"
-	plukio "github.com/kuberlab/pluk/pkg/io"
-	"github.com/kuberlab/pluk/pkg/utils"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/gorilla/websocket"
+	"github.com/kuberlab/lib/pkg/errors"
 	libtypes "github.com/kuberlab/lib/pkg/types"
 	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -26,6 +26,11 @@ var (
 )
 
 func (api API) websocket(req *restful.Request, resp *restful.Response) {
+	workspace, err := api.uploadWorkspace(req)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
 	ws, err := upgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); ok {
@@ -40,10 +45,16 @@ func (api API) websocket(req *restful.Request, resp *restful.Response) {
 	wsClient := types.NewWebsocketClient(ws, id, ip)
 
 	api.hub.Register(wsClient)
-	api.wsReader(wsClient)
+	api.wsReader(wsClient, workspace)
 }
 
 func (api API) websocketChunks(req *restful.Request, resp *restful.Response) {
+	// Chunks of the connection are accounted to one workspace.
+	workspace, err := api.uploadWorkspace(req)
+	if err != nil {
+		WriteError(resp, err)
+		return
+	}
 	ws, err := upgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); ok {
@@ -58,7 +69,17 @@ func (api API) websocketChunks(req *restful.Request, resp *restful.Response) {
 	wsClient := types.NewWebsocketClient(ws, id, ip)
 
 	//api.hub.Register(wsClient)
-	api.wsReader(wsClient)
+	api.wsReader(wsClient, workspace)
+}
+
+// writeWsError reports the failure to the client before the connection is closed,
+// the client gets it on the next read.
+func writeWsError(client *types.WebsocketClient, err error) {
+	e, ok := err.(*errors.Error)
+	if !ok {
+		e = errors.NewStatus(http.StatusInternalServerError, err.Error())
+	}
+	_ = client.WriteMessage("error", e)
 }
 
 func (api *API) wsConnections(req *restful.Request, resp *restful.Response) {
@@ -77,7 +98,26 @@ func (api *API) lastReceivedMessages(req *restful.Request, resp *restful.Respons
 	resp.WriteEntity(messages)
 }
 
-func (api *API) wsReaderChunks(client *types.WebsocketClient) {
+// saveWsChunk saves the chunk received via websocket. Like chunks uploaded
+// with POST, a new chunk is checked against the quota of the workspace.
+func (api *API) saveWsChunk(workspace string, chunk types.ChunkData) error {
+	_, exists := api.store.CheckLocalChunk(chunk.Hash, 2)
+	if !exists {
+		if err := api.ds.CheckQuota(workspace, int64(len(chunk.Data))); err != nil {
+			return err
+		}
+	}
+	written, err := api.store.SaveChunk(chunk.Hash, 2, ioutil.NopCloser(bytes.NewReader(chunk.Data)), true)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		api.ds.AddUpload(workspace, written)
+	}
+	return nil
+}
+
+func (api *API) wsReaderChunks(client *types.WebsocketClient, workspace string) {
 	defer client.Ws.Close()
 	//defer api.hub.Drop(client)
 	client.Ws.SetReadLimit(0) // No limit.
@@ -114,14 +154,9 @@ func (api *API) wsReaderChunks(client *types.WebsocketClient) {
 				return
 			}
 
-			_, err := plukio.SaveChunk(
-				chunk.Hash,
-				2,
-				ioutil.NopCloser(bytes.NewReader(chunk.Data)),
-				true,
-			)
-			if err != nil {
+			if err := api.saveWsChunk(workspace, chunk); err != nil {
 				logrus.Error(err)
+				writeWsError(client, err)
 				return
 			}
 		case "chunkCheck":
@@ -131,7 +166,7 @@ func (api *API) wsReaderChunks(client *types.WebsocketClient) {
 				logrus.Error(err)
 				return
 			}
-			size, exists := plukio.CheckLocalChunk(check.Hash, 2)
+			size, exists := api.store.CheckLocalChunk(check.Hash, 2)
 			check.Exists = exists
 			check.Size = size
 			if err := client.WriteMessage(check.Type(), check); err != nil {
@@ -142,7 +177,7 @@ func (api *API) wsReaderChunks(client *types.WebsocketClient) {
 	}
 }
 
-func (api *API) wsReader(client *types.WebsocketClient) {
+func (api *API) wsReader(client *types.WebsocketClient, workspace string) {
 	defer client.Ws.Close()
 	defer api.hub.Drop(client)
 	client.Ws.SetReadLimit(0) // No limit.
@@ -188,14 +223,9 @@ func (api *API) wsReader(client *types.WebsocketClient) {
 				return
 			}
 
-			_, err = plukio.SaveChunk(
-				chunk.Hash,
-				2,
-				ioutil.NopCloser(bytes.NewReader(chunk.Data)),
-				true,
-			)
-			if err != nil {
+			if err = api.saveWsChunk(workspace, chunk); err != nil {
 				logrus.Error(err)
+				writeWsError(client, err)
 				return
 			}
 		case "chunkCheck":
@@ -205,7 +235,7 @@ func (api *API) wsReader(client *types.WebsocketClient) {
 				logrus.Error(err)
 				return
 			}
-			size, exists := plukio.CheckLocalChunk(check.Hash, 2)
+			size, exists := api.store.CheckLocalChunk(check.Hash, 2)
 			check.Exists = exists
 			check.Size = size
 			if err := client.WriteMessage(check.Type(), check); err != nil {
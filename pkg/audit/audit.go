@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger saves audit records to the database and, if configured,
+// appends them as JSON lines to the sink file.
+type Logger struct {
+	mgr  db.DataMgr
+	lock sync.Mutex
+	sink *os.File
+}
+
+// NewLogger creates the audit logger; empty sinkPath disables the file sink.
+func NewLogger(mgr db.DataMgr, sinkPath string) *Logger {
+	l := &Logger{mgr: mgr}
+	if sinkPath == "" {
+		return l
+	}
+	f, err := os.OpenFile(sinkPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		logrus.Errorf("[Audit] Cannot open %v: %v", sinkPath, err)
+		return l
+	}
+	l.sink = f
+	return l
+}
+
+// Record saves the record. Failures are logged only: the audited
+// operation is already done at this point.
+func (l *Logger) Record(record *db.AuditRecord) {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	if record.Status < 400 {
+		record.Outcome = db.AuditSuccess
+	} else {
+		record.Outcome = db.AuditFailure
+	}
+	if err := l.mgr.CreateAuditRecord(record); err != nil {
+		logrus.Errorf("[Audit] Failed to save %v by %v: %v", record.Action, record.Actor, err)
+	}
+	if l.sink == nil {
+		return
+	}
+
+	line, err := json.Marshal(RecordFromDB(record))
+	if err != nil {
+		logrus.Errorf("[Audit] %v", err)
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err = l.sink.Write(append(line, '\n')); err != nil {
+		logrus.Errorf("[Audit] Failed to write %v: %v", l.sink.Name(), err)
+	}
+}
+
+func (l *Logger) List(filter db.AuditFilter) ([]types.AuditRecord, error) {
+	records, err := l.mgr.ListAuditRecords(filter)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.AuditRecord, 0)
+	for _, r := range records {
+		res = append(res, *RecordFromDB(r))
+	}
+	return res, nil
+}
+
+func RecordFromDB(r *db.AuditRecord) *types.AuditRecord {
+	return &types.AuditRecord{
+		ID:         r.ID,
+		Time:       r.CreatedAt,
+		Actor:      r.Actor,
+		RemoteAddr: r.RemoteAddr,
+		Action:     r.Action,
+		Method:     r.Method,
+		Path:       r.Path,
+		Workspace:  r.Workspace,
+		EntityType: r.EntityType,
+		Name:       r.Name,
+		Version:    r.Version,
+		Status:     r.Status,
+		Outcome:    r.Outcome,
+	}
+}
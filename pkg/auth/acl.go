@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// GetACL returns the access control list of the dataset or the workspace
+// default one if the name is empty.
+func (m *Manager) GetACL(eType, workspace, name string) (*types.EntityACL, error) {
+	acl, err := m.mgr.GetEntityACL(eType, workspace, name)
+	if err != nil {
+		return nil, errors.NewStatus(http.StatusNotFound, fmt.Sprintf("ACL for %v not found", aclTarget(eType, workspace, name)))
+	}
+	return aclFromDB(acl), nil
+}
+
+func (m *Manager) SetACL(acl *types.EntityACL) error {
+	users := append(append([]string{}, acl.Readers...), acl.Writers...)
+	if acl.Owner != "" {
+		users = append(users, acl.Owner)
+	}
+	for _, user := range users {
+		if user == "" || strings.Contains(user, ",") {
+			return errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Invalid user name %q", user))
+		}
+		// JWT users are known only from their tokens.
+		if !m.settings.LocalAuth() {
+			continue
+		}
+		if _, err := m.mgr.GetUser(user); err != nil {
+			return errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("User %v not found", user))
+		}
+	}
+	return m.mgr.SaveEntityACL(&db.EntityACL{
+		Type:       acl.Type,
+		Workspace:  acl.Workspace,
+		Name:       acl.Name,
+		Owner:      acl.Owner,
+		Readers:    strings.Join(acl.Readers, ","),
+		Writers:    strings.Join(acl.Writers, ","),
+		PublicRead: acl.PublicRead,
+	})
+}
+
+func (m *Manager) DeleteACL(eType, workspace, name string) error {
+	if _, err := m.GetACL(eType, workspace, name); err != nil {
+		return err
+	}
+	return m.mgr.DeleteEntityACL(eType, workspace, name)
+}
+
+// EffectiveACL merges the dataset ACL with the workspace default one.
+// It returns nil if neither exists: the dataset is then governed by
+// token scopes only.
+func (m *Manager) EffectiveACL(eType, workspace, name string) *types.EntityACL {
+	var res *types.EntityACL
+	if def, err := m.mgr.GetEntityACL(eType, workspace, ""); err == nil {
+		res = aclFromDB(def)
+		res.Name = name
+	}
+	if name == "" {
+		return res
+	}
+	own, err := m.mgr.GetEntityACL(eType, workspace, name)
+	if err != nil {
+		return res
+	}
+	if res == nil {
+		return aclFromDB(own)
+	}
+	if own.Owner != "" {
+		res.Owner = own.Owner
+	}
+	res.Readers = append(res.Readers, splitUsers(own.Readers)...)
+	res.Writers = append(res.Writers, splitUsers(own.Writers)...)
+	res.PublicRead = res.PublicRead || own.PublicRead
+	return res
+}
+
+// Authorize checks access of the identity to the dataset, nil identity
+// means an anonymous request. If the dataset (or its workspace) has an ACL,
+// the ACL decides; otherwise the token scopes are checked. Only admins pass
+// if the workspace is empty.
+func (m *Manager) Authorize(id *Identity, write bool, eType, workspace, name string) error {
+	if id != nil && id.Admin {
+		return nil
+	}
+	if workspace != "" && name != "" {
+		if acl := m.EffectiveACL(eType, workspace, name); acl != nil {
+			if aclAllows(acl, id, write) {
+				return nil
+			}
+			if id == nil {
+				return errors.NewStatus(http.StatusUnauthorized, "Authentication required.")
+			}
+			return errors.NewStatus(
+				http.StatusForbidden,
+				fmt.Sprintf("User %v has no %v access to %v.", id.User, accessName(write), aclTarget(eType, workspace, name)),
+			)
+		}
+	}
+	if id == nil {
+		return errors.NewStatus(http.StatusUnauthorized, "Authentication required.")
+	}
+	if workspace == "" {
+		// Routes without a workspace span all of them.
+		return errors.NewStatus(http.StatusForbidden, "Admin access required.")
+	}
+	if !id.Can(workspace, write) {
+		return errors.NewStatus(
+			http.StatusForbidden,
+			fmt.Sprintf("Token has no %v access to workspace %v.", accessName(write), workspace),
+		)
+	}
+	return nil
+}
+
+// AuthorizeChunk checks access to the chunk which isn't bound to a workspace.
+// Besides token scopes, reading is allowed if any dataset containing the
+// chunk is readable and writing is allowed to writers of any ACL.
+func (m *Manager) AuthorizeChunk(id *Identity, write bool, hash string) error {
+	if id != nil && id.Can("", write) {
+		return nil
+	}
+	if write && id != nil {
+		acls, err := m.mgr.ListEntityACLs()
+		if err != nil {
+			return err
+		}
+		for _, acl := range acls {
+			if aclAllows(aclFromDB(acl), id, true) {
+				return nil
+			}
+		}
+	} else if !write && hash != "" {
+		entities, err := m.mgr.ListChunkEntities(hash)
+		if err != nil {
+			return err
+		}
+		for _, e := range entities {
+			if acl := m.EffectiveACL(e.Type, e.Workspace, e.Name); acl != nil && aclAllows(acl, id, false) {
+				return nil
+			}
+		}
+	}
+	if id == nil {
+		return errors.NewStatus(http.StatusUnauthorized, "Authentication required.")
+	}
+	return errors.NewStatus(http.StatusForbidden, fmt.Sprintf("Token has no %v access to any workspace.", accessName(write)))
+}
+
+// IsOwner tells whether the identity may manage the ACL of the dataset.
+func (m *Manager) IsOwner(id *Identity, eType, workspace, name string) bool {
+	if id == nil {
+		return false
+	}
+	if id.Admin {
+		return true
+	}
+	acl := m.EffectiveACL(eType, workspace, name)
+	if acl == nil {
+		// Nobody owns the dataset yet: anyone who can write may claim it.
+		return id.Can(workspace, true)
+	}
+	return acl.Owner == id.User
+}
+
+func aclAllows(acl *types.EntityACL, id *Identity, write bool) bool {
+	if !write && acl.PublicRead {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+	if acl.Owner != "" && acl.Owner == id.User {
+		return true
+	}
+	if containsUser(acl.Writers, id.User) {
+		return true
+	}
+	return !write && containsUser(acl.Readers, id.User)
+}
+
+func containsUser(users []string, user string) bool {
+	for _, u := range users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+func splitUsers(raw string) []string {
+	if raw == "" {
+		return []string{}
+	}
+	return strings.Split(raw, ",")
+}
+
+func accessName(write bool) string {
+	if write {
+		return AccessWrite
+	}
+	return AccessRead
+}
+
+func aclTarget(eType, workspace, name string) string {
+	if name == "" {
+		return fmt.Sprintf("workspace %v", workspace)
+	}
+	return fmt.Sprintf("%v %v/%v", eType, workspace, name)
+}
+
+func aclFromDB(acl *db.EntityACL) *types.EntityACL {
+	return &types.EntityACL{
+		Type:       acl.Type,
+		Workspace:  acl.Workspace,
+		Name:       acl.Name,
+		Owner:      acl.Owner,
+		Readers:    splitUsers(acl.Readers),
+		Writers:    splitUsers(acl.Writers),
+		PublicRead: acl.PublicRead,
+	}
+}
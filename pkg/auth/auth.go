@@ -0,0 +1,244 @@
+/*
+Package auth implements the built-in authentication: users and their API
+tokens scoped to workspaces, or JWTs verified offline against local keys,
+used when pluk runs without the dealer service.
+*/
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	libtypes "github.com/kuberlab/lib/pkg/types"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+
+	tokenPrefix = "pluk_"
+)
+
+type Manager struct {
+	mgr      db.DataMgr
+	settings *utils.Settings
+}
+
+func NewManager(mgr db.DataMgr, settings *utils.Settings) *Manager {
+	return &Manager{mgr: mgr, settings: settings}
+}
+
+// Identity is the authenticated user with the scopes of the used token.
+type Identity struct {
+	User   string
+	Admin  bool
+	Scopes []types.TokenScope
+}
+
+// Can tells whether the identity has read or write access to the workspace.
+// Empty workspace means requests not bound to a workspace, e.g. chunks:
+// any scope with the needed access allows them.
+func (id *Identity) Can(workspace string, write bool) bool {
+	if id.Admin {
+		return true
+	}
+	for _, s := range id.Scopes {
+		if write && s.Access != AccessWrite {
+			continue
+		}
+		if workspace == "" || s.Workspace == "*" || s.Workspace == workspace {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteWorkspace returns the only workspace the identity may write to,
+// empty if it may write to none, several or any.
+func (id *Identity) WriteWorkspace() string {
+	workspace := ""
+	for _, s := range id.Scopes {
+		if s.Access != AccessWrite {
+			continue
+		}
+		if s.Workspace == "*" || (workspace != "" && workspace != s.Workspace) {
+			return ""
+		}
+		workspace = s.Workspace
+	}
+	return workspace
+}
+
+func (m *Manager) CreateUser(user *types.User) error {
+	if user.Name == "" {
+		return errors.NewStatus(http.StatusBadRequest, "User name is required")
+	}
+	if _, err := m.mgr.GetUser(user.Name); err == nil {
+		return errors.NewStatus(http.StatusConflict, fmt.Sprintf("User %v already exists", user.Name))
+	}
+	return m.mgr.CreateUser(&db.User{Name: user.Name, Admin: user.Admin})
+}
+
+func (m *Manager) ListUsers() ([]types.User, error) {
+	users, err := m.mgr.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.User, 0)
+	for _, u := range users {
+		res = append(res, types.User{Name: u.Name, Admin: u.Admin})
+	}
+	return res, nil
+}
+
+// DeleteUser deletes the user and revokes all its tokens.
+func (m *Manager) DeleteUser(name string) error {
+	if _, err := m.mgr.GetUser(name); err != nil {
+		return errors.NewStatus(http.StatusNotFound, fmt.Sprintf("User %v not found", name))
+	}
+	return m.mgr.DeleteUser(name)
+}
+
+// CreateToken issues the new token for the user. The returned token
+// contains the token itself which can't be retrieved later.
+func (m *Manager) CreateToken(token *types.Token) (*types.Token, error) {
+	if _, err := m.mgr.GetUser(token.User); err != nil {
+		return nil, errors.NewStatus(http.StatusNotFound, fmt.Sprintf("User %v not found", token.User))
+	}
+	scopes, err := FormatScopes(token.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewStatus(http.StatusBadRequest, "Token expiration must be in the future")
+	}
+
+	raw := make([]byte, 24)
+	if _, err = rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := tokenPrefix + hex.EncodeToString(raw)
+
+	record := &db.Token{
+		User:      token.User,
+		Name:      token.Name,
+		Hash:      tokenHash(secret),
+		Scopes:    scopes,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if err = m.mgr.CreateToken(record); err != nil {
+		return nil, err
+	}
+	res := tokenFromDB(record)
+	res.Token = secret
+	return &res, nil
+}
+
+// ListTokens lists tokens of the user or of all users if it is empty.
+func (m *Manager) ListTokens(user string) ([]types.Token, error) {
+	tokens, err := m.mgr.ListTokens(db.Token{User: user})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.Token, 0)
+	for _, t := range tokens {
+		res = append(res, tokenFromDB(t))
+	}
+	return res, nil
+}
+
+func (m *Manager) DeleteToken(id uint) error {
+	tokens, err := m.mgr.ListTokens(db.Token{ID: id})
+	if err != nil {
+		return err
+	}
+	if id == 0 || len(tokens) == 0 {
+		return errors.NewStatus(http.StatusNotFound, fmt.Sprintf("Token %v not found", id))
+	}
+	return m.mgr.DeleteToken(id)
+}
+
+// Authenticate returns the identity of the token owner.
+func (m *Manager) Authenticate(token string) (*Identity, error) {
+	if token == "" {
+		return nil, errors.NewStatus(http.StatusUnauthorized, "Authentication required.")
+	}
+	record, err := m.mgr.GetTokenByHash(tokenHash(token))
+	if err != nil {
+		return nil, errors.NewStatus(http.StatusUnauthorized, "Invalid token.")
+	}
+	if record.ExpiresAt != nil && record.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewStatus(http.StatusUnauthorized, "Token expired.")
+	}
+	user, err := m.mgr.GetUser(record.User)
+	if err != nil {
+		return nil, errors.NewStatus(http.StatusUnauthorized, "Invalid token.")
+	}
+	scopes, err := ParseScopes(record.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{User: user.Name, Admin: user.Admin, Scopes: scopes}, nil
+}
+
+// ParseScopes parses the comma-separated list of workspace:access pairs.
+func ParseScopes(raw string) ([]types.TokenScope, error) {
+	scopes := make([]types.TokenScope, 0)
+	if raw == "" {
+		return scopes, nil
+	}
+	for _, s := range strings.Split(raw, ",") {
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return nil, errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Invalid scope %q: must be workspace:access", s))
+		}
+		scopes = append(scopes, types.TokenScope{Workspace: parts[0], Access: parts[1]})
+	}
+	if _, err := FormatScopes(scopes); err != nil {
+		return nil, err
+	}
+	return scopes, nil
+}
+
+func FormatScopes(scopes []types.TokenScope) (string, error) {
+	res := make([]string, 0)
+	for _, s := range scopes {
+		if s.Workspace == "" || strings.ContainsAny(s.Workspace, ":,") {
+			return "", errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Invalid scope workspace %q", s.Workspace))
+		}
+		if s.Access != AccessRead && s.Access != AccessWrite {
+			return "", errors.NewStatus(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid scope access %q: must be %v or %v", s.Access, AccessRead, AccessWrite),
+			)
+		}
+		res = append(res, s.Workspace+":"+s.Access)
+	}
+	return strings.Join(res, ","), nil
+}
+
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func tokenFromDB(t *db.Token) types.Token {
+	scopes, _ := ParseScopes(t.Scopes)
+	return types.Token{
+		ID:        t.ID,
+		User:      t.User,
+		Name:      t.Name,
+		Scopes:    scopes,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: libtypes.NewTime(t.CreatedAt.Time),
+	}
+}
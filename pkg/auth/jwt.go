@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// jwtLeeway is the allowed clock skew for exp and nbf claims.
+const jwtLeeway = time.Minute
+
+// AdminScope in the scopes claim grants full access.
+const AdminScope = "admin"
+
+// JWTVerifier authenticates bearer JWTs offline against the local key set.
+// Workspaces and access come from the scopes claim: a space-separated
+// string or an array of <workspace>:<read|write> items.
+type JWTVerifier struct {
+	keys        *KeySet
+	audience    string
+	issuer      string
+	userClaim   string
+	scopesClaim string
+}
+
+func NewJWTVerifier(keys *KeySet, audience, issuer, userClaim, scopesClaim string) *JWTVerifier {
+	return &JWTVerifier{
+		keys:        keys,
+		audience:    audience,
+		issuer:      issuer,
+		userClaim:   userClaim,
+		scopesClaim: scopesClaim,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature, expiry, audience and issuer of the token
+// and returns the identity built from its claims.
+func (v *JWTVerifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken(err.Error())
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+
+	keys, err := v.keys.Keys()
+	if err != nil {
+		return nil, err
+	}
+	verified := false
+	for _, k := range keys {
+		if header.Kid != "" && k.ID != "" && k.ID != header.Kid {
+			continue
+		}
+		if verifySignature(header.Alg, k.Key, parts[0]+"."+parts[1], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalidToken("signature verification failed")
+	}
+
+	claims := map[string]interface{}{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken(err.Error())
+	}
+	if err = v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	user, _ := claims[v.userClaim].(string)
+	if user == "" {
+		return nil, invalidToken(fmt.Sprintf("no %v claim", v.userClaim))
+	}
+	id := &Identity{User: user, Scopes: make([]types.TokenScope, 0)}
+	for _, item := range claimStrings(claims[v.scopesClaim]) {
+		if item == AdminScope {
+			id.Admin = true
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 || (parts[1] != AccessRead && parts[1] != AccessWrite) {
+			// Foreign scopes share the claim with ours.
+			continue
+		}
+		id.Scopes = append(id.Scopes, types.TokenScope{Workspace: parts[0], Access: parts[1]})
+	}
+	return id, nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalidToken("no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return errors.NewStatus(http.StatusUnauthorized, "Token expired.")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return invalidToken("token is not valid yet")
+	}
+	// Tokens issued for other services must not pass, so the audience
+	// is always required.
+	if v.audience == "" {
+		return errors.NewStatus(http.StatusInternalServerError, "JWT audience is not configured.")
+	}
+	found := false
+	for _, aud := range claimStrings(claims["aud"]) {
+		if aud == v.audience {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return invalidToken("audience mismatch")
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return invalidToken("issuer mismatch")
+		}
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) bool {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		h, digest := jwtDigest(alg[2:], signed)
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(pub, h, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+		return rsa.VerifyPKCS1v15(pub, h, digest, signature) == nil
+	case "ES256", "ES384", "ES512":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		_, digest := jwtDigest(alg[2:], signed)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(pub, []byte(signed), signature)
+	}
+	// "none" and HMAC are never accepted: the key set holds public keys only.
+	return false
+}
+
+func jwtDigest(bits, signed string) (crypto.Hash, []byte) {
+	var h crypto.Hash
+	var hasher hash.Hash
+	switch bits {
+	case "384":
+		h, hasher = crypto.SHA384, sha512.New384()
+	case "512":
+		h, hasher = crypto.SHA512, sha512.New()
+	default:
+		h, hasher = crypto.SHA256, sha256.New()
+	}
+	hasher.Write([]byte(signed))
+	return h, hasher.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed segment: %v", err)
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("malformed segment: %v", err)
+	}
+	return nil
+}
+
+// claimStrings reads the claim which is either a string, possibly
+// space-separated, or an array of strings.
+func claimStrings(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		res := make([]string, 0)
+		for _, item := range c {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func invalidToken(reason string) error {
+	return errors.NewStatus(http.StatusUnauthorized, fmt.Sprintf("Invalid token: %v.", reason))
+}
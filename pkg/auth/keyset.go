@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PublicKey is the verification key, ID is the JWKS "kid" if any.
+type PublicKey struct {
+	ID  string
+	Key crypto.PublicKey
+}
+
+// KeySet holds keys read from a JWKS or PEM file and reloads them
+// when the file changes.
+type KeySet struct {
+	path string
+
+	lock    sync.Mutex
+	keys    []PublicKey
+	modTime time.Time
+	size    int64
+}
+
+func NewKeySet(path string) *KeySet {
+	return &KeySet{path: path}
+}
+
+// Keys returns the current keys. If the file can't be read or parsed
+// after a change, the previously loaded keys are kept.
+func (ks *KeySet) Keys() ([]PublicKey, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		if ks.keys == nil {
+			return nil, errors.NewStatus(http.StatusInternalServerError, fmt.Sprintf("Can't read JWT keys: %v", err))
+		}
+		logrus.Errorf("Can't read JWT keys, using previous ones: %v", err)
+		return ks.keys, nil
+	}
+	if ks.keys != nil && info.ModTime().Equal(ks.modTime) && info.Size() == ks.size {
+		return ks.keys, nil
+	}
+
+	keys, err := loadKeys(ks.path)
+	if err != nil {
+		if ks.keys == nil {
+			return nil, errors.NewStatus(http.StatusInternalServerError, fmt.Sprintf("Can't load JWT keys: %v", err))
+		}
+		logrus.Errorf("Can't load JWT keys, using previous ones: %v", err)
+		return ks.keys, nil
+	}
+	if ks.keys != nil {
+		logrus.Infof("Reloaded %v JWT keys from %v", len(keys), ks.path)
+	}
+	ks.keys = keys
+	ks.modTime = info.ModTime()
+	ks.size = info.Size()
+	return ks.keys, nil
+}
+
+func loadKeys(path string) ([]PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []PublicKey
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		keys, err = parseJWKS(raw)
+	} else {
+		keys, err = parsePEMKeys(raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %v", path)
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(raw []byte) ([]PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	keys := make([]PublicKey, 0)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", k.Kid, err)
+		}
+		keys = append(keys, PublicKey{ID: k.Kid, Key: key})
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %v", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %v", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// parsePEMKeys reads PUBLIC KEY, RSA PUBLIC KEY and CERTIFICATE blocks.
+func parsePEMKeys(raw []byte) ([]PublicKey, error) {
+	keys := make([]PublicKey, 0)
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, PublicKey{Key: key})
+	}
+	return keys, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+)
+
+// Query parameters of signed URLs.
+const (
+	SignatureParam = "signature"
+	ExpiresParam   = "expires"
+	IPParam        = "ip"
+	MaxSizeParam   = "max_size"
+)
+
+// SignURL returns query parameters which allow GET requests to the path
+// without any other authentication until the expiration. Optional ip
+// (address or CIDR) and maxSize (bytes, 0 means no limit) restrict the use.
+func SignURL(key, path string, expires time.Time, ip string, maxSize int64) url.Values {
+	query := url.Values{}
+	query.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	if ip != "" {
+		query.Set(IPParam, ip)
+	}
+	if maxSize > 0 {
+		query.Set(MaxSizeParam, strconv.FormatInt(maxSize, 10))
+	}
+	query.Set(SignatureParam, urlSignature(key, path, query))
+	return query
+}
+
+// VerifySignedURL checks the signature, expiration and IP restriction of the
+// request and returns its size limit.
+func VerifySignedURL(key, path string, query url.Values, remoteIP string) (int64, error) {
+	if key == "" {
+		return 0, errors.NewStatus(http.StatusForbidden, "Signed URLs are not enabled.")
+	}
+	expected := urlSignature(key, path, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(SignatureParam))) {
+		return 0, errors.NewStatus(http.StatusForbidden, "Invalid URL signature.")
+	}
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, errors.NewStatus(http.StatusForbidden, "Signed URL expired.")
+	}
+	if ip := query.Get(IPParam); ip != "" && !ipAllowed(ip, remoteIP) {
+		return 0, errors.NewStatus(http.StatusForbidden, fmt.Sprintf("Signed URL is not valid for %v.", remoteIP))
+	}
+	maxSize, _ := strconv.ParseInt(query.Get(MaxSizeParam), 10, 64)
+	return maxSize, nil
+}
+
+func urlSignature(key, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(
+		mac,
+		"GET\n%v\n%v\n%v\n%v",
+		path,
+		query.Get(ExpiresParam),
+		query.Get(IPParam),
+		query.Get(MaxSizeParam),
+	)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func ipAllowed(allowed, remoteIP string) bool {
+	remote := net.ParseIP(remoteIP)
+	if remote == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(allowed); err == nil {
+		return network.Contains(remote)
+	}
+	ip := net.ParseIP(allowed)
+	return ip != nil && ip.Equal(remote)
+}
@@ -2,7 +2,6 @@ package config
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/kuberlab/pluk/pkg/utils"
 )
@@ -47,9 +46,5 @@ func GetConnStringForName(dbname string) (dbType string, ConnString string) {
 }
 
 func DBType() string {
-	dbType := os.Getenv("DB_TYPE")
-	if dbType == "" {
-		dbType = "sqlite3"
-	}
-	return dbType
+	return utils.DBType()
 }
@@ -9,13 +9,14 @@ import (
 	"sync"
 	"unicode"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/kuberlab/lib/pkg/errors"
 	"github.com/kuberlab/pluk/pkg/db"
 	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/manifest"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -26,17 +27,22 @@ const (
 type Dataset struct {
 	*db.Dataset
 	mgr          db.DataMgr
+	store        *plukio.Store
+	gc           func(reason string)
 	FS           *plukio.ChunkedFileFS `json:"-"`
 	MasterClient plukio.PlukClient     `json:"-"`
 }
 
 func (d *Dataset) Save(structure types.FileStructure,
 	version string, comment string, create, publish, editing, masterSave bool) error {
-	if err := d.SaveFSToDB(structure, version); err != nil {
+	if err := d.CheckEditable(version); err != nil {
+		return err
+	}
+	if err := d.SaveFSToDB(structure, version, editing); err != nil {
 		return err
 	}
 
-	if utils.HasMasters() && masterSave {
+	if d.MasterClient != nil && masterSave {
 		// TODO: decide whether it can go in async
 		_ = d.MasterClient.SaveFileStructure(
 			structure, d.Type, d.Workspace, d.Name, version,
@@ -47,8 +53,8 @@ func (d *Dataset) Save(structure types.FileStructure,
 	return nil
 }
 
-func (d *Dataset) SaveFSToDB(structure types.FileStructure, version string) (err error) {
-	tx := db.DbMgr.Begin()
+func (d *Dataset) SaveFSToDB(structure types.FileStructure, version string, editing bool) (err error) {
+	tx := d.mgr.Begin()
 	defer func() {
 		if err != nil {
 			tx.Rollback()
@@ -57,6 +63,10 @@ func (d *Dataset) SaveFSToDB(structure types.FileStructure, version string) (err
 		}
 	}()
 
+	return d.saveFSToDB(tx, structure, version, editing)
+}
+
+func (d *Dataset) saveFSToDB(tx db.DataMgr, structure types.FileStructure, version string, editing bool) (err error) {
 	var totalSize int64 = 0
 	var fileSizeMap = make(map[string]int64)
 	for _, f := range structure.Files {
@@ -89,8 +99,9 @@ func (d *Dataset) SaveFSToDB(structure types.FileStructure, version string) (err
 		Name:      d.Name,
 		Workspace: d.Workspace,
 		Type:      d.Type,
+		Editing:   editing,
 	}
-	if err := SaveDatasetVersion(tx, dsv); err != nil {
+	if err := SaveDatasetVersion(tx, d.store, dsv); err != nil {
 		return err
 	}
 
@@ -108,10 +119,10 @@ func (d *Dataset) SaveFSToDB(structure types.FileStructure, version string) (err
 
 	}(structure)
 
-	return receiveFileToSave(tx, dsv, fileChannel, endCh, lock)
+	return receiveFileToSave(tx, d.store, dsv, fileChannel, endCh, lock)
 }
 
-func receiveFileToSave(tx db.DataMgr, dsv *db.DatasetVersion, fileChannel chan *types.HashedFile, endCh chan error, lock *sync.RWMutex) error {
+func receiveFileToSave(tx db.DataMgr, store *plukio.Store, dsv *db.DatasetVersion, fileChannel chan *types.HashedFile, endCh chan error, lock *sync.RWMutex) error {
 	buffer := make([]*db.RawFile, 0)
 	bufFiles := make([]*db.File, 0)
 	fileMap := make(map[string][]*db.RawFile)
@@ -122,7 +133,7 @@ func receiveFileToSave(tx db.DataMgr, dsv *db.DatasetVersion, fileChannel chan *
 		}
 		if len(buffer) >= chunkLimit || force {
 			lock.Lock()
-			TriggerDeleteChunks(tx)
+			TriggerDeleteChunks(tx, store)
 			err := createConnections(tx, buffer)
 			lock.Unlock()
 			buffer = nil
@@ -234,7 +245,7 @@ func createConnections(mgr db.DataMgr, raws []*db.RawFile) error {
 	return mgr.CreateFileChunks(fileChunks)
 }
 
-func SaveDatasetVersion(tx db.DataMgr, dsv *db.DatasetVersion) error {
+func SaveDatasetVersion(tx db.DataMgr, store *plukio.Store, dsv *db.DatasetVersion) error {
 	dsvOld, err := tx.GetDatasetVersion(dsv.Type, dsv.Workspace, dsv.Name, dsv.Version)
 	if err != nil {
 		err = nil
@@ -244,14 +255,24 @@ func SaveDatasetVersion(tx db.DataMgr, dsv *db.DatasetVersion) error {
 			return err
 		}
 	} else if dsvOld.Deleted {
-		// Recover it.
+		// The version is in trash: drop its old content and start it over.
+		err = DeleteFiles(tx, store, dsv.Type, dsv.Workspace, dsv.Name, dsv.Version, "", false, false)
+		if err != nil {
+			return err
+		}
+		if err = tx.DeleteVersionManifest(dsv.Type, dsv.Workspace, dsv.Name, dsv.Version); err != nil {
+			return err
+		}
 		dsvOld.Deleted = false
+		dsvOld.TrashedAt = nil
 		dsvOld.Size = dsv.Size
+		dsvOld.FileCount = dsv.FileCount
+		dsvOld.Editing = dsv.Editing
 		dsv.Deleted = false
 		if dsv.Message != "" {
 			dsvOld.Message = dsv.Message
 		}
-		if err = tx.RecoverDatasetVersion(dsvOld); err != nil {
+		if _, err = tx.UpdateDatasetVersion(dsvOld); err != nil {
 			return err
 		}
 	} else {
@@ -389,12 +410,12 @@ func (d *Dataset) GetFSStructure(version string, filters ...string) (fs *plukio.
 
 	if err == nil {
 		fs, err = d.GetFSFromDB(version, filters...)
-		if err == nil && len(fs.Dirs) == 0 && len(fs.Files) == 0 && utils.HasMasters() {
+		if err == nil && len(fs.Dirs) == 0 && len(fs.Files) == 0 && d.store.HasMasters() {
 			// Empty FS in the DB; need to get FS from master.
 			fs, err = d.getFSStructureFromMaster(version, filters...)
 		}
 	} else {
-		if !utils.HasMasters() {
+		if !d.store.HasMasters() {
 			return nil, fmt.Errorf(
 				"Version %v not found in %v %v/%v.",
 				version, d.Type, d.Workspace, d.Name,
@@ -407,6 +428,7 @@ func (d *Dataset) GetFSStructure(version string, filters ...string) (fs *plukio.
 		return nil, err
 	}
 
+	fs.SetSource(d.store)
 	fs.Prepare()
 	d.FS = fs
 	return fs, nil
@@ -431,7 +453,19 @@ func (d *Dataset) getFSStructureFromMaster(version string, filters ...string) (*
 }
 
 func (d *Dataset) SaveFSLocally(src *plukio.ChunkedFileFS, version string) error {
-	dest := types.FileStructure{
+	dest, err := hashedStructure(src)
+	if err != nil {
+		return err
+	}
+
+	// It is only a local copy of the master data, so it is saved
+	// regardless of the version state.
+	return d.SaveFSToDB(*dest, version, false)
+}
+
+// hashedStructure converts the file system to the file structure with chunk hashes.
+func hashedStructure(src *plukio.ChunkedFileFS) (*types.FileStructure, error) {
+	dest := &types.FileStructure{
 		Files: make([]*types.HashedFile, 0),
 	}
 	err := src.Walk("/", func(path string, f *plukio.ChunkedFile, err error) error {
@@ -446,17 +480,17 @@ func (d *Dataset) SaveFSLocally(src *plukio.ChunkedFileFS, version string) error
 			ModeTime: f.ModTime,
 		}
 		for _, chunk := range f.Chunks {
-			hash, version := utils.GetHashFromPath(chunk.Path)
+			version := chunk.Version
+			hash := utils.ChunkHash(chunk.Path, version)
 			file.Hashes = append(file.Hashes, types.Hash{Hash: hash, Size: chunk.Size, Version: version})
 		}
 		dest.Files = append(dest.Files, &file)
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return d.Save(dest, version, "", false, false, false, false)
+	return dest, nil
 }
 
 func (d *Dataset) GetFSFromDB(version string, filters ...string) (*plukio.ChunkedFileFS, error) {
@@ -502,7 +536,7 @@ func (d *Dataset) Versions() ([]types.Version, error) {
 			Workspace: dsv.Workspace,
 		}
 	}
-	if utils.HasMasters() && d.MasterClient != nil {
+	if d.MasterClient != nil {
 		vList, err := d.MasterClient.ListVersions(d.Type, d.Workspace, d.Name)
 		if err != nil {
 			return nil, err
@@ -546,19 +580,40 @@ func (d *Dataset) DeleteVersion(version string, force bool) error {
 		}
 	} else {
 		dsv.Deleted = true
+		dsv.TrashedAt = trashTime(force)
 		if _, err = d.mgr.UpdateDatasetVersion(dsv); err != nil {
 			return err
 		}
 	}
 
-	if utils.HasMasters() && d.MasterClient != nil {
+	if d.MasterClient != nil {
 		_ = d.MasterClient.DeleteVersion(d.Type, d.Workspace, d.Name, version)
 	}
 
-	if force {
-		utils.GCChan <- fmt.Sprintf("Clean version of %v/%v:%v", d.Workspace, d.Name, version)
+	if force && d.gc != nil {
+		d.gc(fmt.Sprintf("Clean version of %v/%v:%v", d.Workspace, d.Name, version))
+	}
+
+	return nil
+}
+
+// RestoreVersion takes the version out of trash.
+func (d *Dataset) RestoreVersion(version string) error {
+	dsv, err := d.mgr.GetDatasetVersion(d.Type, d.Workspace, d.Name, version)
+	if err == nil && dsv.Deleted {
+		if err = d.mgr.RecoverDatasetVersion(dsv); err != nil {
+			return err
+		}
+	} else if d.MasterClient == nil {
+		return errors.NewStatus(
+			http.StatusNotFound,
+			fmt.Sprintf("Version %v of %v %v/%v not found in trash", version, d.Type, d.Workspace, d.Name),
+		)
 	}
 
+	if d.MasterClient != nil {
+		return d.MasterClient.RestoreVersion(d.Type, d.Workspace, d.Name, version)
+	}
 	return nil
 }
 
@@ -570,7 +625,142 @@ func (d *Dataset) CommitVersion(version string, message string) (*db.DatasetVers
 		return nil, err
 	}
 
-	return d.mgr.CommitVersion(d.Type, d.Workspace, d.Name, version, message)
+	tx := d.mgr.Begin()
+	dsv, err := d.commitVersion(tx, version, message)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	tx.Commit()
+	return dsv, nil
+}
+
+// commitVersion marks the version committed and signs its manifest in tx,
+// so the version is never committed without the manifest.
+func (d *Dataset) commitVersion(tx db.DataMgr, version string, message string) (*db.DatasetVersion, error) {
+	dsv, err := tx.CommitVersion(d.Type, d.Workspace, d.Name, version, message)
+	if err != nil {
+		return nil, err
+	}
+	txDataset := &Dataset{Dataset: d.Dataset, mgr: tx, store: d.store, gc: d.gc, MasterClient: d.MasterClient}
+	sig, err := txDataset.signVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if sig != nil {
+		if err = txDataset.saveManifest(version, sig); err != nil {
+			return nil, err
+		}
+	}
+	return dsv, nil
+}
+
+// CheckEditable returns 409 error if the version exists and is already committed.
+func (d *Dataset) CheckEditable(version string) error {
+	dsv, err := d.mgr.GetDatasetVersion(d.Type, d.Workspace, d.Name, version)
+	if err != nil || dsv.Deleted || dsv.Editing {
+		return nil
+	}
+	return CommittedError(d.Type, d.Workspace, d.Name, version)
+}
+
+func CommittedError(dsType, workspace, name, version string) error {
+	return errors.NewStatus(
+		http.StatusConflict,
+		fmt.Sprintf(
+			"Version %v of %v %v/%v is committed and read-only; it must be reopened to be changed",
+			version, dsType, workspace, name,
+		),
+	)
+}
+
+// ReopenVersion makes the committed version editable again.
+// The manifest signature of the version is dropped since it no longer guarantees the content.
+func (d *Dataset) ReopenVersion(version string, master plukio.PlukClient) error {
+	forward := master != nil
+
+	dsv, err := d.mgr.GetDatasetVersion(d.Type, d.Workspace, d.Name, version)
+	if err != nil || dsv.Deleted {
+		if !forward {
+			return errors.NewStatus(
+				http.StatusNotFound,
+				fmt.Sprintf("Version %v for %v %v/%v doesn't exist.", version, d.Type, d.Workspace, d.Name),
+			)
+		}
+		return master.ReopenVersion(d.Type, d.Workspace, d.Name, version)
+	}
+
+	// The master reopens first, so its failure leaves the local version committed.
+	if forward {
+		if err = master.ReopenVersion(d.Type, d.Workspace, d.Name, version); err != nil {
+			return err
+		}
+	}
+	if dsv.Editing {
+		return nil
+	}
+	tx := d.mgr.Begin()
+	if _, err = tx.ReopenVersion(d.Type, d.Workspace, d.Name, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.DeleteVersionManifest(d.Type, d.Workspace, d.Name, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+// signVersion signs the version manifest if the signing key is configured.
+func (d *Dataset) signVersion(version string) (*types.ManifestSignature, error) {
+	keyFile := utils.ManifestSigningKey()
+	if keyFile == "" {
+		return nil, nil
+	}
+	key, err := manifest.LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load manifest signing key: %v", err)
+	}
+	fs, err := d.GetFSStructure(version)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Sign(key, manifest.FromFS(d.Type, d.Workspace, d.Name, version, fs))
+}
+
+func (d *Dataset) saveManifest(version string, sig *types.ManifestSignature) error {
+	return d.mgr.SaveVersionManifest(
+		&db.VersionManifest{
+			Type:      d.Type,
+			Workspace: d.Workspace,
+			Name:      d.Name,
+			Version:   version,
+			Algorithm: sig.Algorithm,
+			KeyID:     sig.KeyID,
+			Digest:    sig.Digest,
+			Signature: sig.Signature,
+		},
+	)
+}
+
+func (d *Dataset) ManifestSignature(version string) (*types.ManifestSignature, error) {
+	m, err := d.mgr.GetVersionManifest(d.Type, d.Workspace, d.Name, version)
+	if err == nil {
+		return &types.ManifestSignature{
+			Algorithm: m.Algorithm,
+			KeyID:     m.KeyID,
+			Digest:    m.Digest,
+			Signature: m.Signature,
+		}, nil
+	}
+	if d.MasterClient != nil {
+		return d.MasterClient.GetManifestSignature(d.Type, d.Workspace, d.Name, version)
+	}
+	return nil, errors.NewStatus(
+		http.StatusNotFound,
+		fmt.Sprintf("Version %v of %v %v/%v is not signed", version, d.Type, d.Workspace, d.Name),
+	)
 }
 
 type ClonedFile struct {
@@ -579,6 +769,10 @@ type ClonedFile struct {
 }
 
 func (d *Dataset) CloneVersionTo(target *Dataset, version, targetVersion, message string) (*db.DatasetVersion, error) {
+	if err := target.CheckEditable(targetVersion); err != nil {
+		return nil, err
+	}
+
 	var err error
 	tx := d.mgr.Begin()
 	defer func() {
@@ -589,12 +783,31 @@ func (d *Dataset) CloneVersionTo(target *Dataset, version, targetVersion, messag
 		}
 	}()
 
+	sourceVersion, err := tx.GetDatasetVersion(d.Type, d.Workspace, d.Name, version)
+	if err != nil {
+		return nil, err
+	}
+
 	// Clean target version
 	_ = DeleteFiles(
-		tx, target.Type, target.Workspace,
+		tx, d.store, target.Type, target.Workspace,
 		target.Name, targetVersion, "", false, false,
 	)
 
+	dsv := &db.DatasetVersion{
+		Version:   targetVersion,
+		Size:      sourceVersion.Size,
+		Name:      target.Name,
+		Workspace: target.Workspace,
+		Type:      target.Type,
+		Editing:   true,
+		Message:   message,
+		FileCount: sourceVersion.FileCount,
+	}
+	if err = SaveDatasetVersion(tx, d.store, dsv); err != nil {
+		return nil, err
+	}
+
 	files, err := tx.ListFiles(
 		db.File{
 			Workspace:   d.Workspace,
@@ -718,23 +931,7 @@ func (d *Dataset) CloneVersionTo(target *Dataset, version, targetVersion, messag
 		}
 	}
 
-	sourceVersion, err := tx.GetDatasetVersion(d.Type, d.Workspace, d.Name, version)
-	if err != nil {
-		return nil, err
-	}
-
-	dsv := &db.DatasetVersion{
-		Version:   targetVersion,
-		Size:      sourceVersion.Size,
-		Name:      target.Name,
-		Workspace: target.Workspace,
-		Type:      target.Type,
-		Editing:   true,
-		Message:   message,
-		FileCount: sourceVersion.FileCount,
-	}
-	err = SaveDatasetVersion(tx, dsv)
-	return dsv, err
+	return dsv, nil
 }
 
 func (d *Dataset) CloneVersion(version, targetVersion, message string) (*db.DatasetVersion, error) {
@@ -5,23 +5,43 @@ import (
 	"net/http"
 
 	"strings"
+	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/kuberlab/lib/pkg/errors"
 	libtypes "github.com/kuberlab/lib/pkg/types"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/io"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 type Manager struct {
-	mgr db.DataMgr
-	hub *types.Hub
+	mgr   db.DataMgr
+	hub   *types.Hub
+	store *io.Store
+	gc    func(reason string)
+
+	uploads uploads
 }
 
-func NewManager(mgr db.DataMgr, hub *types.Hub) *Manager {
-	return &Manager{mgr: mgr, hub: hub}
+func NewManager(mgr db.DataMgr, hub *types.Hub, store *io.Store) *Manager {
+	m := &Manager{mgr: mgr, hub: hub, store: store}
+	m.uploads.bytes = make(map[string]int64)
+	m.uploads.last = make(map[string]time.Time)
+	return m
+}
+
+// SetGCTrigger sets the function requesting the garbage collection
+// after entities and versions are deleted with force.
+func (m *Manager) SetGCTrigger(gc func(reason string)) {
+	m.gc = gc
+}
+
+func (m *Manager) triggerGC(reason string) {
+	if m.gc != nil {
+		m.gc(reason)
+	}
 }
 
 func (m *Manager) ListDatasets(eType, workspace string) ([]*Dataset, error) {
@@ -31,7 +51,7 @@ func (m *Manager) ListDatasets(eType, workspace string) ([]*Dataset, error) {
 	}
 	sets := make([]*Dataset, 0)
 	for _, d := range datasets {
-		sets = append(sets, &Dataset{Dataset: d, mgr: m.mgr})
+		sets = append(sets, &Dataset{Dataset: d, mgr: m.mgr, store: m.store, gc: m.triggerGC})
 	}
 
 	return sets, nil
@@ -39,15 +59,18 @@ func (m *Manager) ListDatasets(eType, workspace string) ([]*Dataset, error) {
 
 func (m *Manager) GetDataset(eType, workspace, name string, master io.PlukClient) (*Dataset, error) {
 	datasetDB, err := m.mgr.GetDataset(eType, workspace, name)
+	if err == nil && datasetDB.Deleted {
+		err = fmt.Errorf("%v %v/%v is in trash", strings.Title(eType), workspace, name)
+	}
 	if err == nil {
 		// Found
-		return &Dataset{MasterClient: master, mgr: m.mgr, Dataset: datasetDB}, nil
+		return &Dataset{MasterClient: master, mgr: m.mgr, store: m.store, gc: m.triggerGC, Dataset: datasetDB}, nil
 	} else {
 		logrus.Errorf("Get dataset: %v", err)
 	}
 
 	// If none found, that means that it probably on master side.
-	if !utils.HasMasters() || master == nil {
+	if master == nil {
 		return nil, err
 	}
 
@@ -80,12 +103,16 @@ func (m *Manager) NewDataset(eType, workspace, name string, master io.PlukClient
 			return nil, err
 		}
 	}
-	ds := &Dataset{Dataset: dsDB, mgr: m.mgr, MasterClient: master}
+	ds := &Dataset{Dataset: dsDB, mgr: m.mgr, store: m.store, gc: m.triggerGC, MasterClient: master}
 	return ds, nil
 }
 
-func (m *Manager) ForkDataset(src types.Dataset, target types.Dataset, master io.PlukClient) (*Dataset, error) {
-	_, err := m.mgr.GetDataset(target.DType, target.Workspace, target.Name)
+// ProgressFunc reports the number of processed items; a returned error stops the operation.
+type ProgressFunc func(done, total int64) error
+
+func (m *Manager) ForkDataset(src types.Dataset, target types.Dataset,
+	master io.PlukClient, progress ProgressFunc) (ds *Dataset, err error) {
+	_, err = m.mgr.GetDataset(target.DType, target.Workspace, target.Name)
 	if err == nil {
 		msg := fmt.Sprintf(
 			"%v %v/%v already exists. Please delete it first and try again.",
@@ -100,18 +127,40 @@ func (m *Manager) ForkDataset(src types.Dataset, target types.Dataset, master io
 		return nil, errors.NewStatusReason(404, msg, err.Error())
 	}
 
-	ds, err := m.NewDataset(target.DType, target.Workspace, target.Name, master)
+	ds, err = m.NewDataset(target.DType, target.Workspace, target.Name, master)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		// Don't leave the partial fork, e.g. of the cancelled job.
+		if err == nil {
+			return
+		}
+		if delErr := m.DeleteDataset(target.DType, target.Workspace, target.Name, master, true); delErr != nil {
+			logrus.Errorf("Delete partial fork %v/%v: %v", target.Workspace, target.Name, delErr)
+		}
+	}()
 
 	sourceVersions, err := source.Versions()
 	if err != nil {
 		return nil, err
 	}
 
+	var total int64
+	for _, ver := range sourceVersions {
+		if !ver.Editing {
+			total++
+		}
+	}
+
+	var done int64
 	for _, ver := range sourceVersions {
 		if !ver.Editing {
+			if progress != nil {
+				if err = progress(done, total); err != nil {
+					return nil, err
+				}
+			}
 			if _, err = source.CloneVersionTo(ds, ver.Version, ver.Version, ver.Message); err != nil {
 				return nil, err
 			}
@@ -121,6 +170,12 @@ func (m *Manager) ForkDataset(src types.Dataset, target types.Dataset, master io
 			if err = ds.mgr.UpdateDatasetVersionDate(ds.Type, ds.Workspace, ds.Name, ver.Version, libtypes.TimeNow()); err != nil {
 				return nil, err
 			}
+			done++
+		}
+	}
+	if progress != nil {
+		if err = progress(done, total); err != nil {
+			return nil, err
 		}
 	}
 
@@ -142,23 +197,26 @@ func (m *Manager) DeleteDataset(eType, workspace, name string, master io.PlukCli
 		return err
 	}
 
+	trashedAt := trashTime(force)
 	for _, dsv := range dsvs {
 		dsv.Deleted = true
+		dsv.TrashedAt = trashedAt
 		if _, err = m.mgr.UpdateDatasetVersion(dsv); err != nil {
 			return err
 		}
 	}
 	ds.Deleted = true
+	ds.TrashedAt = trashedAt
 	if _, err = m.mgr.UpdateDataset(ds); err != nil {
 		return err
 	}
 
-	if utils.HasMasters() && master != nil {
+	if master != nil {
 		_ = master.DeleteEntity(ds.Type, workspace, name, force)
 	}
 
 	if force {
-		utils.GCChan <- fmt.Sprintf("Clean dataset %v/%v", workspace, name)
+		m.triggerGC(fmt.Sprintf("Clean dataset %v/%v", workspace, name))
 	}
 
 	// Push message about deleting dataset here
@@ -167,6 +225,168 @@ func (m *Manager) DeleteDataset(eType, workspace, name string, master io.PlukCli
 	return nil
 }
 
+// RestoreDataset takes the dataset out of trash along with
+// the versions which were deleted together with it.
+func (m *Manager) RestoreDataset(eType, workspace, name string, master io.PlukClient) error {
+	ds, err := m.mgr.GetDataset(eType, workspace, name)
+	if err == nil && ds.Deleted {
+		dsvs, err := m.mgr.ListDatasetVersions(
+			db.DatasetVersion{Name: name, Workspace: workspace, Type: eType, Deleted: true},
+		)
+		if err != nil {
+			return err
+		}
+		for _, dsv := range dsvs {
+			if !trashedTogether(dsv.TrashedAt, ds.TrashedAt) {
+				continue
+			}
+			if err = m.mgr.RecoverDatasetVersion(dsv); err != nil {
+				return err
+			}
+		}
+		if err = m.mgr.RecoverDataset(ds); err != nil {
+			return err
+		}
+	} else if master == nil {
+		return errors.NewStatus(
+			http.StatusNotFound,
+			fmt.Sprintf("%v %v/%v not found in trash", strings.Title(eType), workspace, name),
+		)
+	}
+
+	if master != nil {
+		if err = master.RestoreEntity(eType, workspace, name); err != nil {
+			return err
+		}
+	}
+
+	m.PushMessageDataset(&types.Dataset{Workspace: workspace, Name: name, DType: eType})
+	return nil
+}
+
+// RenameDataset moves the dataset to another workspace and/or name
+// together with its versions and files.
+func (m *Manager) RenameDataset(eType, workspace, name, newWorkspace, newName string, master io.PlukClient) (err error) {
+	if workspace == newWorkspace && name == newName {
+		return errors.NewStatus(http.StatusBadRequest, "The new workspace and name are the same")
+	}
+	if _, err = m.mgr.GetDataset(eType, newWorkspace, newName); err == nil {
+		return errors.NewStatus(
+			http.StatusConflict,
+			fmt.Sprintf(
+				"%v %v/%v already exists. Please delete it first and try again.",
+				strings.Title(eType), newWorkspace, newName,
+			),
+		)
+	}
+
+	ds, err := m.mgr.GetDataset(eType, workspace, name)
+	local := err == nil && !ds.Deleted
+	if !local && master == nil {
+		return errors.NewStatus(
+			http.StatusNotFound,
+			fmt.Sprintf("%v %v/%v not found", strings.Title(eType), workspace, name),
+		)
+	}
+
+	// The master renames first, so its failure leaves the local copy as is.
+	if master != nil {
+		if err = master.RenameEntity(eType, workspace, name, newWorkspace, newName); err != nil {
+			return err
+		}
+	}
+	if local {
+		tx := m.mgr.Begin()
+		if err = tx.RenameDataset(eType, workspace, name, newWorkspace, newName); err != nil {
+			tx.Rollback()
+			return err
+		}
+		tx.Commit()
+	}
+	if master == nil {
+		if err = m.resignVersions(eType, newWorkspace, newName); err != nil {
+			return err
+		}
+	}
+
+	// Slaves drop their copy under the old name.
+	m.PushMessageDataset(&types.Dataset{Workspace: workspace, Name: name, DType: eType})
+	return nil
+}
+
+// resignVersions signs manifests of the committed versions again after the dataset is renamed.
+func (m *Manager) resignVersions(eType, workspace, name string) error {
+	ds, err := m.GetDataset(eType, workspace, name, nil)
+	if err != nil {
+		return err
+	}
+	dsvs, err := m.mgr.ListDatasetVersions(
+		db.DatasetVersion{Name: name, Workspace: workspace, Type: eType},
+	)
+	if err != nil {
+		return err
+	}
+	for _, dsv := range dsvs {
+		if dsv.Editing || dsv.Deleted {
+			continue
+		}
+		sig, err := ds.signVersion(dsv.Version)
+		if err != nil {
+			return err
+		}
+		if sig == nil {
+			// Signing is not configured.
+			return nil
+		}
+		if err = ds.saveManifest(dsv.Version, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trash lists datasets and versions which are deleted but not purged yet.
+func (m *Manager) Trash(eType, workspace string) ([]types.TrashItem, error) {
+	items := make([]types.TrashItem, 0)
+	retention := utils.TrashRetention()
+
+	dss, err := m.mgr.ListDatasets(db.Dataset{Type: eType, Workspace: workspace, Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range dss {
+		if ds.TrashedAt == nil {
+			continue
+		}
+		items = append(items, types.TrashItem{
+			Workspace: ds.Workspace,
+			Name:      ds.Name,
+			DType:     ds.Type,
+			DeletedAt: *ds.TrashedAt,
+			PurgeAt:   ds.TrashedAt.Add(retention),
+		})
+	}
+
+	dsvs, err := m.mgr.ListDatasetVersions(db.DatasetVersion{Type: eType, Workspace: workspace, Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, dsv := range dsvs {
+		if dsv.TrashedAt == nil {
+			continue
+		}
+		items = append(items, types.TrashItem{
+			Workspace: dsv.Workspace,
+			Name:      dsv.Name,
+			DType:     dsv.Type,
+			Version:   dsv.Version,
+			DeletedAt: *dsv.TrashedAt,
+			PurgeAt:   dsv.TrashedAt.Add(retention),
+		})
+	}
+	return items, nil
+}
+
 func (m *Manager) PushMessageDataset(ds *types.Dataset) {
 	if m.hub == nil || ds == nil {
 		return
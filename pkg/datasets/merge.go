@@ -0,0 +1,182 @@
+package datasets
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+const (
+	ResolveOurs   = "ours"
+	ResolveTheirs = "theirs"
+
+	changeAdded    = "added"
+	changeModified = "modified"
+	changeDeleted  = "deleted"
+)
+
+// MergeVersion applies changes made in theirs since base into the editing version.
+// Paths changed differently on both sides are returned as conflicts unless
+// resolved with "ours" or "theirs" in resolutions.
+func (d *Dataset) MergeVersion(version, theirs, base string, resolutions map[string]string) (*types.MergeResult, error) {
+	for p, side := range resolutions {
+		if side != ResolveOurs && side != ResolveTheirs {
+			return nil, errors.NewStatus(
+				http.StatusBadRequest,
+				fmt.Sprintf("Wrong resolution %q for %v: must be %v or %v", side, p, ResolveOurs, ResolveTheirs),
+			)
+		}
+	}
+	if err := d.CheckEditable(version); err != nil {
+		return nil, err
+	}
+
+	baseTree, err := d.fileTree(base)
+	if err != nil {
+		return nil, err
+	}
+	oursTree, err := d.fileTree(version)
+	if err != nil {
+		return nil, err
+	}
+	theirsTree, err := d.fileTree(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]*types.HashedFile{baseTree, oursTree, theirsTree} {
+		for p := range tree {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	result := &types.MergeResult{
+		Added:     make([]string, 0),
+		Modified:  make([]string, 0),
+		Deleted:   make([]string, 0),
+		Conflicts: make([]types.MergeConflict, 0),
+	}
+	puts := make([]*types.HashedFile, 0)
+	for _, p := range sorted {
+		b, o, t := baseTree[p], oursTree[p], theirsTree[p]
+		if sameFile(t, b) || sameFile(o, t) {
+			// Nothing new in theirs.
+			continue
+		}
+		if !sameFile(o, b) {
+			switch resolutions[p] {
+			case ResolveOurs:
+				continue
+			case ResolveTheirs:
+			default:
+				result.Conflicts = append(
+					result.Conflicts,
+					types.MergeConflict{Path: p, Ours: changeKind(b, o), Theirs: changeKind(b, t)},
+				)
+				continue
+			}
+		}
+		switch {
+		case t == nil:
+			result.Deleted = append(result.Deleted, p)
+		case o == nil:
+			result.Added = append(result.Added, p)
+			puts = append(puts, t)
+		default:
+			result.Modified = append(result.Modified, p)
+			puts = append(puts, t)
+		}
+	}
+
+	if err = d.applyMerge(version, result, puts); err != nil {
+		return nil, err
+	}
+
+	if d.MasterClient != nil {
+		_, _ = d.MasterClient.MergeVersion(d.Type, d.Workspace, d.Name, version, theirs, base, resolutions)
+	}
+	return result, nil
+}
+
+func (d *Dataset) applyMerge(version string, result *types.MergeResult, puts []*types.HashedFile) (err error) {
+	tx := d.mgr.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+
+	for _, paths := range [][]string{result.Deleted, result.Modified} {
+		for _, p := range paths {
+			if err = DeleteFiles(tx, d.store, d.Type, d.Workspace, d.Name, version, p, true, false); err != nil {
+				return err
+			}
+		}
+	}
+	if len(puts) > 0 {
+		if err = d.saveFSToDB(tx, types.FileStructure{Files: puts}, version, true); err != nil {
+			return err
+		}
+	}
+	return tx.UpdateDatasetVersionSize(d.Type, d.Workspace, d.Name, version)
+}
+
+// fileTree returns files of the version by path.
+func (d *Dataset) fileTree(version string) (map[string]*types.HashedFile, error) {
+	if _, err := d.mgr.GetDatasetVersion(d.Type, d.Workspace, d.Name, version); err != nil && !d.store.HasMasters() {
+		return nil, errors.NewStatus(
+			http.StatusNotFound,
+			fmt.Sprintf("Version %v not found in %v %v/%v", version, d.Type, d.Workspace, d.Name),
+		)
+	}
+	fs, err := d.GetFSStructure(version)
+	if err != nil {
+		return nil, err
+	}
+	structure, err := hashedStructure(fs)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]*types.HashedFile, len(structure.Files))
+	for _, f := range structure.Files {
+		tree[f.Path] = f
+	}
+	return tree, nil
+}
+
+func sameFile(a, b *types.HashedFile) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Mode == b.Mode && fileDigest(a) == fileDigest(b)
+}
+
+func fileDigest(f *types.HashedFile) string {
+	hashes := make([]string, len(f.Hashes))
+	for i, h := range f.Hashes {
+		hashes[i] = h.Hash
+	}
+	return fmt.Sprintf("%v:%v", f.Size, strings.Join(hashes, ","))
+}
+
+func changeKind(base, side *types.HashedFile) string {
+	switch {
+	case base == nil:
+		return changeAdded
+	case side == nil:
+		return changeDeleted
+	}
+	return changeModified
+}
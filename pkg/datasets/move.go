@@ -0,0 +1,248 @@
+package datasets
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// MoveFiles moves (renames) the file or the directory tree inside the editing version.
+// Only file records are rewritten, the content stays in the same chunks.
+func (d *Dataset) MoveFiles(version, from, to string) (err error) {
+	from, to = cleanPath(from), cleanPath(to)
+	if from == "" || to == "" {
+		return errors.NewStatus(http.StatusBadRequest, "Both source and target paths must be provided")
+	}
+	if from == to {
+		return nil
+	}
+	if strings.HasPrefix(to, from+"/") {
+		return errors.NewStatus(http.StatusBadRequest, fmt.Sprintf("Can not move %v into itself", from))
+	}
+	if err = d.CheckEditable(version); err != nil {
+		return err
+	}
+
+	tx := d.mgr.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+
+	files, err := tx.ListFiles(
+		db.File{DatasetType: d.Type, Workspace: d.Workspace, DatasetName: d.Name, Version: version},
+	)
+	if err != nil {
+		return err
+	}
+	targets := make([]string, 0)
+	for _, f := range files {
+		if rel, ok := relativePath(f.Path, from); ok {
+			targets = append(targets, joinPath(to, rel))
+		}
+	}
+	if len(targets) == 0 {
+		return notFoundPath(d.Type, d.Workspace, d.Name, version, from)
+	}
+	if err = d.dropOverwritten(tx, version, files, targets); err != nil {
+		return err
+	}
+
+	if _, err = tx.MoveFiles(d.Type, d.Workspace, d.Name, version, from, to); err != nil {
+		return err
+	}
+	if err = tx.UpdateDatasetVersionSize(d.Type, d.Workspace, d.Name, version); err != nil {
+		return err
+	}
+
+	if d.MasterClient != nil {
+		_ = d.MasterClient.MoveFiles(d.Type, d.Workspace, d.Name, version, from, to)
+	}
+	return nil
+}
+
+// CopyFiles copies the file or the directory tree from the source version
+// (of this or another entity) into the editing version. The copies link to the same chunks.
+func (d *Dataset) CopyFiles(src *Dataset, srcVersion, from, version, to string) (err error) {
+	from, to = cleanPath(from), cleanPath(to)
+	sameVersion := src.Type == d.Type && src.Workspace == d.Workspace &&
+		src.Name == d.Name && srcVersion == version
+	if sameVersion && from == to {
+		return errors.NewStatus(http.StatusBadRequest, "Source and target paths are the same")
+	}
+	if err = d.CheckEditable(version); err != nil {
+		return err
+	}
+	if src.MasterClient != nil {
+		// Make sure the source file structure is present locally.
+		if _, err = src.GetFSStructure(srcVersion); err != nil {
+			return err
+		}
+	}
+
+	tx := d.mgr.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+
+	srcFiles, err := tx.ListFiles(
+		db.File{DatasetType: src.Type, Workspace: src.Workspace, DatasetName: src.Name, Version: srcVersion},
+	)
+	if err != nil {
+		return err
+	}
+	copies := make([]*ClonedFile, 0)
+	targets := make([]string, 0)
+	for _, f := range srcFiles {
+		rel, ok := relativePath(f.Path, from)
+		if !ok {
+			continue
+		}
+		target := joinPath(to, rel)
+		targets = append(targets, target)
+		copies = append(copies, &ClonedFile{
+			oldID: f.ID,
+			newFile: &db.File{
+				Path:        target,
+				Size:        f.Size,
+				Mode:        f.Mode,
+				DatasetName: d.Name,
+				DatasetType: d.Type,
+				Workspace:   d.Workspace,
+				Version:     version,
+			},
+		})
+	}
+	if len(copies) == 0 {
+		return notFoundPath(src.Type, src.Workspace, src.Name, srcVersion, from)
+	}
+
+	files, err := tx.ListFiles(
+		db.File{DatasetType: d.Type, Workspace: d.Workspace, DatasetName: d.Name, Version: version},
+	)
+	if err != nil {
+		return err
+	}
+	if err = d.dropOverwritten(tx, version, files, targets); err != nil {
+		return err
+	}
+
+	fileChunks, err := tx.ListRelatedChunksForFiles(src.Type, src.Workspace, src.Name, srcVersion, from, false)
+	if err != nil {
+		return err
+	}
+	fileChunksMap := make(map[uint][]*db.FileChunk)
+	for _, fc := range fileChunks {
+		fileChunksMap[fc.FileID] = append(fileChunksMap[fc.FileID], fc)
+	}
+
+	fcBuf := make([]*db.FileChunk, 0)
+	for start := 0; start < len(copies); start += limit {
+		end := start + limit
+		if end > len(copies) {
+			end = len(copies)
+		}
+		batch := make([]*db.File, 0, end-start)
+		for _, cloned := range copies[start:end] {
+			batch = append(batch, cloned.newFile)
+		}
+		if err = tx.CreateFiles(batch); err != nil {
+			return err
+		}
+		for _, cloned := range copies[start:end] {
+			for _, oldFC := range fileChunksMap[cloned.oldID] {
+				fcBuf = append(fcBuf, &db.FileChunk{
+					FileID:     cloned.newFile.ID,
+					ChunkID:    oldFC.ChunkID,
+					ChunkIndex: oldFC.ChunkIndex,
+				})
+				if len(fcBuf) >= chunkLimit {
+					if err = tx.CreateFileChunks(fcBuf); err != nil {
+						return err
+					}
+					fcBuf = make([]*db.FileChunk, 0)
+				}
+			}
+		}
+	}
+	if len(fcBuf) > 0 {
+		if err = tx.CreateFileChunks(fcBuf); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.UpdateDatasetVersionSize(d.Type, d.Workspace, d.Name, version); err != nil {
+		return err
+	}
+
+	if d.MasterClient != nil {
+		_ = d.MasterClient.CopyFiles(
+			d.Type, d.Workspace, d.Name, version, to,
+			types.FileSource{Workspace: src.Workspace, Name: src.Name, Version: srcVersion, Path: from},
+		)
+	}
+	return nil
+}
+
+// dropOverwritten deletes existing files of the version which are replaced by targets.
+func (d *Dataset) dropOverwritten(tx db.DataMgr, version string, files []*db.File, targets []string) error {
+	existing := make(map[string]bool)
+	for _, f := range files {
+		existing[f.Path] = true
+	}
+	for _, target := range targets {
+		if !existing[target] {
+			continue
+		}
+		if err := DeleteFiles(tx, d.store, d.Type, d.Workspace, d.Name, version, target, true, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notFoundPath(dsType, workspace, name, version, path string) error {
+	return errors.NewStatus(
+		http.StatusNotFound,
+		fmt.Sprintf("Path %q not found in %v %v/%v:%v", path, dsType, workspace, name, version),
+	)
+}
+
+func cleanPath(p string) string {
+	return strings.Trim(p, "/")
+}
+
+// relativePath returns the path relative to the base file or directory.
+func relativePath(p, base string) (string, bool) {
+	if base == "" {
+		return p, true
+	}
+	if p == base {
+		return "", true
+	}
+	if strings.HasPrefix(p, base+"/") {
+		return p[len(base)+1:], true
+	}
+	return "", false
+}
+
+func joinPath(base, rel string) string {
+	if rel == "" {
+		return base
+	}
+	if base == "" {
+		return rel
+	}
+	return base + "/" + rel
+}
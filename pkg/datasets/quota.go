@@ -0,0 +1,245 @@
+package datasets
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+// WorkspaceQuota returns the quota of the workspace in bytes: its own one
+// if set, or the default WORKSPACE_QUOTA otherwise.
+func (m *Manager) WorkspaceQuota(workspace string, master io.PlukClient) (*types.WorkspaceQuota, error) {
+	if master != nil {
+		return master.GetWorkspaceQuota(workspace)
+	}
+	q, err := m.mgr.GetWorkspaceQuota(workspace)
+	if err != nil {
+		return &types.WorkspaceQuota{Bytes: utils.WorkspaceQuota()}, nil
+	}
+	return &types.WorkspaceQuota{Bytes: q.Bytes}, nil
+}
+
+func (m *Manager) SetWorkspaceQuota(workspace string, quota *types.WorkspaceQuota, master io.PlukClient) error {
+	if quota.Bytes < 0 {
+		return errors.NewStatus(http.StatusBadRequest, "Quota must not be negative")
+	}
+	// Quotas are enforced on master only.
+	if master != nil {
+		return master.SetWorkspaceQuota(workspace, quota)
+	}
+	return m.mgr.SaveWorkspaceQuota(&db.WorkspaceQuota{Workspace: workspace, Bytes: quota.Bytes})
+}
+
+func (m *Manager) DeleteWorkspaceQuota(workspace string, master io.PlukClient) error {
+	if master != nil {
+		return master.DeleteWorkspaceQuota(workspace)
+	}
+	return m.mgr.DeleteWorkspaceQuota(workspace)
+}
+
+func (m *Manager) WorkspaceUsage(workspace string, master io.PlukClient) (*types.WorkspaceUsage, error) {
+	if master != nil {
+		return master.GetWorkspaceUsage(workspace)
+	}
+	logical, err := m.mgr.WorkspaceLogicalSize(workspace)
+	if err != nil {
+		return nil, err
+	}
+	unique, shared, err := m.mgr.WorkspacePhysicalSize(workspace)
+	if err != nil {
+		return nil, err
+	}
+	quota, err := m.WorkspaceQuota(workspace, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &types.WorkspaceUsage{
+		Workspace:     workspace,
+		LogicalBytes:  logical,
+		PhysicalBytes: unique,
+		SharedBytes:   shared,
+		QuotaBytes:    quota.Bytes,
+	}, nil
+}
+
+// uploads are the bytes of chunks uploaded to workspaces which are not
+// yet saved in a version. They count against the quota until the file
+// structure is saved, or until the chunk GC may have deleted them.
+type uploads struct {
+	sync.Mutex
+	bytes map[string]int64
+	last  map[string]time.Time
+}
+
+// AddUpload accounts the chunk uploaded to the workspace to its quota
+// until the file structure with it is saved.
+func (m *Manager) AddUpload(workspace string, size int64) {
+	if workspace == "" || size <= 0 {
+		return
+	}
+	m.uploads.Lock()
+	defer m.uploads.Unlock()
+	m.uploads.bytes[workspace] += size
+	m.uploads.last[workspace] = time.Now()
+}
+
+// SavedUploads releases the uploads of the workspace saved in a version,
+// the size is the total size of the saved files.
+func (m *Manager) SavedUploads(workspace string, size int64) {
+	m.uploads.Lock()
+	defer m.uploads.Unlock()
+	if m.uploads.bytes[workspace] <= size {
+		delete(m.uploads.bytes, workspace)
+		delete(m.uploads.last, workspace)
+		return
+	}
+	m.uploads.bytes[workspace] -= size
+}
+
+// pendingUploads returns the unsaved uploads of the workspace. Chunks
+// unreferenced longer than GC_CHUNKS_INTERVAL are deleted, so they are
+// not counted any more.
+func (m *Manager) pendingUploads(workspace string) int64 {
+	m.uploads.Lock()
+	defer m.uploads.Unlock()
+	if time.Since(m.uploads.last[workspace]) > utils.GCChunksInterval() {
+		delete(m.uploads.bytes, workspace)
+		delete(m.uploads.last, workspace)
+		return 0
+	}
+	return m.uploads.bytes[workspace]
+}
+
+// CheckQuota returns 507 error if adding incoming bytes to the workspace
+// exceeds its quota. The check is done on master only; slaves rely on
+// master rejecting the forwarded data.
+func (m *Manager) CheckQuota(workspace string, incoming int64) error {
+	if incoming <= 0 {
+		return nil
+	}
+	limit, err := m.quotaLimit(workspace)
+	if err != nil || limit == 0 {
+		return err
+	}
+	return m.checkLimit(workspace, limit, m.pendingUploads(workspace), incoming)
+}
+
+// QuotasEnabled tells whether quotas are enforced on this instance, so
+// uploads must be accounted to a workspace.
+func (m *Manager) QuotasEnabled() (bool, error) {
+	if m.store.HasMasters() {
+		return false, nil
+	}
+	if utils.WorkspaceQuota() > 0 {
+		return true, nil
+	}
+	return m.mgr.HasWorkspaceQuotas()
+}
+
+// QuotaLeft returns how many bytes the workspace may still grow by,
+// -1 if there is no limit.
+func (m *Manager) QuotaLeft(workspace string) (int64, error) {
+	limit, err := m.quotaLimit(workspace)
+	if err != nil || limit == 0 {
+		return -1, err
+	}
+	used, err := m.mgr.WorkspaceLogicalSize(workspace)
+	if err != nil {
+		return 0, err
+	}
+	used += m.pendingUploads(workspace)
+	if used > limit {
+		return 0, nil
+	}
+	return limit - used, nil
+}
+
+// CheckSaveQuota checks the quota for saving the structure into the version.
+// Uploads of the structure itself are not counted twice.
+func (m *Manager) CheckSaveQuota(d *Dataset, structure types.FileStructure, version string) error {
+	limit, err := m.quotaLimit(d.Workspace)
+	if err != nil || limit == 0 {
+		return err
+	}
+	growth, err := d.SizeGrowth(structure, version)
+	if err != nil || growth <= 0 {
+		return err
+	}
+	pending := m.pendingUploads(d.Workspace) - StructureSize(structure)
+	if pending < 0 {
+		pending = 0
+	}
+	return m.checkLimit(d.Workspace, limit, pending, growth)
+}
+
+// quotaLimit returns the quota enforced on this instance, 0 means no limit.
+func (m *Manager) quotaLimit(workspace string) (int64, error) {
+	if m.store.HasMasters() || workspace == "" {
+		return 0, nil
+	}
+	quota, err := m.WorkspaceQuota(workspace, nil)
+	if err != nil {
+		return 0, err
+	}
+	return quota.Bytes, nil
+}
+
+func (m *Manager) checkLimit(workspace string, limit, pending, incoming int64) error {
+	used, err := m.mgr.WorkspaceLogicalSize(workspace)
+	if err != nil {
+		return err
+	}
+	if used+pending+incoming > limit {
+		return errors.NewStatus(
+			http.StatusInsufficientStorage,
+			fmt.Sprintf(
+				"Workspace %v quota exceeded: %v of %v bytes used, %v bytes uploaded and not saved yet, %v more bytes requested",
+				workspace, used, limit, pending, incoming,
+			),
+		)
+	}
+	return nil
+}
+
+// SizeGrowth returns how much the size of the version grows after saving
+// the structure: files on the same paths are replaced, others are added.
+func (d *Dataset) SizeGrowth(structure types.FileStructure, version string) (int64, error) {
+	files, err := d.mgr.ListFiles(
+		db.File{
+			DatasetType: d.Type,
+			Workspace:   d.Workspace,
+			Version:     version,
+			DatasetName: d.Name,
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	existing := make(map[string]int64)
+	for _, f := range files {
+		existing[f.Path] = f.Size
+	}
+
+	var growth int64 = 0
+	for _, f := range structure.Files {
+		growth += f.Size - existing[f.Path]
+		delete(existing, f.Path)
+	}
+	return growth, nil
+}
+
+// StructureSize is the total size of the files of the structure.
+func StructureSize(structure types.FileStructure) int64 {
+	var size int64 = 0
+	for _, f := range structure.Files {
+		size += f.Size
+	}
+	return size
+}
@@ -0,0 +1,204 @@
+package datasets
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const day = time.Hour * 24
+
+func ValidateRetentionPolicy(policy *types.RetentionPolicy) error {
+	if policy.KeepLast < 0 || policy.KeepDays < 0 || policy.EditingDays < 0 {
+		return errors.NewStatus(http.StatusBadRequest, "Retention values must not be negative")
+	}
+	for _, pattern := range policy.Exclude {
+		// Patterns are stored comma-separated.
+		if strings.Contains(pattern, ",") {
+			return errors.NewStatus(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid exclude pattern %q: must not contain comma", pattern),
+			)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.NewStatus(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid exclude pattern %q: %v", pattern, err),
+			)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) RetentionPolicy(eType, workspace, name string, master io.PlukClient) (*types.RetentionPolicy, error) {
+	if master != nil {
+		return master.GetRetentionPolicy(eType, workspace, name)
+	}
+	p, err := m.mgr.GetRetentionPolicy(eType, workspace, name)
+	if err != nil {
+		return nil, errors.NewStatus(
+			http.StatusNotFound,
+			fmt.Sprintf("%v %v/%v has no retention policy", strings.Title(eType), workspace, name),
+		)
+	}
+	return policyFromDB(p), nil
+}
+
+func (m *Manager) SetRetentionPolicy(eType, workspace, name string,
+	policy *types.RetentionPolicy, master io.PlukClient) error {
+	if err := ValidateRetentionPolicy(policy); err != nil {
+		return err
+	}
+	// Policies are evaluated by GC on master only.
+	if master != nil {
+		return master.SetRetentionPolicy(eType, workspace, name, policy)
+	}
+	return m.mgr.SaveRetentionPolicy(
+		&db.RetentionPolicy{
+			Type:        eType,
+			Workspace:   workspace,
+			Name:        name,
+			KeepLast:    policy.KeepLast,
+			KeepDays:    policy.KeepDays,
+			EditingDays: policy.EditingDays,
+			Exclude:     strings.Join(policy.Exclude, ","),
+		},
+	)
+}
+
+func (m *Manager) DeleteRetentionPolicy(eType, workspace, name string, master io.PlukClient) error {
+	if master != nil {
+		return master.DeleteRetentionPolicy(eType, workspace, name)
+	}
+	return m.mgr.DeleteRetentionPolicy(eType, workspace, name)
+}
+
+// RetentionCandidates lists versions which would be deleted by the retention policy.
+func (m *Manager) RetentionCandidates(eType, workspace, name string, master io.PlukClient) ([]types.Version, error) {
+	if master != nil {
+		list, err := master.RetentionDryRun(eType, workspace, name)
+		if err != nil {
+			return nil, err
+		}
+		return list.Versions, nil
+	}
+	policy, err := m.RetentionPolicy(eType, workspace, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	dsvs, err := m.mgr.ListDatasetVersions(db.DatasetVersion{Type: eType, Workspace: workspace, Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]types.Version, 0)
+	for _, dsv := range retentionCandidates(policy, dsvs, time.Now()) {
+		res = append(res, types.Version{
+			Version:   dsv.Version,
+			CreatedAt: dsv.CreatedAt,
+			UpdatedAt: dsv.UpdatedAt,
+			SizeBytes: dsv.Size,
+			FileCount: dsv.FileCount,
+			Message:   dsv.Message,
+			Workspace: dsv.Workspace,
+			Name:      dsv.Name,
+			DType:     dsv.Type,
+			Editing:   dsv.Editing,
+		})
+	}
+	return res, nil
+}
+
+// ApplyRetentionPolicies moves to trash all versions which are out of
+// the retention policy of their dataset.
+func ApplyRetentionPolicies(mgr db.DataMgr, store *io.Store) {
+	policies, err := mgr.ListRetentionPolicies()
+	if err != nil {
+		logrus.Errorf("[Retention] %v", err)
+		return
+	}
+	m := NewManager(mgr, nil, store)
+	for _, p := range policies {
+		ds, err := m.GetDataset(p.Type, p.Workspace, p.Name, nil)
+		if err != nil {
+			continue
+		}
+		dsvs, err := mgr.ListDatasetVersions(db.DatasetVersion{Type: p.Type, Workspace: p.Workspace, Name: p.Name})
+		if err != nil {
+			logrus.Errorf("[Retention] %v", err)
+			continue
+		}
+		for _, dsv := range retentionCandidates(policyFromDB(p), dsvs, time.Now()) {
+			logrus.Infof("[Retention] Delete %v %v/%v:%v", ds.Type, ds.Workspace, ds.Name, dsv.Version)
+			if err = ds.DeleteVersion(dsv.Version, false); err != nil {
+				logrus.Errorf("[Retention] %v", err)
+			}
+		}
+	}
+}
+
+func retentionCandidates(policy *types.RetentionPolicy, dsvs []*db.DatasetVersion, now time.Time) []*db.DatasetVersion {
+	committed := make([]*db.DatasetVersion, 0)
+	res := make([]*db.DatasetVersion, 0)
+	for _, dsv := range dsvs {
+		if excluded(policy.Exclude, dsv.Version) {
+			continue
+		}
+		if !dsv.Editing {
+			committed = append(committed, dsv)
+			continue
+		}
+		if policy.EditingDays > 0 && now.Sub(dsv.UpdatedAt.Time) >= time.Duration(policy.EditingDays)*day {
+			res = append(res, dsv)
+		}
+	}
+
+	if policy.KeepLast == 0 && policy.KeepDays == 0 {
+		return res
+	}
+
+	// Newest first.
+	sort.SliceStable(committed, func(i, j int) bool {
+		return committed[i].CreatedAt.Time.After(committed[j].CreatedAt.Time)
+	})
+	for i, dsv := range committed {
+		if policy.KeepLast > 0 && i < policy.KeepLast {
+			continue
+		}
+		if policy.KeepDays > 0 && now.Sub(dsv.CreatedAt.Time) < time.Duration(policy.KeepDays)*day {
+			continue
+		}
+		res = append(res, dsv)
+	}
+	return res
+}
+
+func excluded(patterns []string, version string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, version); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func policyFromDB(p *db.RetentionPolicy) *types.RetentionPolicy {
+	policy := &types.RetentionPolicy{
+		KeepLast:    p.KeepLast,
+		KeepDays:    p.KeepDays,
+		EditingDays: p.EditingDays,
+	}
+	if p.Exclude != "" {
+		policy.Exclude = strings.Split(p.Exclude, ",")
+	}
+	return policy
+}
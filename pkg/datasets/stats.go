@@ -0,0 +1,65 @@
+package datasets
+
+import (
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+// StorageStats reports the storage used by the dataset, or by the version if
+// it is given. With perVersion the stats of every version are included as well.
+func (m *Manager) StorageStats(eType, workspace, name, version string,
+	perVersion bool, master io.PlukClient) (*types.StorageStats, error) {
+	if master != nil {
+		return master.GetStorageStats(eType, workspace, name, version, perVersion)
+	}
+
+	stats, err := m.storageStats(eType, workspace, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if !perVersion || version != "" {
+		return stats, nil
+	}
+
+	versions, err := m.mgr.ListDatasetVersions(
+		db.DatasetVersion{Type: eType, Workspace: workspace, Name: name},
+	)
+	if err != nil {
+		return nil, err
+	}
+	stats.Versions = make([]types.StorageStats, 0)
+	for _, v := range versions {
+		if v.TrashedAt != nil {
+			continue
+		}
+		vs, err := m.storageStats(eType, workspace, name, v.Version)
+		if err != nil {
+			return nil, err
+		}
+		stats.Versions = append(stats.Versions, *vs)
+	}
+	return stats, nil
+}
+
+func (m *Manager) storageStats(eType, workspace, name, version string) (*types.StorageStats, error) {
+	s, err := m.mgr.StorageStats(eType, workspace, name, version)
+	if err != nil {
+		return nil, err
+	}
+	stats := &types.StorageStats{
+		Workspace:      workspace,
+		Name:           name,
+		Version:        version,
+		Files:          s.Files,
+		LogicalBytes:   s.LogicalSize,
+		UniqueChunks:   s.Chunks,
+		UniqueBytes:    s.UniqueSize,
+		SharedBytes:    s.SharedSize,
+		ExclusiveBytes: s.UniqueSize - s.SharedSize,
+	}
+	if s.UniqueSize > 0 {
+		stats.DedupRatio = float64(s.LogicalSize) / float64(s.UniqueSize)
+	}
+	return stats, nil
+}
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/sirupsen/logrus"
 )
 
 func WriteTar(fs *plukio.ChunkedFileFS, resp *restful.Response) error {
@@ -1,17 +1,20 @@
 package datasets
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/kuberlab/lib/pkg/errors"
 	"github.com/kuberlab/pluk/pkg/db"
+	plukio "github.com/kuberlab/pluk/pkg/io"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -21,13 +24,25 @@ var (
 
 	ChunkActive   = false
 	ChunkLock     sync.RWMutex
-	chunksDB      = make(chan db.Chunk, 0)
-	chunksTrigger = make(chan db.DataMgr, 10)
-	chunksDeleted = make(chan int64, 10)
-	chunksBuf     = make([]db.Chunk, 0)
+	chunksDB      = make(chan chunkDelete, 0)
+	chunksTrigger = make(chan chunkTrigger, 10)
+	chunksBuf     = make(map[*db.DatabaseMgr][]db.Chunk)
 	deleteBatch   = 250
 )
 
+// Chunks are buffered per database, so servers in one process
+// don't delete chunks of each other.
+type chunkDelete struct {
+	mgr   db.DataMgr
+	chunk db.Chunk
+}
+
+type chunkTrigger struct {
+	mgr     db.DataMgr
+	store   *plukio.Store
+	deleted chan int64
+}
+
 func SendDeletePath(path string) {
 	deleteCh <- path
 }
@@ -35,22 +50,42 @@ func SendDeletePath(path string) {
 func RunDeleteLoop() {
 	lock.Lock()
 	if active {
+		lock.Unlock()
 		return
 	}
 	active = true
 	lock.Unlock()
 	for path := range deleteCh {
-		_ = os.Remove(path)
+		deletePath(path)
+	}
+}
 
-		dirName := filepath.Dir(path)
-		remainFiles, err := ioutil.ReadDir(dirName)
-		if err != nil {
-			//logrus.Error(err)
-		}
+func deletePath(path string) {
+	_ = os.Remove(path)
+
+	dirName := filepath.Dir(path)
+	remainFiles, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		//logrus.Error(err)
+	}
+
+	// If there are no files in this directory, delete it.
+	if len(remainFiles) == 0 {
+		_ = os.RemoveAll(dirName)
+	}
+}
 
-		// If there are no files in this directory, delete it.
-		if len(remainFiles) == 0 {
-			_ = os.RemoveAll(dirName)
+// FlushDeletes deletes the queued chunk files until the context is done.
+// It is called on shutdown when no more deletes are coming.
+func FlushDeletes(ctx context.Context) error {
+	for {
+		select {
+		case path := <-deleteCh:
+			deletePath(path)
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			return nil
 		}
 	}
 }
@@ -58,6 +93,7 @@ func RunDeleteLoop() {
 func RunChunkDBDeleteLoop() {
 	ChunkLock.Lock()
 	if ChunkActive {
+		ChunkLock.Unlock()
 		return
 	}
 	ChunkActive = true
@@ -65,41 +101,44 @@ func RunChunkDBDeleteLoop() {
 	//ticker := time.NewTicker(time.Second * 15)
 	for {
 		select {
-		case chunk := <-chunksDB:
+		case c := <-chunksDB:
 			//
 			//fmt.Println("receive id ", chunk.ID)
-			chunksBuf = append(chunksBuf, chunk)
-		case mgr := <-chunksTrigger:
+			root := c.mgr.Root()
+			chunksBuf[root] = append(chunksBuf[root], c.chunk)
+		case t := <-chunksTrigger:
 			var deleted int64 = 0
-			if len(chunksBuf) != 0 {
+			buf := chunksBuf[t.mgr.Root()]
+			if len(buf) != 0 {
 				// Flush buffer and delete chunks
 				// chunk buffer into smaller slices
 				chunkSize := deleteBatch
 
-				for i := 0; i < len(chunksBuf); i += chunkSize {
+				for i := 0; i < len(buf); i += chunkSize {
 					end := i + chunkSize
 
-					if end > len(chunksBuf) {
-						end = len(chunksBuf)
+					if end > len(buf) {
+						end = len(buf)
 					}
 
-					deleted += deleteChunks(mgr, chunksBuf[i:end])
+					deleted += deleteChunks(t.mgr, t.store, buf[i:end])
 				}
 
 				//deleteChunks(mgr, chunksBuf)
-				chunksBuf = nil
+				delete(chunksBuf, t.mgr.Root())
 			}
-			chunksDeleted <- deleted
+			t.deleted <- deleted
 		}
 	}
 }
 
-func TriggerDeleteChunks(mgr db.DataMgr) int64 {
-	chunksTrigger <- mgr
-	return <-chunksDeleted
+func TriggerDeleteChunks(mgr db.DataMgr, store *plukio.Store) int64 {
+	t := chunkTrigger{mgr: mgr, store: store, deleted: make(chan int64, 1)}
+	chunksTrigger <- t
+	return <-t.deleted
 }
 
-func deleteChunks(mgr db.DataMgr, chunks []db.Chunk) int64 {
+func deleteChunks(mgr db.DataMgr, store *plukio.Store, chunks []db.Chunk) int64 {
 	fileChunks, err := mgr.ListFileChunksByChunks(chunks)
 	if err != nil {
 		logrus.Error(err)
@@ -120,7 +159,7 @@ func deleteChunks(mgr db.DataMgr, chunks []db.Chunk) int64 {
 	deleteChunks := make([]db.Chunk, 0)
 	for _, chunk := range chunkMap {
 		deleteChunks = append(deleteChunks, chunk)
-		path := utils.GetHashedFilename(chunk.Hash, chunk.Version)
+		path := store.ChunkPath(chunk.Hash, chunk.Version)
 
 		// Send to delete
 		deleteCh <- path
@@ -132,7 +171,7 @@ func deleteChunks(mgr db.DataMgr, chunks []db.Chunk) int64 {
 	return int64(len(deleteChunks))
 }
 
-func DeleteFiles(mgr db.DataMgr, eType, ws, dataset, version, prefix string, preciseName, strict bool) error {
+func DeleteFiles(mgr db.DataMgr, store *plukio.Store, eType, ws, dataset, version, prefix string, preciseName, strict bool) error {
 	rawFiles, err := mgr.GetRawFiles(eType, ws, dataset, version, prefix, "", preciseName)
 	if err != nil {
 		return err
@@ -163,7 +202,7 @@ func DeleteFiles(mgr db.DataMgr, eType, ws, dataset, version, prefix string, pre
 		//	deleted++
 		//}
 	}
-	deleted := TriggerDeleteChunks(mgr)
+	deleted := TriggerDeleteChunks(mgr, store)
 	if deleted != 0 {
 		logrus.Infof("Deleted %v chunks.", deleted)
 	}
@@ -171,7 +210,7 @@ func DeleteFiles(mgr db.DataMgr, eType, ws, dataset, version, prefix string, pre
 }
 
 func CheckAndDeleteChunk(mgr db.DataMgr, chunk *db.Chunk) {
-	chunksDB <- *chunk
+	chunksDB <- chunkDelete{mgr: mgr, chunk: *chunk}
 	// See if there are more connections on this chunk
 	//deleted := false
 	//remain, err := mgr.ListFileChunks(db.FileChunk{ChunkID: chunk.ID})
@@ -191,3 +230,31 @@ func CheckAndDeleteChunk(mgr db.DataMgr, chunk *db.Chunk) {
 	//}
 	//return deleted
 }
+
+// trashTime returns the moment the item is moved to trash;
+// nil means the item must be purged immediately.
+func trashTime(force bool) *time.Time {
+	if force {
+		return nil
+	}
+	now := time.Now().UTC()
+	return &now
+}
+
+// trashedTogether reports whether the version was moved to trash
+// along with its dataset rather than before it.
+func trashedTogether(version, dataset *time.Time) bool {
+	if version == nil || dataset == nil {
+		return version == dataset
+	}
+	return !version.Before(*dataset)
+}
+
+// TrashExpired reports whether the deleted item can be purged.
+// Slaves keep only a copy of master data, so their trash is never retained.
+func TrashExpired(store *plukio.Store, trashedAt *time.Time) bool {
+	if trashedAt == nil || store.HasMasters() {
+		return true
+	}
+	return time.Since(*trashedAt) >= utils.TrashRetention()
+}
@@ -0,0 +1,63 @@
+package db
+
+type ACLMgr interface {
+	SaveEntityACL(acl *EntityACL) error
+	GetEntityACL(dsType, workspace, name string) (*EntityACL, error)
+	ListEntityACLs() ([]*EntityACL, error)
+	DeleteEntityACL(dsType, workspace, name string) error
+	ListChunkEntities(hash string) ([]*Dataset, error)
+}
+
+// EntityACL is the access control list of the dataset or, if the name is
+// empty, the default one for all datasets of the workspace.
+type EntityACL struct {
+	BaseModel
+	ID        uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Type      string `json:"type" gorm:"index:idx_acl_ws_name_type"`
+	Workspace string `json:"workspace" gorm:"index:idx_acl_ws_name_type"`
+	Name      string `json:"name" gorm:"index:idx_acl_ws_name_type"`
+	Owner     string `json:"owner"`
+	// Readers and Writers are comma-separated lists of user names.
+	Readers    string `json:"readers"`
+	Writers    string `json:"writers"`
+	PublicRead bool   `json:"public_read"`
+}
+
+func (mgr *DatabaseMgr) SaveEntityACL(acl *EntityACL) error {
+	err := mgr.DeleteEntityACL(acl.Type, acl.Workspace, acl.Name)
+	if err != nil {
+		return err
+	}
+	return mgr.db.Create(acl).Error
+}
+
+func (mgr *DatabaseMgr) GetEntityACL(dsType, workspace, name string) (*EntityACL, error) {
+	var acl = EntityACL{}
+	err := mgr.db.Where("type = ? AND workspace = ? AND name = ?", dsType, workspace, name).First(&acl).Error
+	return &acl, err
+}
+
+func (mgr *DatabaseMgr) ListEntityACLs() ([]*EntityACL, error) {
+	var acls = make([]*EntityACL, 0)
+	err := mgr.db.Find(&acls).Error
+	return acls, err
+}
+
+func (mgr *DatabaseMgr) DeleteEntityACL(dsType, workspace, name string) error {
+	sql := "DELETE FROM entity_acls WHERE type=? AND workspace=? AND name=?"
+	return mgr.db.Exec(sql, dsType, workspace, name).Error
+}
+
+// ListChunkEntities returns datasets which have files containing the chunk.
+func (mgr *DatabaseMgr) ListChunkEntities(hash string) ([]*Dataset, error) {
+	var datasets = make([]*Dataset, 0)
+	err := mgr.db.Raw(
+		`SELECT DISTINCT files.dataset_type AS type, files.workspace AS workspace, files.dataset_name AS name
+		FROM files
+		JOIN file_chunks ON file_chunks.file_id = files.id
+		JOIN chunks ON chunks.id = file_chunks.chunk_id
+		WHERE chunks.hash = ?`,
+		hash,
+	).Scan(&datasets).Error
+	return datasets, err
+}
@@ -0,0 +1,58 @@
+package db
+
+import "time"
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+type AuditMgr interface {
+	CreateAuditRecord(record *AuditRecord) error
+	ListAuditRecords(filter AuditFilter) ([]*AuditRecord, error)
+}
+
+// AuditRecord is the record of the mutating operation.
+type AuditRecord struct {
+	ID         uint      `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"time" gorm:"index:idx_audit_time"`
+	Actor      string    `json:"actor" gorm:"index:idx_audit_actor"`
+	RemoteAddr string    `json:"remote_addr"`
+	Action     string    `json:"action" gorm:"index:idx_audit_action"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Workspace  string    `json:"workspace" gorm:"index:idx_audit_ws_name"`
+	EntityType string    `json:"entity_type"`
+	Name       string    `json:"name" gorm:"index:idx_audit_ws_name"`
+	Version    string    `json:"version"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+}
+
+// AuditFilter selects audit records, empty fields match any value.
+type AuditFilter struct {
+	AuditRecord
+	Since *time.Time
+	Until *time.Time
+	Limit int
+}
+
+func (mgr *DatabaseMgr) CreateAuditRecord(record *AuditRecord) error {
+	return mgr.db.Create(record).Error
+}
+
+func (mgr *DatabaseMgr) ListAuditRecords(filter AuditFilter) ([]*AuditRecord, error) {
+	var records = make([]*AuditRecord, 0)
+	q := mgr.db.Where(filter.AuditRecord)
+	if filter.Since != nil {
+		q = q.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		q = q.Where("created_at < ?", *filter.Until)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	err := q.Order("id desc").Find(&records).Error
+	return records, err
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/kuberlab/lib/pkg/types"
 )
 
@@ -14,6 +16,7 @@ type DatasetVersionMgr interface {
 	DeleteDatasetVersion(id uint) error
 	RecoverDatasetVersion(dsv *DatasetVersion) error
 	CommitVersion(dsType, workspace, name, version, message string) (*DatasetVersion, error)
+	ReopenVersion(dsType, workspace, name, version string) (*DatasetVersion, error)
 	UpdateDatasetVersionSize(dsType, workspace, name, version string) error
 	UpdateDatasetVersionDate(dsType, workspace, name, version string, date types.Time) error
 }
@@ -30,6 +33,9 @@ type DatasetVersion struct {
 	FileCount int64  `json:"file_count"`
 	Deleted   bool   `json:"deleted"`
 	Editing   bool   `json:"editing"`
+	// TrashedAt is set when the version is moved to trash; nil means
+	// it is purged by the next GC run.
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
 }
 
 func (mgr *DatabaseMgr) CreateDatasetVersion(datasetVersion *DatasetVersion) error {
@@ -42,7 +48,7 @@ func (mgr *DatabaseMgr) UpdateDatasetVersion(datasetVersion *DatasetVersion) (*D
 }
 
 func (mgr *DatabaseMgr) RecoverDatasetVersion(dsv *DatasetVersion) error {
-	sql := "UPDATE dataset_versions SET deleted=? where name=? AND type=? AND workspace=? AND version=?"
+	sql := "UPDATE dataset_versions SET deleted=?, trashed_at=NULL where name=? AND type=? AND workspace=? AND version=?"
 	return mgr.db.Exec(sql, false, dsv.Name, dsv.Type, dsv.Workspace, dsv.Version).Error
 }
 
@@ -104,6 +110,17 @@ func (mgr *DatabaseMgr) CommitVersion(dsType, workspace, name, version, message
 	return mgr.GetDatasetVersion(dsType, workspace, name, version)
 }
 
+func (mgr *DatabaseMgr) ReopenVersion(dsType, workspace, name, version string) (*DatasetVersion, error) {
+	err := mgr.db.Exec(
+		"UPDATE dataset_versions SET editing=? WHERE workspace=? AND name=? AND version=? AND type=?",
+		true, workspace, name, version, dsType,
+	).Error
+	if err != nil {
+		return nil, err
+	}
+	return mgr.GetDatasetVersion(dsType, workspace, name, version)
+}
+
 func (mgr *DatabaseMgr) UpdateDatasetVersionSize(dsType, workspace, name, version string) error {
 	sql := `UPDATE dataset_versions
 	SET
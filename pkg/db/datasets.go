@@ -1,9 +1,12 @@
 package db
 
+import "time"
+
 type DatasetMgr interface {
 	CreateDataset(dataset *Dataset) error
 	UpdateDataset(dataset *Dataset) (*Dataset, error)
 	RecoverDataset(dataset *Dataset) error
+	RenameDataset(dsType, workspace, name, newWorkspace, newName string) error
 	GetDataset(dsType, workspace, name string) (*Dataset, error)
 	GetDatasetByID(datasetID uint) (*Dataset, error)
 	ListDatasets(filter Dataset) ([]*Dataset, error)
@@ -17,6 +20,9 @@ type Dataset struct {
 	Name      string `json:"name"`
 	Type      string `json:"type" gorm:"index:idx_workspace_type"`
 	Deleted   bool   `json:"deleted"`
+	// TrashedAt is set when the dataset is moved to trash; nil means
+	// it is purged by the next GC run.
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
 }
 
 func (mgr *DatabaseMgr) CreateDataset(dataset *Dataset) error {
@@ -29,10 +35,29 @@ func (mgr *DatabaseMgr) UpdateDataset(dataset *Dataset) (*Dataset, error) {
 }
 
 func (mgr *DatabaseMgr) RecoverDataset(dataset *Dataset) error {
-	sql := "UPDATE datasets SET deleted=? where name=? AND type=? AND workspace=?"
+	sql := "UPDATE datasets SET deleted=?, trashed_at=NULL where name=? AND type=? AND workspace=?"
 	return mgr.db.Exec(sql, false, dataset.Name, dataset.Type, dataset.Workspace).Error
 }
 
+// RenameDataset moves the dataset with all its versions and files to the new workspace and name.
+// Version manifests are dropped since they are signed along with the old name.
+func (mgr *DatabaseMgr) RenameDataset(dsType, workspace, name, newWorkspace, newName string) error {
+	updates := []string{
+		"UPDATE datasets SET workspace=?, name=? WHERE workspace=? AND name=? AND type=?",
+		"UPDATE dataset_versions SET workspace=?, name=? WHERE workspace=? AND name=? AND type=?",
+		"UPDATE files SET workspace=?, dataset_name=? WHERE workspace=? AND dataset_name=? AND dataset_type=?",
+		"UPDATE retention_policies SET workspace=?, name=? WHERE workspace=? AND name=? AND type=?",
+		"UPDATE entity_acls SET workspace=?, name=? WHERE workspace=? AND name=? AND type=?",
+	}
+	for _, sql := range updates {
+		if err := mgr.db.Exec(sql, newWorkspace, newName, workspace, name, dsType).Error; err != nil {
+			return err
+		}
+	}
+	sql := "DELETE FROM version_manifests WHERE workspace=? AND name=? AND type=?"
+	return mgr.db.Exec(sql, workspace, name, dsType).Error
+}
+
 func (mgr *DatabaseMgr) GetDataset(dsType, workspace, name string) (*Dataset, error) {
 	var dataset = Dataset{}
 	err := mgr.db.First(&dataset, Dataset{Type: dsType, Workspace: workspace, Name: name}).Error
@@ -6,12 +6,14 @@ import (
 	"github.com/kuberlab/pluk/pkg/utils"
 )
 
+var testMgr *DatabaseMgr
+
 func setup() {
-	DbMgr = NewFakeDatabaseMgr(":memory:")
+	testMgr = NewFakeDatabaseMgr(":memory:")
 }
 
 func teardown() {
-	DbMgr.Close()
+	testMgr.Close()
 }
 
 func TestCreateDataset(t *testing.T) {
@@ -21,7 +23,7 @@ func TestCreateDataset(t *testing.T) {
 		Workspace: "workspace",
 		Name:      "dataset",
 	}
-	err := DbMgr.CreateDataset(ds)
+	err := testMgr.CreateDataset(ds)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -11,8 +11,6 @@ import (
 	"github.com/kuberlab/pluk/pkg/utils"
 )
 
-var DbMgr DataMgr
-
 type DataMgr interface {
 	// All models DB interfaces here.
 	AuthMgr
@@ -21,26 +19,38 @@ type DataMgr interface {
 	DatasetVersionMgr
 	FileChunkMgr
 	FileMgr
+	VersionManifestMgr
+	RetentionPolicyMgr
+	JobMgr
+	QuotaMgr
+	StatsMgr
+	AuditMgr
+	TokenMgr
+	ACLMgr
 	DB() *gorm.DB
 	DBType() string
 	Begin() *DatabaseMgr
 	Commit() *DatabaseMgr
 	Rollback() *DatabaseMgr
+	Root() *DatabaseMgr
 	Close() error
 }
 type DatabaseMgr struct {
 	db     *gorm.DB
 	dbType string
+	root   *DatabaseMgr
 }
 
 func (mgr *DatabaseMgr) Close() error {
 	return mgr.db.Close()
 }
 func NewDatabaseMgr(db *gorm.DB) *DatabaseMgr {
-	return &DatabaseMgr{
+	mgr := &DatabaseMgr{
 		db:     db,
 		dbType: utils.DBType(),
 	}
+	mgr.root = mgr
+	return mgr
 }
 
 func NewMainDatabaseMgr() *DatabaseMgr {
@@ -64,10 +74,17 @@ func (mgr *DatabaseMgr) DBType() string {
 	return mgr.dbType
 }
 
+// Root returns the manager of the database outside of transactions,
+// it identifies the database.
+func (mgr *DatabaseMgr) Root() *DatabaseMgr {
+	return mgr.root
+}
+
 func (mgr *DatabaseMgr) Begin() *DatabaseMgr {
 	return &DatabaseMgr{
 		db:     mgr.db.Begin(),
 		dbType: mgr.dbType,
+		root:   mgr.root,
 	}
 }
 
@@ -75,6 +92,7 @@ func (mgr *DatabaseMgr) Commit() *DatabaseMgr {
 	return &DatabaseMgr{
 		db:     mgr.db.Commit(),
 		dbType: mgr.dbType,
+		root:   mgr.root,
 	}
 }
 
@@ -82,5 +100,6 @@ func (mgr *DatabaseMgr) Rollback() *DatabaseMgr {
 	return &DatabaseMgr{
 		db:     mgr.db.Rollback(),
 		dbType: mgr.dbType,
+		root:   mgr.root,
 	}
 }
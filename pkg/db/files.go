@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/kuberlab/lib/pkg/types"
 )
@@ -17,6 +18,7 @@ type FileMgr interface {
 	GetFile(workspace, dataset, dsType, path, version string) (*File, error)
 	ListFiles(filter File) ([]*File, error)
 	DeleteFile(id uint) error
+	MoveFiles(dsType, workspace, dataset, version, from, to string) (int64, error)
 }
 
 type File struct {
@@ -218,3 +220,39 @@ func (mgr *DatabaseMgr) ListFiles(filter File) ([]*File, error) {
 func (mgr *DatabaseMgr) DeleteFile(id uint) error {
 	return mgr.db.Delete(File{}, File{ID: id}).Error
 }
+
+// MoveFiles renames the file at path "from" or all the files under "from" directory
+// so that they are placed at "to" path. New paths are built here rather than in SQL
+// since neither concatenation nor LIKE escaping is portable between the databases.
+func (mgr *DatabaseMgr) MoveFiles(dsType, workspace, dataset, version, from, to string) (int64, error) {
+	now := types.NewTime(time.Now())
+	prefix := from + "/"
+	files := make([]*File, 0)
+	err := mgr.db.Select("id, path").Where(
+		"workspace=? AND dataset_name=? AND dataset_type=? AND version=? AND (path=? OR SUBSTR(path, 1, ?)=?)",
+		workspace, dataset, dsType, version, from, utf8.RuneCountInString(prefix), prefix,
+	).Find(&files).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for _, f := range files {
+		var path string
+		switch {
+		case f.Path == from:
+			path = to
+		case strings.HasPrefix(f.Path, prefix):
+			path = to + f.Path[len(from):]
+		default:
+			// Case-insensitive collations match more.
+			continue
+		}
+		res := mgr.db.Model(File{}).Where("id=?", f.ID).Updates(map[string]interface{}{"path": path, "updated_at": now})
+		if res.Error != nil {
+			return rows, res.Error
+		}
+		rows += res.RowsAffected
+	}
+	return rows, nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import "time"
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+type JobMgr interface {
+	CreateJob(job *Job) error
+	UpdateJob(job *Job) error
+	GetJob(id uint) (*Job, error)
+	ListJobs(filter Job) ([]*Job, error)
+	FailUnfinishedJobs(reason string) error
+}
+
+// Job is the record of the long-running operation run in background.
+type Job struct {
+	BaseModel
+	ID         uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Type       string `json:"type" gorm:"index:idx_job_type"`
+	State      string `json:"state"`
+	Workspace  string `json:"workspace" gorm:"index:idx_job_ws"`
+	Name       string `json:"name"`
+	EntityType string `json:"entity_type"`
+	Target     string `json:"target"`
+	Done       int64  `json:"done"`
+	Total      int64  `json:"total"`
+	Error      string `json:"error"`
+	// Result is the JSON-encoded result of the job.
+	Result     string     `json:"result"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (mgr *DatabaseMgr) CreateJob(job *Job) error {
+	return mgr.db.Create(job).Error
+}
+
+func (mgr *DatabaseMgr) UpdateJob(job *Job) error {
+	return mgr.db.Save(job).Error
+}
+
+func (mgr *DatabaseMgr) GetJob(id uint) (*Job, error) {
+	var job = Job{}
+	err := mgr.db.First(&job, Job{ID: id}).Error
+	return &job, err
+}
+
+func (mgr *DatabaseMgr) ListJobs(filter Job) ([]*Job, error) {
+	var jobs = make([]*Job, 0)
+	err := mgr.db.Where(filter).Order("id desc").Find(&jobs).Error
+	return jobs, err
+}
+
+// FailUnfinishedJobs marks jobs left pending or running by the previous process as failed.
+func (mgr *DatabaseMgr) FailUnfinishedJobs(reason string) error {
+	sql := "UPDATE jobs SET state=?, error=?, finished_at=? WHERE state IN (?, ?)"
+	return mgr.db.Exec(sql, JobFailed, reason, time.Now(), JobPending, JobRunning).Error
+}
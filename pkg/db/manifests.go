@@ -0,0 +1,45 @@
+package db
+
+type VersionManifestMgr interface {
+	SaveVersionManifest(manifest *VersionManifest) error
+	GetVersionManifest(dsType, workspace, name, version string) (*VersionManifest, error)
+	DeleteVersionManifest(dsType, workspace, name, version string) error
+}
+
+// VersionManifest keeps the signature of the version manifest made at commit time.
+type VersionManifest struct {
+	BaseModel
+	ID        uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Workspace string `json:"workspace" gorm:"index:idx_manifest_ws_name_version_type"`
+	Name      string `json:"name" gorm:"index:idx_manifest_ws_name_version_type"`
+	Version   string `json:"version" gorm:"index:idx_manifest_ws_name_version_type"`
+	Type      string `json:"type" gorm:"index:idx_manifest_ws_name_version_type"`
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+func (mgr *DatabaseMgr) SaveVersionManifest(manifest *VersionManifest) error {
+	err := mgr.DeleteVersionManifest(manifest.Type, manifest.Workspace, manifest.Name, manifest.Version)
+	if err != nil {
+		return err
+	}
+	return mgr.db.Create(manifest).Error
+}
+
+func (mgr *DatabaseMgr) GetVersionManifest(dsType, workspace, name, version string) (*VersionManifest, error) {
+	var manifest = VersionManifest{}
+	err := mgr.db.First(
+		&manifest,
+		VersionManifest{Type: dsType, Workspace: workspace, Name: name, Version: version},
+	).Error
+	return &manifest, err
+}
+
+func (mgr *DatabaseMgr) DeleteVersionManifest(dsType, workspace, name, version string) error {
+	return mgr.db.Delete(
+		VersionManifest{},
+		VersionManifest{Type: dsType, Workspace: workspace, Name: name, Version: version},
+	).Error
+}
@@ -5,9 +5,9 @@ to migrate database state.
 package db
 
 import (
-	"github.com/sirupsen/logrus"
 	"github.com/jinzhu/gorm"
 	"github.com/kuberlab/lib/pkg/types"
+	"github.com/sirupsen/logrus"
 )
 
 // BaseModel is the basic type for all other models
@@ -28,6 +28,14 @@ func CreateTables(db *gorm.DB) error {
 		&Dataset{},
 		&DatasetVersion{},
 		&Auth{},
+		&VersionManifest{},
+		&RetentionPolicy{},
+		&Job{},
+		&WorkspaceQuota{},
+		&AuditRecord{},
+		&User{},
+		&Token{},
+		&EntityACL{},
 	).Error
 }
 
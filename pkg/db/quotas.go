@@ -0,0 +1,90 @@
+package db
+
+import "fmt"
+
+type QuotaMgr interface {
+	SaveWorkspaceQuota(quota *WorkspaceQuota) error
+	GetWorkspaceQuota(workspace string) (*WorkspaceQuota, error)
+	DeleteWorkspaceQuota(workspace string) error
+	HasWorkspaceQuotas() (bool, error)
+	WorkspaceLogicalSize(workspace string) (int64, error)
+	WorkspacePhysicalSize(workspace string) (unique int64, shared int64, err error)
+}
+
+// WorkspaceQuota overrides the default storage quota for the workspace.
+type WorkspaceQuota struct {
+	BaseModel
+	ID        uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Workspace string `json:"workspace" gorm:"unique_index:idx_quota_ws"`
+	// Bytes is the maximum logical size of the workspace, 0 means unlimited.
+	Bytes int64 `json:"bytes"`
+}
+
+type sizeResult struct {
+	Size int64
+}
+
+func (mgr *DatabaseMgr) SaveWorkspaceQuota(quota *WorkspaceQuota) error {
+	err := mgr.DeleteWorkspaceQuota(quota.Workspace)
+	if err != nil {
+		return err
+	}
+	return mgr.db.Create(quota).Error
+}
+
+func (mgr *DatabaseMgr) GetWorkspaceQuota(workspace string) (*WorkspaceQuota, error) {
+	var quota = WorkspaceQuota{}
+	err := mgr.db.First(&quota, WorkspaceQuota{Workspace: workspace}).Error
+	return &quota, err
+}
+
+func (mgr *DatabaseMgr) DeleteWorkspaceQuota(workspace string) error {
+	return mgr.db.Delete(WorkspaceQuota{}, WorkspaceQuota{Workspace: workspace}).Error
+}
+
+// HasWorkspaceQuotas tells whether any workspace has its own limit.
+func (mgr *DatabaseMgr) HasWorkspaceQuotas() (bool, error) {
+	var count int
+	err := mgr.db.Model(&WorkspaceQuota{}).Where("bytes > 0").Count(&count).Error
+	return count > 0, err
+}
+
+// WorkspaceLogicalSize returns the sum of sizes of all versions in the workspace,
+// including the trashed ones which still hold the storage until purged.
+func (mgr *DatabaseMgr) WorkspaceLogicalSize(workspace string) (int64, error) {
+	var res = sizeResult{}
+	err := mgr.db.Raw(
+		"SELECT COALESCE(SUM(size), 0) AS size FROM dataset_versions WHERE workspace = ?",
+		workspace,
+	).Scan(&res).Error
+	return res.Size, err
+}
+
+// WorkspacePhysicalSize returns the size of deduplicated chunks referenced by
+// the workspace: unique are referenced only by this workspace, shared are
+// referenced by other workspaces as well.
+func (mgr *DatabaseMgr) WorkspacePhysicalSize(workspace string) (unique int64, shared int64, err error) {
+	sql := `SELECT COALESCE(SUM(chunks.size), 0) AS size FROM chunks
+	WHERE chunks.id IN (
+		SELECT file_chunks.chunk_id FROM file_chunks
+		JOIN files ON files.id = file_chunks.file_id
+		WHERE files.workspace = ?
+	) AND chunks.id %v (
+		SELECT file_chunks.chunk_id FROM file_chunks
+		JOIN files ON files.id = file_chunks.file_id
+		WHERE files.workspace <> ?
+	)`
+	var res = sizeResult{}
+	err = mgr.db.Raw(fmt.Sprintf(sql, "NOT IN"), workspace, workspace).Scan(&res).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	unique = res.Size
+
+	res = sizeResult{}
+	err = mgr.db.Raw(fmt.Sprintf(sql, "IN"), workspace, workspace).Scan(&res).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return unique, res.Size, nil
+}
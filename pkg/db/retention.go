@@ -0,0 +1,52 @@
+package db
+
+type RetentionPolicyMgr interface {
+	SaveRetentionPolicy(policy *RetentionPolicy) error
+	GetRetentionPolicy(dsType, workspace, name string) (*RetentionPolicy, error)
+	ListRetentionPolicies() ([]*RetentionPolicy, error)
+	DeleteRetentionPolicy(dsType, workspace, name string) error
+}
+
+// RetentionPolicy describes which versions of the dataset are deleted automatically.
+type RetentionPolicy struct {
+	BaseModel
+	ID          uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Workspace   string `json:"workspace" gorm:"index:idx_retention_ws_name_type"`
+	Name        string `json:"name" gorm:"index:idx_retention_ws_name_type"`
+	Type        string `json:"type" gorm:"index:idx_retention_ws_name_type"`
+	KeepLast    int    `json:"keep_last"`
+	KeepDays    int    `json:"keep_days"`
+	EditingDays int    `json:"editing_days"`
+	// Exclude is a comma-separated list of version patterns.
+	Exclude string `json:"exclude"`
+}
+
+func (mgr *DatabaseMgr) SaveRetentionPolicy(policy *RetentionPolicy) error {
+	err := mgr.DeleteRetentionPolicy(policy.Type, policy.Workspace, policy.Name)
+	if err != nil {
+		return err
+	}
+	return mgr.db.Create(policy).Error
+}
+
+func (mgr *DatabaseMgr) GetRetentionPolicy(dsType, workspace, name string) (*RetentionPolicy, error) {
+	var policy = RetentionPolicy{}
+	err := mgr.db.First(
+		&policy,
+		RetentionPolicy{Type: dsType, Workspace: workspace, Name: name},
+	).Error
+	return &policy, err
+}
+
+func (mgr *DatabaseMgr) ListRetentionPolicies() ([]*RetentionPolicy, error) {
+	var policies = make([]*RetentionPolicy, 0)
+	err := mgr.db.Find(&policies).Error
+	return policies, err
+}
+
+func (mgr *DatabaseMgr) DeleteRetentionPolicy(dsType, workspace, name string) error {
+	return mgr.db.Delete(
+		RetentionPolicy{},
+		RetentionPolicy{Type: dsType, Workspace: workspace, Name: name},
+	).Error
+}
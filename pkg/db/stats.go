@@ -0,0 +1,65 @@
+package db
+
+import "fmt"
+
+type StatsMgr interface {
+	StorageStats(dsType, workspace, name, version string) (*StorageStats, error)
+}
+
+// StorageStats describes the storage used by files of the dataset or,
+// if the version is given, of the single version. Chunks are counted once;
+// shared chunks are also referenced by files outside of the dataset or version.
+type StorageStats struct {
+	Files       int64
+	LogicalSize int64
+	Chunks      int64
+	UniqueSize  int64
+	SharedSize  int64
+}
+
+// StorageStats computes the storage stats for the dataset. Empty version
+// means the whole dataset including versions in trash.
+func (mgr *DatabaseMgr) StorageStats(dsType, workspace, name, version string) (*StorageStats, error) {
+	scope := "%[1]v.dataset_type = ? AND %[1]v.workspace = ? AND %[1]v.dataset_name = ?"
+	args := []interface{}{dsType, workspace, name}
+	if version != "" {
+		scope += " AND %[1]v.version = ?"
+		args = append(args, version)
+	}
+
+	var files = StorageStats{}
+	err := mgr.db.Raw(
+		"SELECT COUNT(*) AS files, COALESCE(SUM(files.size), 0) AS logical_size FROM files WHERE "+
+			fmt.Sprintf(scope, "files"),
+		args...,
+	).Scan(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `SELECT COUNT(*) AS chunks,
+	COALESCE(SUM(chunks.size), 0) AS unique_size,
+	COALESCE(SUM(CASE WHEN EXISTS (
+		SELECT 1 FROM file_chunks AS other_chunks
+		JOIN files AS others ON others.id = other_chunks.file_id
+		WHERE other_chunks.chunk_id = chunks.id AND NOT (%v)
+	) THEN chunks.size ELSE 0 END), 0) AS shared_size
+	FROM chunks
+	WHERE chunks.id IN (
+		SELECT file_chunks.chunk_id FROM file_chunks
+		JOIN files ON files.id = file_chunks.file_id
+		WHERE %v
+	)`
+	var chunks = StorageStats{}
+	err = mgr.db.Raw(
+		fmt.Sprintf(sql, fmt.Sprintf(scope, "others"), fmt.Sprintf(scope, "files")),
+		append(args, args...)...,
+	).Scan(&chunks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	chunks.Files = files.Files
+	chunks.LogicalSize = files.LogicalSize
+	return &chunks, nil
+}
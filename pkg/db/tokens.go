@@ -0,0 +1,78 @@
+package db
+
+import "time"
+
+type TokenMgr interface {
+	CreateUser(user *User) error
+	GetUser(name string) (*User, error)
+	ListUsers() ([]*User, error)
+	DeleteUser(name string) error
+	CreateToken(token *Token) error
+	GetTokenByHash(hash string) (*Token, error)
+	ListTokens(filter Token) ([]*Token, error)
+	DeleteToken(id uint) error
+}
+
+// User is the user of the built-in authentication.
+type User struct {
+	BaseModel
+	ID    uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	Name  string `json:"name" gorm:"unique_index:idx_user_name"`
+	Admin bool   `json:"admin"`
+}
+
+// Token is the API token of the user. Only the hash of the token is stored.
+type Token struct {
+	BaseModel
+	ID   uint   `json:"id" sql:"AUTO_INCREMENT" gorm:"primary_key"`
+	User string `json:"user" gorm:"index:idx_token_user"`
+	Name string `json:"name"`
+	Hash string `json:"-" gorm:"unique_index:idx_token_hash"`
+	// Scopes is a comma-separated list of workspace:access pairs.
+	Scopes    string     `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (mgr *DatabaseMgr) CreateUser(user *User) error {
+	return mgr.db.Create(user).Error
+}
+
+func (mgr *DatabaseMgr) GetUser(name string) (*User, error) {
+	var user = User{}
+	err := mgr.db.First(&user, User{Name: name}).Error
+	return &user, err
+}
+
+func (mgr *DatabaseMgr) ListUsers() ([]*User, error) {
+	var users = make([]*User, 0)
+	err := mgr.db.Order("name").Find(&users).Error
+	return users, err
+}
+
+// DeleteUser deletes the user with all its tokens.
+func (mgr *DatabaseMgr) DeleteUser(name string) error {
+	if err := mgr.db.Delete(Token{}, Token{User: name}).Error; err != nil {
+		return err
+	}
+	return mgr.db.Delete(User{}, User{Name: name}).Error
+}
+
+func (mgr *DatabaseMgr) CreateToken(token *Token) error {
+	return mgr.db.Create(token).Error
+}
+
+func (mgr *DatabaseMgr) GetTokenByHash(hash string) (*Token, error) {
+	var token = Token{}
+	err := mgr.db.First(&token, Token{Hash: hash}).Error
+	return &token, err
+}
+
+func (mgr *DatabaseMgr) ListTokens(filter Token) ([]*Token, error) {
+	var tokens = make([]*Token, 0)
+	err := mgr.db.Where(filter).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+func (mgr *DatabaseMgr) DeleteToken(id uint) error {
+	return mgr.db.Delete(Token{}, Token{ID: id}).Error
+}
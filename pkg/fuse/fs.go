@@ -1,6 +1,7 @@
 package fuse
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"math"
 	"net/url"
@@ -13,6 +14,7 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
 	"github.com/kuberlab/pluk/pkg/grpc"
 	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/manifest"
 	"github.com/kuberlab/pluk/pkg/plukclient"
 	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -30,10 +32,12 @@ type PlukeFS struct {
 	secretWorkspace string
 	dsType          string
 	client          io.PlukClient
+	source          io.ChunkSource
 	innerFS         *io.ChunkedFileFS
+	verifyKey       ed25519.PublicKey
 }
 
-func NewPlukeFS(dsType, workspace, dataset, version, server, secret, secretWorkspace string) (pathfs.FileSystem, error) {
+func NewPlukeFS(dsType, workspace, dataset, version, server, secret, secretWorkspace, verifyKey string) (pathfs.FileSystem, error) {
 	if dsType == "" {
 		dsType = "dataset"
 	}
@@ -57,12 +61,11 @@ func NewPlukeFS(dsType, workspace, dataset, version, server, secret, secretWorks
 	}
 
 	fs.client = client
-	innerFS, err := client.GetFSStructure(dsType, workspace, dataset, version, "")
-	if err != nil {
-		return nil, err
+	if verifyKey != "" {
+		if fs.verifyKey, err = manifest.LoadPublicKey(verifyKey); err != nil {
+			return nil, err
+		}
 	}
-	innerFS.Prepare()
-	fs.innerFS = innerFS
 
 	// Connect to gRPC
 	u, _ := url.Parse(server)
@@ -75,12 +78,40 @@ func NewPlukeFS(dsType, workspace, dataset, version, server, secret, secretWorks
 			return nil, err
 		}
 	}
+	fs.source = io.GrpcSource{Client: gClient}
 
-	io.GrpcClient = gClient
+	innerFS, err := fs.getFSStructure(dataset, version)
+	if err != nil {
+		return nil, err
+	}
+	innerFS.Prepare()
+	fs.innerFS = innerFS
 
 	return fs, nil
 }
 
+// getFSStructure fetches FS and checks its manifest signature if the key is given.
+func (fs *PlukeFS) getFSStructure(dataset, version string) (*io.ChunkedFileFS, error) {
+	innerFS, err := fs.client.GetFSStructure(fs.dsType, fs.workspace, dataset, version, "")
+	if err != nil {
+		return nil, err
+	}
+	innerFS.SetSource(fs.source)
+	if fs.verifyKey == nil {
+		return innerFS, nil
+	}
+	sig, err := fs.client.GetManifestSignature(fs.dsType, fs.workspace, dataset, version)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get manifest signature: %v", err)
+	}
+	m := manifest.FromFS(fs.dsType, fs.workspace, dataset, version, innerFS)
+	if err = manifest.Verify(fs.verifyKey, m, sig); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Manifest signature of %v:%v is valid.", dataset, version)
+	return innerFS, nil
+}
+
 func (fs *PlukeFS) String() string {
 	return "plukefs"
 }
@@ -253,7 +284,7 @@ func (fs *PlukeFS) tryChangeDataset(filename string) (file nodefs.File, code fus
 
 	// Change dataset only if current dataset/version differs from target.
 	if dataset != fs.dataset || version != fs.version {
-		newFS, err := fs.client.GetFSStructure(fs.dsType, fs.workspace, dataset, version, "")
+		newFS, err := fs.getFSStructure(dataset, version)
 		if err != nil {
 			msg := fmt.Sprintf("Failed to change FS to %v:%v: %v", dataset, version, err)
 			logrus.Error(msg)
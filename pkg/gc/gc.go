@@ -1,6 +1,8 @@
 package gc
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,61 +12,88 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/kuberlab/pluk/pkg/datasets"
 	"github.com/kuberlab/pluk/pkg/db"
 	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
-const (
-	gcInterval = time.Hour
-	gcChunks   = time.Hour * 24
-)
+// gcChunks is the minimal age of chunk files deleted by ClearChunks.
+const gcChunks = time.Hour * 24
 
-var (
-	active           *bool
-	clearChunkActive uint32
-	lock             = sync.RWMutex{}
-)
+var errStopped = errors.New("GC is stopped")
 
-func setClearChunkActive() {
-	atomic.StoreUint32(&clearChunkActive, 1)
+// Collector purges trashed entities and versions and unused chunks
+// of one database and its chunk dir.
+type Collector struct {
+	mgr              db.DataMgr
+	store            *io.Store
+	lock             sync.RWMutex
+	active           uint32
+	clearChunkActive uint32
+	stopping         uint32
+	trigger          chan string
+	stop             chan struct{}
+	stopOnce         sync.Once
 }
 
-func setClearChunkInactive() {
-	atomic.StoreUint32(&clearChunkActive, 0)
+func New(mgr db.DataMgr, store *io.Store) *Collector {
+	return &Collector{
+		mgr:     mgr,
+		store:   store,
+		trigger: make(chan string, store.Settings.Uploads()+1),
+		stop:    make(chan struct{}),
+	}
 }
 
-func isClearChunkActive() bool {
-	return atomic.LoadUint32(&clearChunkActive) == 1
+// Trigger requests the collection unless one is already pending.
+func (c *Collector) Trigger(reason string) {
+	select {
+	case c.trigger <- reason:
+	default:
+	}
 }
 
-func setActive() {
-	if active == nil {
-		ac := true
-		active = &ac
-	} else {
-		*active = true
+// Stop prevents new GC runs and waits until the running one commits
+// the datasets and versions already deleted.
+func (c *Collector) Stop(ctx context.Context) error {
+	atomic.StoreUint32(&c.stopping, 1)
+	c.stopOnce.Do(func() { close(c.stop) })
+	done := make(chan struct{})
+	go func() {
+		c.lock.Lock()
+		c.lock.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func setInactive() {
-	*active = false
+func (c *Collector) stopped() bool {
+	return atomic.LoadUint32(&c.stopping) == 1
 }
 
-func WaitGCCompleted() {
-	if active != nil && !(*active) {
+// Wait waits up to 30 seconds for the running collection.
+func (c *Collector) Wait() {
+	if atomic.LoadUint32(&c.active) == 0 {
 		return
 	}
 
 	timeout := time.NewTimer(time.Second * 30)
 	ticker := time.NewTicker(time.Millisecond * 100)
+	defer timeout.Stop()
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			if active != nil && !(*active) {
+			if atomic.LoadUint32(&c.active) == 0 {
 				return
 			}
 		case <-timeout.C:
@@ -73,44 +102,55 @@ func WaitGCCompleted() {
 	}
 }
 
-func Start() {
-	utils.GCChan = make(chan string, utils.UploadConcurrency()+1)
-	utils.GCClearChunks = make(chan string, 2)
+// Run collects garbage periodically and on triggers until stopped.
+func (c *Collector) Run() {
+	c.GoGC()
 
-	GoGC()
-
-	ticker := time.NewTicker(gcInterval)
-	tickerChunks := time.NewTicker(gcChunks)
+	// Intervals are re-read after every run to apply the reloaded config.
+	timer := time.NewTimer(utils.GCInterval())
+	timerChunks := time.NewTimer(utils.GCChunksInterval())
+	defer timer.Stop()
+	defer timerChunks.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			GoGC()
-		case msg := <-utils.GCChan:
+		case <-c.stop:
+			return
+		case <-timer.C:
+			c.GoGC()
+			timer.Reset(utils.GCInterval())
+		case msg := <-c.trigger:
 			logrus.Infof("[GC] %v", msg)
-			GoGC()
-		case msg := <-utils.GCClearChunks:
-			logrus.Infof("[ClearChunks] %v", msg)
-			go ClearChunks(db.DbMgr)
-		case <-tickerChunks.C:
-			go ClearChunks(db.DbMgr)
+			c.GoGC()
+		case <-timerChunks.C:
+			go c.ClearChunks()
+			timerChunks.Reset(utils.GCChunksInterval())
 		}
 	}
 }
 
-func GoGC() {
+func (c *Collector) GoGC() {
 	go datasets.RunDeleteLoop()
 	go datasets.RunChunkDBDeleteLoop()
 
-	utils.AcqureSem(1)
-	lock.Lock()
-	setActive()
+	c.store.Acquire()
+	c.lock.Lock()
+	atomic.StoreUint32(&c.active, 1)
 	defer func() {
-		utils.ReleaseSem(1)
-		lock.Unlock()
-		setInactive()
+		c.store.Release()
+		c.lock.Unlock()
+		atomic.StoreUint32(&c.active, 0)
 	}()
+	if c.stopped() {
+		return
+	}
 	logrus.Info("[GC] Starting garbage collector...")
-	mgr := db.DbMgr
+	defer metrics.Since(metrics.GCDuration.WithLabelValues("gc"), time.Now())
+	mgr := c.mgr
+
+	if !c.store.HasMasters() {
+		// Versions out of retention go to trash first.
+		datasets.ApplyRetentionPolicies(mgr, c.store)
+	}
 
 	vDatasets, err := mgr.ListDatasets(db.Dataset{Deleted: true})
 	if err != nil {
@@ -133,7 +173,13 @@ func GoGC() {
 
 	// First: check if repo exists.
 	for _, ds := range vDatasets {
-		if err = deleteDatasetVersion(tx, ds, ""); err != nil {
+		if c.stopped() {
+			break
+		}
+		if !datasets.TrashExpired(c.store, ds.TrashedAt) {
+			continue
+		}
+		if err = deleteDatasetVersion(tx, c.store, ds, ""); err != nil {
 			logrus.Error(err)
 			//return
 		}
@@ -141,6 +187,9 @@ func GoGC() {
 
 	// Second: Iterate over versions and see if the corresponding version deleted.
 	endTx()
+	if c.stopped() {
+		return
+	}
 	tx = mgr.Begin()
 
 	deletedVersions, err := tx.ListDatasetVersions(db.DatasetVersion{Deleted: true})
@@ -148,8 +197,14 @@ func GoGC() {
 		logrus.Error(err)
 	}
 	for _, dsv := range deletedVersions {
+		if c.stopped() {
+			break
+		}
+		if !datasets.TrashExpired(c.store, dsv.TrashedAt) {
+			continue
+		}
 		err = deleteDatasetVersion(
-			tx,
+			tx, c.store,
 			&db.Dataset{Workspace: dsv.Workspace, Name: dsv.Name, Type: dsv.Type}, dsv.Version,
 		)
 		if err != nil {
@@ -157,16 +212,19 @@ func GoGC() {
 		}
 	}
 	endTx()
+	if c.stopped() {
+		return
+	}
 	// Third: See if there deleted dataset on master; delete those which don't exist on master
 	// but exist on slave.
-	if utils.HasMasters() {
+	if c.store.HasMasters() {
 		// Sync with master and delete obsolete datasets.
-		gcFromMasters(mgr)
+		c.gcFromMasters(mgr)
 	}
 	logrus.Infof("[GC] Done garbage collecting.")
 }
 
-func deleteDatasetVersion(mgr db.DataMgr, dataset *db.Dataset, version string) error {
+func deleteDatasetVersion(mgr db.DataMgr, store *io.Store, dataset *db.Dataset, version string) error {
 	// Delete all files within this repo
 	rawFiles, err := mgr.GetRawFiles(dataset.Type, dataset.Workspace, dataset.Name, version, "", "", false)
 	if err != nil {
@@ -179,6 +237,7 @@ func deleteDatasetVersion(mgr db.DataMgr, dataset *db.Dataset, version string) e
 	}
 	//var deleted = 0
 	logrus.Infof("[GC] Deleted %v virtual files.", rows)
+	metrics.GCDeleted.WithLabelValues("files").Add(float64(rows))
 
 	for _, raw := range rawFiles {
 		//chunk, err := mgr.GetChunkByID(raw.ChunkID)
@@ -197,8 +256,9 @@ func deleteDatasetVersion(mgr db.DataMgr, dataset *db.Dataset, version string) e
 		//	logrus.Infof("[GC] Deleted %v chunks.", deleted)
 		//}
 	}
-	deleted := datasets.TriggerDeleteChunks(mgr)
+	deleted := datasets.TriggerDeleteChunks(mgr, store)
 	logrus.Infof("[GC] Deleted %v chunks.", deleted)
+	metrics.GCDeleted.WithLabelValues("chunks").Add(float64(deleted))
 
 	if version != "" {
 		dsv, err := mgr.GetDatasetVersion(dataset.Type, dataset.Workspace, dataset.Name, version)
@@ -208,8 +268,13 @@ func deleteDatasetVersion(mgr db.DataMgr, dataset *db.Dataset, version string) e
 		if err = mgr.DeleteDatasetVersion(dsv.ID); err != nil {
 			return err
 		}
+		if err = mgr.DeleteVersionManifest(dataset.Type, dataset.Workspace, dataset.Name, version); err != nil {
+			return err
+		}
+		metrics.GCDeleted.WithLabelValues("versions").Inc()
 	} else {
 		deleteDataset(mgr, dataset)
+		metrics.GCDeleted.WithLabelValues("datasets").Inc()
 	}
 
 	return nil
@@ -222,10 +287,23 @@ func deleteDataset(mgr db.DataMgr, d *db.Dataset) {
 		logrus.Error(err)
 		return
 	}
+	sql = "DELETE FROM version_manifests WHERE workspace=? AND name=? AND type=?"
+	if err = mgr.DB().Exec(sql, d.Workspace, d.Name, d.Type).Error; err != nil {
+		logrus.Error(err)
+		return
+	}
+	if err = mgr.DeleteRetentionPolicy(d.Type, d.Workspace, d.Name); err != nil {
+		logrus.Error(err)
+		return
+	}
+	if err = mgr.DeleteEntityACL(d.Type, d.Workspace, d.Name); err != nil {
+		logrus.Error(err)
+		return
+	}
 	_ = mgr.DeleteDataset(d.ID)
 }
 
-func gcFromMasters(mgr db.DataMgr) {
+func (c *Collector) gcFromMasters(mgr db.DataMgr) {
 	var needCloseTx = true
 	var err error
 	tx := mgr.Begin()
@@ -242,7 +320,7 @@ func gcFromMasters(mgr db.DataMgr) {
 	}
 	defer endTx()
 
-	dsManager := datasets.NewManager(tx, nil)
+	dsManager := datasets.NewManager(tx, nil, c.store)
 	vDatasets, err := tx.ListDatasets(db.Dataset{})
 	if err != nil {
 		logrus.Error(err)
@@ -265,7 +343,7 @@ func gcFromMasters(mgr db.DataMgr) {
 	candidates := make([]types.Dataset, 0)
 	for wsType, slaveDatasets := range localDatasets {
 		ws, eType := wsAndType(wsType)
-		remoteDatasets, err := io.MasterClient.ListEntities(eType, ws)
+		remoteDatasets, err := c.store.Master.ListEntities(eType, ws)
 		if err != nil {
 			logrus.Errorf("[GC] list from master: %v", err)
 			return
@@ -285,6 +363,9 @@ func gcFromMasters(mgr db.DataMgr) {
 	}
 
 	for _, candidate := range candidates {
+		if c.stopped() {
+			break
+		}
 		logrus.Infof("[GC] Delete %v %v/%v from slave", candidate.DType, candidate.Workspace, candidate.Name)
 		if err = dsManager.DeleteDataset(candidate.DType, candidate.Workspace, candidate.Name, nil, false); err != nil {
 			logrus.Error(err)
@@ -307,12 +388,14 @@ type ClearChunk struct {
 	DBSize     int64
 }
 
-func ClearChunks(mgr db.DataMgr) {
-	if isClearChunkActive() {
+// ClearChunks deletes chunk files unknown to the database.
+func (c *Collector) ClearChunks() {
+	if !atomic.CompareAndSwapUint32(&c.clearChunkActive, 0, 1) {
 		return
 	}
-	setClearChunkActive()
-	defer setClearChunkInactive()
+	defer atomic.StoreUint32(&c.clearChunkActive, 0)
+	mgr := c.mgr
+	defer metrics.Since(metrics.GCDuration.WithLabelValues("clear-chunks"), time.Now())
 
 	var err error
 
@@ -358,11 +441,15 @@ func ClearChunks(mgr db.DataMgr) {
 		return nil
 	}
 
-	err = filepath.Walk(utils.DataDir(), func(path string, info os.FileInfo, err error) error {
+	dir := c.store.Settings.DataDir()
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			logrus.Errorf("[ClearChunks] Failed seek files: %v", err)
 			return err
 		}
+		if c.stopped() {
+			return errStopped
+		}
 		if info.IsDir() {
 			return nil
 		}
@@ -372,7 +459,7 @@ func ClearChunks(mgr db.DataMgr) {
 			return nil
 		}
 
-		hash, _ := utils.GetHashFromPath(path)
+		hash := strings.Replace(strings.TrimPrefix(path, dir), "/", "", -1)
 		hashMap[hash] = &db.RawFile{ChunkSize: info.Size(), Hash: hash, Path: path}
 
 		if len(hashMap) < limit {
@@ -398,5 +485,6 @@ func ClearChunks(mgr db.DataMgr) {
 		return
 	}
 	logrus.Infof("[ClearChunks] Deleted %v chunks.", deleted)
+	metrics.GCDeleted.WithLabelValues("chunks").Add(float64(deleted))
 	logrus.Info("[ClearChunks] Done.")
 }
@@ -6,9 +6,12 @@ import (
 	"net"
 	"time"
 
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -24,7 +27,15 @@ type Client struct {
 func NewClient(address string, opts *plukclient.AuthOpts) (*Client, error) {
 	// Set up a connection to the server.
 
-	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	creds := grpc.WithInsecure()
+	if utils.GrpcTLS() {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(utils.ClientTLSConfig()))
+	}
+	conn, err := grpc.Dial(
+		address,
+		creds,
+		grpc.WithUnaryInterceptor(metrics.GrpcClientInterceptor),
+	)
 	//grpc.WithReadBufferSize(65536), grpc.WithWriteBufferSize(65536))
 	if err != nil {
 		return nil, fmt.Errorf("did not connect: %v", err)
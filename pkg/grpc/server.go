@@ -3,34 +3,40 @@ package grpc
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"io"
-	"net"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/kuberlab/pluk/pkg/api"
-	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 )
 
 // Server is used to implement PlukeServer.
 type Server struct {
 	UnimplementedPlukeServer
+
+	// API authorizes chunk requests.
+	API *api.API
 }
 
 // GetChunk implements PlukeServer
 func (s *Server) GetChunk(_ context.Context, in *ChunkRequest) (*ChunkResponse, error) {
-	if ok, err := s.checkAuth(in.Auth); !ok {
+	if ok, err := s.checkAuth(in.Auth, in.Path, byte(in.Version)); !ok {
 		logrus.Error(err)
 		return nil, err
 	}
+	store := s.API.Store()
+	// The path may be of the chunk dir of the master.
+	path := store.Settings.LocalChunkPath(in.Path, byte(in.Version))
 
 	getData := func(path string, version byte) ([]byte, error) {
-		reader, err := plukio.GetChunk(path, version)
+		reader, err := store.GetChunk(path, version)
 		if err != nil {
 			logrus.Error(err)
 			return nil, err
@@ -41,15 +47,15 @@ func (s *Server) GetChunk(_ context.Context, in *ChunkRequest) (*ChunkResponse,
 		return bt.Bytes(), nil
 	}
 
-	data, err := getData(in.Path, byte(in.Version))
+	data, err := getData(path, byte(in.Version))
 	if err != nil {
 		return nil, err
 	}
 
 	if len(data) == 0 {
 		logrus.Warningf("Zero chunk response for %v, re-requesting", in.Path)
-		os.Remove(in.Path)
-		data, err = getData(in.Path, byte(in.Version))
+		os.Remove(path)
+		data, err = getData(path, byte(in.Version))
 		if err != nil {
 			return nil, err
 		}
@@ -59,13 +65,16 @@ func (s *Server) GetChunk(_ context.Context, in *ChunkRequest) (*ChunkResponse,
 
 // GetChunkWithCheck implements PlukeServer
 func (s *Server) GetChunkWithCheck(_ context.Context, in *ChunkRequestWithCheck) (*ChunkResponse, error) {
-	if ok, err := s.checkAuth(in.Auth); !ok {
+	if ok, err := s.checkAuth(in.Auth, in.Path, byte(in.Version)); !ok {
 		logrus.Error(err)
 		return nil, err
 	}
+	store := s.API.Store()
+	// The path may be of the chunk dir of the master.
+	path := store.Settings.LocalChunkPath(in.Path, byte(in.Version))
 
 	getData := func(path string, version byte) ([]byte, error) {
-		reader, err := plukio.GetChunk(path, version)
+		reader, err := store.GetChunk(path, version)
 		if err != nil {
 			logrus.Error(err)
 			return nil, err
@@ -76,15 +85,15 @@ func (s *Server) GetChunkWithCheck(_ context.Context, in *ChunkRequestWithCheck)
 		return bt.Bytes(), nil
 	}
 
-	data, err := getData(in.Path, byte(in.Version))
+	data, err := getData(path, byte(in.Version))
 	if err != nil {
 		return nil, err
 	}
 
 	if len(data) == 0 || int64(len(data)) != in.Size {
 		logrus.Warningf("Got chunk size %v/%v for %v, re-requesting", len(data), in.Size, in.Path)
-		os.Remove(in.Path)
-		data, err = getData(in.Path, byte(in.Version))
+		os.Remove(path)
+		data, err = getData(path, byte(in.Version))
 		if err != nil {
 			return nil, err
 		}
@@ -92,33 +101,25 @@ func (s *Server) GetChunkWithCheck(_ context.Context, in *ChunkRequestWithCheck)
 	return &ChunkResponse{Data: data}, nil
 }
 
-func (s *Server) checkAuth(auth *Auth) (bool, error) {
-	return api.GlobalAPI.CheckAuth(
-		http.MethodGet,
-		"dataset",
-		"",
-		"",
-		"",
-		auth.Workspace,
-		auth.Secret,
-		nil,
-	)
+func (s *Server) checkAuth(auth *Auth, path string, version byte) (bool, error) {
+	hash := utils.ChunkHash(path, version)
+	return s.API.CheckChunkAuth(auth.Workspace, auth.Secret, hash)
 }
 
-func Start() {
-	logrus.Infof("Starting grpc server at :%v", utils.GrpcPort())
-	lis, err := net.Listen("tcp", ":"+utils.GrpcPort())
-	if err != nil {
-		logrus.Errorf("failed to listen: %v", err)
-	}
-	s := grpc.NewServer(
-		grpc.WriteBufferSize(1024*32),
-		grpc.ReadBufferSize(1024*32),
+// NewServer returns the gRPC server of chunks authorized by the API;
+// it is served with TLS if tlsConfig is not nil.
+func NewServer(a *api.API, tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.WriteBufferSize(1024 * 32),
+		grpc.ReadBufferSize(1024 * 32),
 		grpc.MaxConcurrentStreams(64),
 		grpc.KeepaliveParams(keepalive.ServerParameters{Time: time.Duration(0)}),
-	)
-	RegisterPlukeServer(s, &Server{})
-	if err := s.Serve(lis); err != nil {
-		logrus.Fatalf("failed to serve: %v", err)
+		grpc.UnaryInterceptor(metrics.GrpcServerInterceptor),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
+	s := grpc.NewServer(opts...)
+	RegisterPlukeServer(s, &Server{API: a})
+	return s
 }
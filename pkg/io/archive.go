@@ -0,0 +1,188 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+const (
+	ArchiveTar = "tar"
+	ArchiveTgz = "tgz"
+	ArchiveZip = "zip"
+)
+
+// DetectArchiveFormat guesses the archive format by its magic bytes
+// without consuming them.
+func DetectArchiveFormat(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTgz, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	}
+	return ArchiveTar, nil
+}
+
+// IngestArchive reads regular files from the tar, tgz or zip archive, splits them into chunks,
+// saves missing chunks and returns the resulting file structure. Tar and tgz are read
+// as a stream, zip must be an *os.File.
+// Entries are placed under prefix; progress is called after each file.
+// checkQuota gets the size read so far before each new chunk is written.
+func (s *Store) IngestArchive(r io.Reader, format, prefix string, chunkSize int,
+	checkQuota func(size int64) error, progress func(p types.IngestProgress)) (*types.FileStructure, error) {
+
+	structure := &types.FileStructure{Files: make([]*types.HashedFile, 0)}
+	state := types.IngestProgress{}
+	saveEntry := func(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+		filePath, ok := archivePath(prefix, name)
+		if !ok {
+			return nil
+		}
+		hashed := &types.HashedFile{
+			Path:     filePath,
+			Mode:     mode,
+			ModeTime: modTime,
+			Hashes:   make([]types.Hash, 0),
+		}
+		checkSize := func(size int64) error {
+			return checkQuota(state.Bytes + size)
+		}
+		if err := s.saveChunks(hashed, r, chunkSize, checkSize); err != nil {
+			if _, ok := err.(*errors.Error); ok {
+				// Keep the status, e.g. 507 of the low disk space.
+				return err
+			}
+			return fmt.Errorf("Failed to save %v: %v", name, err)
+		}
+		structure.Files = append(structure.Files, hashed)
+
+		state.Files++
+		state.Bytes += hashed.Size
+		state.Path = hashed.Path
+		if progress != nil {
+			progress(state)
+		}
+		return nil
+	}
+
+	switch format {
+	case ArchiveTar, ArchiveTgz:
+		if format == ArchiveTgz {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				continue
+			}
+			err = saveEntry(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case ArchiveZip:
+		f, ok := r.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("Zip archive must be read from a file")
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(f, stat.Size())
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			entry, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = saveEntry(zf.Name, zf.Mode(), zf.Modified, entry)
+			entry.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported archive format %q: allowed %v, %v and %v", format, ArchiveTar, ArchiveTgz, ArchiveZip)
+	}
+	return structure, nil
+}
+
+func (s *Store) saveChunks(hashed *types.HashedFile, r io.Reader, chunkSize int, checkQuota func(size int64) error) error {
+	reader := NewChunkedReader(chunkSize, utils.NewPreciseReader(r))
+	for {
+		data, hash, err := reader.NextChunk()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		length := int64(len(data))
+		hashed.Size += length
+		hashed.Hashes = append(hashed.Hashes, types.Hash{Hash: hash, Size: length, Version: types.ChunkVersion})
+
+		check, err := s.CheckChunk(hash, types.ChunkVersion)
+		if err != nil {
+			return err
+		}
+		if check.Exists && check.Size == length {
+			continue
+		}
+		if err = checkQuota(hashed.Size); err != nil {
+			return err
+		}
+		if _, err = s.SaveChunk(hash, types.ChunkVersion, ioutil.NopCloser(bytes.NewBuffer(data)), true); err != nil {
+			return err
+		}
+	}
+}
+
+// archivePath cleans the archive entry name and puts it under the prefix.
+// Leading "../" elements are dropped so entries can not leave the archive root.
+func archivePath(prefix, name string) (string, bool) {
+	name = path.Clean("/" + strings.Replace(name, "\\", "/", -1))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || name == "." {
+		return "", false
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		name = prefix + "/" + name
+	}
+	return name, true
+}
@@ -12,7 +12,6 @@ import (
 	"time"
 
 	"github.com/kuberlab/pluk/pkg/types"
-	"github.com/kuberlab/pluk/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,6 +25,22 @@ type PlukClient interface {
 	Close() error
 	DeleteEntity(entityType, workspace, name string, force bool) error
 	DeleteVersion(entityType, workspace, name, version string) error
+	RestoreEntity(entityType, workspace, name string) error
+	RenameEntity(entityType, workspace, name, targetWorkspace, targetName string) error
+	RestoreVersion(entityType, workspace, name, version string) error
+	GetRetentionPolicy(entityType, workspace, name string) (*types.RetentionPolicy, error)
+	SetRetentionPolicy(entityType, workspace, name string, policy *types.RetentionPolicy) error
+	DeleteRetentionPolicy(entityType, workspace, name string) error
+	RetentionDryRun(entityType, workspace, name string) (*types.VersionList, error)
+	GetWorkspaceQuota(workspace string) (*types.WorkspaceQuota, error)
+	SetWorkspaceQuota(workspace string, quota *types.WorkspaceQuota) error
+	DeleteWorkspaceQuota(workspace string) error
+	GetWorkspaceUsage(workspace string) (*types.WorkspaceUsage, error)
+	GetStorageStats(entityType, workspace, name, version string, versions bool) (*types.StorageStats, error)
+	MoveFiles(entityType, workspace, name, version, from, to string) error
+	CopyFiles(entityType, workspace, name, version, to string, src types.FileSource) error
+	MergeVersion(entityType, workspace, name, version, theirs, base string,
+		resolutions map[string]string) (*types.MergeResult, error)
 	DownloadChunk(hash string, version byte) (io.ReadCloser, error)
 	DownloadEntity(entityType, workspace, name, version string, w io.Writer) error
 	EntityTarSize(entityType, workspace, name, version string) (int64, error)
@@ -33,8 +48,10 @@ type PlukClient interface {
 	ListEntities(entityType, workspace string) (*types.DataSetList, error)
 	GetEntity(entityType, workspace, name string) (*types.Dataset, error)
 	GetVersion(entityType, workspace, name, version string) (*types.Version, error)
+	GetManifestSignature(entityType, workspace, name, version string) (*types.ManifestSignature, error)
 	CreateEntity(entityType, workspace, name string) (*types.Dataset, error)
 	CreateVersion(entityType, workspace, name, version string) (*types.Version, error)
+	ReopenVersion(entityType, workspace, name, version string) error
 	ListVersions(entityType, workspace, datasetName string) (*types.VersionList, error)
 
 	UploadFile(entityType, workspace, entityName, version, fileName string, body io.ReadCloser) (*types.HashedFile, error)
@@ -53,10 +70,24 @@ type PlukGRPCClient interface {
 	GetChunkWithCheck(path string, version byte, size int64) ([]byte, error)
 }
 
-var (
-	MasterClient PlukClient
-	GrpcClient   PlukGRPCClient
-)
+// ChunkSource reads the chunks of files: the Store on servers and
+// GrpcSource in plukefs.
+type ChunkSource interface {
+	ReadChunk(path string, version byte, size int64) (ReaderInterface, error)
+}
+
+// GrpcSource reads chunks from the server via gRPC.
+type GrpcSource struct {
+	Client PlukGRPCClient
+}
+
+func (s GrpcSource) ReadChunk(path string, version byte, size int64) (ReaderInterface, error) {
+	bts, err := s.Client.GetChunkWithCheck(path, version, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewChunkReaderFromData(bts), nil
+}
 
 type ChunkedFileFS struct {
 	Root    string                    `json:"root"`
@@ -144,6 +175,16 @@ func (fs *ChunkedFileFS) Walk(root string, walkFunc func(path string, f *Chunked
 	return nil
 }
 
+// SetSource sets the source of chunks of all the files.
+func (fs *ChunkedFileFS) SetSource(src ChunkSource) {
+	for _, f := range fs.Files {
+		f.source = src
+	}
+	for _, d := range fs.Dirs {
+		d.SetSource(src)
+	}
+}
+
 func (fs *ChunkedFileFS) Prepare() {
 	if fs.Root == "/" {
 		fs.AsFile = fs.dirObj("", fs.ModTime)
@@ -185,6 +226,7 @@ func (fs *ChunkedFileFS) Clone() *ChunkedFileFS {
 			Dir:                f.Dir,
 			Mode:               f.Mode,
 			ModTime:            f.ModTime,
+			source:             f.source,
 		}
 	}
 	for k, d := range fs.Dirs {
@@ -252,6 +294,7 @@ type ChunkedFile struct {
 	Dir                bool      `json:"dir"`
 	ModTime            time.Time `json:"modtime"`
 
+	source       ChunkSource
 	currentChunk int
 	offset       int64 // absolute offset
 	chunkOffset  int64
@@ -322,33 +365,15 @@ func (f *ChunkedFile) Clone() *ChunkedFile {
 		ModTime: f.ModTime,
 		Mode:    f.Mode,
 		Dir:     f.Dir,
-	}
-}
-
-func (f *ChunkedFile) getChunkReader(chunkPath string, version byte) (reader ReaderInterface, err error) {
-	//_, version := utils.GetHashFromPath(chunkPath)
-	if !utils.UseGrpc {
-		return GetChunk(chunkPath, version)
-	} else {
-		bts, err := GrpcClient.GetChunk(chunkPath, version)
-		if err != nil {
-			return nil, err
-		}
-		return NewChunkReaderFromData(bts), nil
+		source:  f.source,
 	}
 }
 
 func (f *ChunkedFile) getChunkReaderWithSize(chunkPath string, version byte, size int64) (reader ReaderInterface, err error) {
-	//_, version := utils.GetHashFromPath(chunkPath)
-	if !utils.UseGrpc {
-		return GetChunk(chunkPath, version)
-	} else {
-		bts, err := GrpcClient.GetChunkWithCheck(chunkPath, version, size)
-		if err != nil {
-			return nil, err
-		}
-		return NewChunkReaderFromData(bts), nil
+	if f.source == nil {
+		return nil, fmt.Errorf("No chunk source of %v", f.Name)
 	}
+	return f.source.ReadChunk(chunkPath, version, size)
 }
 
 func (f *ChunkedFile) Read(p []byte) (n int, err error) {
@@ -2,6 +2,7 @@ package io
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,9 +10,11 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
 )
 
 type ChunkedReader struct {
@@ -44,12 +47,53 @@ func (c *ChunkedReader) NextChunk() ([]byte, string, error) {
 	return nil, "", io.EOF
 }
 
-func CheckChunk(hash string, version byte) (*types.ChunkCheck, error) {
-	size, exists := CheckLocalChunk(hash, version)
+// Store keeps the chunk files of one server in its chunk dir. Slaves read
+// missing chunks from the master and push saved ones to it.
+type Store struct {
+	Settings *utils.Settings
+	// Master is the client of the masters, nil if there are none.
+	Master PlukClient
+
+	// lowSpace is set while chunks downloaded from master are not cached.
+	lowSpace int32
+	// uploads limits the concurrent writes, UPLOAD_CONCURRENCY.
+	uploads *semaphore.Weighted
+}
+
+func NewStore(settings *utils.Settings, master PlukClient) *Store {
+	return &Store{
+		Settings: settings,
+		Master:   master,
+		uploads:  semaphore.NewWeighted(settings.Uploads()),
+	}
+}
+
+// Acquire waits for a free write slot of the server.
+func (s *Store) Acquire() {
+	s.uploads.Acquire(context.TODO(), 1)
+}
+
+// Release frees the write slot taken by Acquire.
+func (s *Store) Release() {
+	s.uploads.Release(1)
+}
+
+// HasMasters tells whether the store is of a slave.
+func (s *Store) HasMasters() bool {
+	return s.Master != nil
+}
+
+// ChunkPath returns the path of the chunk file.
+func (s *Store) ChunkPath(hash string, version byte) string {
+	return s.Settings.ChunkPath(hash, version)
+}
+
+func (s *Store) CheckChunk(hash string, version byte) (*types.ChunkCheck, error) {
+	size, exists := s.CheckLocalChunk(hash, version)
 
 	// Check chunk on master
-	if utils.HasMasters() {
-		check, err := MasterClient.CheckChunk(hash, version)
+	if s.Master != nil {
+		check, err := s.Master.CheckChunk(hash, version)
 		if err != nil {
 			return nil, err
 		}
@@ -67,8 +111,8 @@ func CheckChunk(hash string, version byte) (*types.ChunkCheck, error) {
 	return &types.ChunkCheck{Hash: hash, Exists: exists, Size: size}, nil
 }
 
-func CheckLocalChunk(hash string, version byte) (int64, bool) {
-	filePath := utils.GetHashedFilename(hash, version)
+func (s *Store) CheckLocalChunk(hash string, version byte) (int64, bool) {
+	filePath := s.ChunkPath(hash, version)
 	stat, err := os.Stat(filePath)
 	if err != nil {
 		return 0, false
@@ -76,30 +120,37 @@ func CheckLocalChunk(hash string, version byte) (int64, bool) {
 	return stat.Size(), err == nil
 }
 
-func GetChunkByHash(hash string, version byte) (reader io.ReadCloser, err error) {
-	chunkPath := utils.GetHashedFilename(hash, version)
-	return GetChunk(chunkPath, version)
+func (s *Store) GetChunkByHash(hash string, version byte) (reader io.ReadCloser, err error) {
+	return s.GetChunk(s.ChunkPath(hash, version), version)
 }
 
-func GetChunk(chunkPath string, version byte) (reader ReaderInterface, err error) {
+// ReadChunk implements ChunkSource.
+func (s *Store) ReadChunk(path string, version byte, size int64) (ReaderInterface, error) {
+	return s.GetChunk(path, version)
+}
+
+// GetChunk reads the chunk by its path on any server, the path is mapped
+// to the chunk dir.
+func (s *Store) GetChunk(chunkPath string, version byte) (reader ReaderInterface, err error) {
+	chunkPath = s.Settings.LocalChunkPath(chunkPath, version)
 	f, err := os.Open(chunkPath)
 	if err != nil {
-		hash, _ := utils.GetHashFromPath(chunkPath)
+		hash := utils.ChunkHash(chunkPath, version)
 		if f != nil {
 			f.Close()
 		}
-		if os.IsNotExist(err) && utils.HasMasters() {
+		if os.IsNotExist(err) && s.Master != nil {
 			// Read from master
 			//logrus.Debugf("download")
 			//t := time.Now()
 
 			getData := func(hash string, version byte, buffer *bytes.Buffer) error {
 				buffer.Reset()
-				check, err := MasterClient.CheckChunk(hash, version)
+				check, err := s.Master.CheckChunk(hash, version)
 				if err != nil {
 					return err
 				}
-				readerRaw, err := MasterClient.DownloadChunk(hash, version)
+				readerRaw, err := s.Master.DownloadChunk(hash, version)
 
 				if err != nil {
 					return err
@@ -119,13 +170,17 @@ func GetChunk(chunkPath string, version byte) (reader ReaderInterface, err error
 			buf := bytes.NewBuffer([]byte{})
 			_, err := utils.Retry("get chunk", 0.5, 10, getData, hash, byte(version), buf)
 			if err != nil {
+				metrics.MasterFallbacks.WithLabelValues("failure").Inc()
 				logrus.Warningf("Failed get chunk: %v", err)
+			} else {
+				metrics.MasterFallbacks.WithLabelValues("success").Inc()
 			}
 			data := buf.Bytes()
+			metrics.ChunkBytes.WithLabelValues("read", "master").Add(float64(len(data)))
 
-			if utils.SaveChunks() {
+			if s.cacheChunk(int64(len(data))) {
 				//logrus.Debugf("download complete! %v", time.Since(t))
-				_, err = SaveChunk(hash, version, ioutil.NopCloser(bytes.NewBuffer(data)), false)
+				_, err = s.SaveChunk(hash, version, ioutil.NopCloser(bytes.NewBuffer(data)), false)
 				if err != nil {
 					logrus.Errorf("Could not save chunk: %v", err)
 				}
@@ -135,14 +190,22 @@ func GetChunk(chunkPath string, version byte) (reader ReaderInterface, err error
 			return nil, err
 		}
 	}
+	if stat, err := f.Stat(); err == nil {
+		metrics.ChunkBytes.WithLabelValues("read", "local").Add(float64(stat.Size()))
+	}
 	reader = NewReaderFromFile(f)
 	return reader, err
 }
 
-func SaveChunk(hash string, version byte, data io.ReadCloser, sendToMaster bool) (int64, error) {
+func (s *Store) SaveChunk(hash string, version byte, data io.ReadCloser, sendToMaster bool) (int64, error) {
 	//logrus.Debugf("Save")
 	//t := time.Now()
-	filePath := utils.GetHashedFilename(hash, version)
+	filePath := s.ChunkPath(hash, version)
+
+	if err := s.CheckDiskSpace(0); err != nil {
+		data.Close()
+		return 0, err
+	}
 
 	splitted := strings.Split(filePath, "/")
 	baseDir := splitted[:len(splitted)-1]
@@ -152,36 +215,51 @@ func SaveChunk(hash string, version byte, data io.ReadCloser, sendToMaster bool)
 		return 0, err
 	}
 
-	file, err := os.Create(filePath)
+	// The chunk appears under its hash only when completely written,
+	// so the interrupted write doesn't leave a truncated one.
+	file, err := ioutil.TempFile(strings.Join(baseDir, "/"), ".part-")
 	if err != nil {
 		data.Close()
 		return 0, err
 	}
-	logrus.Debugf("Created %v", filePath)
+	logrus.Debugf("Created %v", file.Name())
 
 	defer file.Close()
 
 	buf := bytes.NewBuffer([]byte{})
 	var written int64
 	var writer io.Writer = file
-	if utils.HasMasters() && sendToMaster {
+	if s.Master != nil && sendToMaster {
 		// If we have masters, then also write to buf in order to use it for further push.
 		writer = io.MultiWriter(writer, buf)
 	}
 	written, err = io.Copy(writer, data)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filePath)
+	}
 	if err != nil {
 		data.Close()
+		// Don't leave the truncated chunk, e.g. when the disk is full.
+		file.Close()
+		os.Remove(file.Name())
 		return 0, err
 	}
 	data.Close()
+	metrics.ChunkBytes.WithLabelValues("write", "local").Add(float64(written))
 
 	logrus.Debugf("Written %v bytes.", written)
 
-	if utils.HasMasters() && sendToMaster {
+	if s.Master != nil && sendToMaster {
 		// TODO: decide whether it can go in async
 		_, err = utils.Retry(
 			"Save chunk", 0.1, 10,
-			MasterClient.SaveChunk, hash, buf.Bytes(), byte(version),
+			s.Master.SaveChunk, hash, buf.Bytes(), byte(version),
 		)
 		return 0, err
 	}
@@ -0,0 +1,85 @@
+package io
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// DiskFree returns free bytes and inodes available in the directory.
+// Inodes are -1 if the filesystem doesn't report them.
+func DiskFree(dir string) (bytes int64, inodes int64, err error) {
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, err
+	}
+	inodes = -1
+	if stat.Files > 0 {
+		inodes = int64(stat.Ffree)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), inodes, nil
+}
+
+// CheckDiskSpace returns 507 error if writing incoming bytes leaves DATA_DIR
+// with less than MIN_FREE_SPACE bytes or MIN_FREE_INODES inodes.
+func (s *Store) CheckDiskSpace(incoming int64) error {
+	dir := s.Settings.DataDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	free, inodes, err := DiskFree(dir)
+	if err != nil {
+		logrus.Warnf("Failed to check free space of %v: %v", dir, err)
+		return nil
+	}
+	if incoming < 0 {
+		incoming = 0
+	}
+	if free-incoming < s.Settings.MinFreeSpace {
+		return errors.NewStatus(
+			http.StatusInsufficientStorage,
+			fmt.Sprintf(
+				"Not enough disk space on the server: %v bytes free, %v more bytes requested, %v bytes must stay free",
+				free, incoming, s.Settings.MinFreeSpace,
+			),
+		)
+	}
+	if inodes >= 0 && inodes < s.Settings.MinFreeInodes {
+		return errors.NewStatus(
+			http.StatusInsufficientStorage,
+			fmt.Sprintf(
+				"Not enough inodes on the server: %v free, %v must stay free",
+				inodes, s.Settings.MinFreeInodes,
+			),
+		)
+	}
+	return nil
+}
+
+// cacheChunk tells whether the chunk downloaded from master may be saved
+// locally. Caching stops while DATA_DIR is low on space and resumes
+// once the space is freed.
+func (s *Store) cacheChunk(size int64) bool {
+	if !utils.SaveChunks() {
+		return false
+	}
+	err := s.CheckDiskSpace(size)
+	var low int32 = 0
+	if err != nil {
+		low = 1
+	}
+	if atomic.SwapInt32(&s.lowSpace, low) != low {
+		if err != nil {
+			logrus.Warnf("Stop caching chunks from master: %v", err)
+		} else {
+			logrus.Info("Resume caching chunks from master.")
+		}
+	}
+	return err == nil
+}
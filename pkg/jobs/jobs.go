@@ -0,0 +1,261 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kuberlab/lib/pkg/errors"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TypeFork        = "fork"
+	TypeClone       = "clone"
+	TypeGC          = "gc"
+	TypeClearChunks = "clear-chunks"
+)
+
+// Func is the body of the job. It should return early when ctx is cancelled.
+type Func func(ctx context.Context, job *Job) (interface{}, error)
+
+// Manager runs jobs in background and keeps their records in the database.
+type Manager struct {
+	mgr     db.DataMgr
+	lock    sync.RWMutex
+	running map[uint]*Job
+	closed  bool
+}
+
+// Job is the running job.
+type Job struct {
+	m          *Manager
+	lock       sync.Mutex
+	record     *db.Job
+	cancelable bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+	result     interface{}
+	err        error
+}
+
+func NewManager(mgr db.DataMgr) *Manager {
+	return &Manager{mgr: mgr, running: make(map[uint]*Job)}
+}
+
+// Submit saves the job record and starts fn in background.
+// Only cancelable jobs may be stopped by Cancel.
+func (m *Manager) Submit(record *db.Job, cancelable bool, fn Func) (*Job, error) {
+	m.lock.RLock()
+	closed := m.closed
+	m.lock.RUnlock()
+	if closed {
+		return nil, errors.NewStatus(http.StatusServiceUnavailable, "Server is shutting down")
+	}
+	record.State = db.JobPending
+	if err := m.mgr.CreateJob(record); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		m:          m,
+		record:     record,
+		cancelable: cancelable,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	m.lock.Lock()
+	m.running[record.ID] = job
+	m.lock.Unlock()
+
+	go job.run(ctx, fn)
+	return job, nil
+}
+
+func (m *Manager) Get(id uint) (*types.Job, error) {
+	record, err := m.mgr.GetJob(id)
+	if err != nil {
+		return nil, errors.NewStatus(http.StatusNotFound, fmt.Sprintf("Job %v not found", id))
+	}
+	return JobFromDB(record), nil
+}
+
+func (m *Manager) List(filter db.Job) ([]types.Job, error) {
+	records, err := m.mgr.ListJobs(filter)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]types.Job, 0, len(records))
+	for _, r := range records {
+		jobs = append(jobs, *JobFromDB(r))
+	}
+	return jobs, nil
+}
+
+// Cancel requests the running job to stop.
+func (m *Manager) Cancel(id uint) error {
+	m.lock.RLock()
+	job, ok := m.running[id]
+	m.lock.RUnlock()
+	if !ok {
+		if _, err := m.Get(id); err != nil {
+			return err
+		}
+		return errors.NewStatus(http.StatusConflict, fmt.Sprintf("Job %v is already finished", id))
+	}
+	if !job.cancelable {
+		return errors.NewStatus(http.StatusConflict, fmt.Sprintf("Job %v can not be cancelled", id))
+	}
+	job.cancel()
+	return nil
+}
+
+// Shutdown rejects new jobs, cancels cancelable ones and waits for all
+// running jobs until ctx is done. Jobs still running then are marked failed,
+// so they are not left running in the database.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.lock.Lock()
+	m.closed = true
+	running := make([]*Job, 0, len(m.running))
+	for _, job := range m.running {
+		running = append(running, job)
+	}
+	m.lock.Unlock()
+
+	for _, job := range running {
+		if job.cancelable {
+			job.cancel()
+		}
+	}
+	for i, job := range running {
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+			for _, left := range running[i:] {
+				left.fail("server shut down before the job finished")
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// ID returns the job ID.
+func (j *Job) ID() uint {
+	return j.record.ID
+}
+
+// SetProgress saves the number of processed items out of total.
+func (j *Job) SetProgress(done, total int64) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.record.Done = done
+	j.record.Total = total
+	j.save()
+}
+
+// Wait blocks until the job is finished and returns its result.
+func (j *Job) Wait() (interface{}, error) {
+	<-j.done
+	return j.result, j.err
+}
+
+// Info returns the current job state.
+func (j *Job) Info() *types.Job {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return JobFromDB(j.record)
+}
+
+func (j *Job) run(ctx context.Context, fn Func) {
+	defer func() {
+		j.m.lock.Lock()
+		delete(j.m.running, j.record.ID)
+		j.m.lock.Unlock()
+		j.cancel()
+		close(j.done)
+	}()
+
+	j.lock.Lock()
+	now := time.Now()
+	j.record.State = db.JobRunning
+	j.record.StartedAt = &now
+	j.save()
+	j.lock.Unlock()
+
+	logrus.Infof("[Jobs] Started %v job %v", j.record.Type, j.record.ID)
+	result, err := fn(ctx, j)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	j.result, j.err = result, err
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	finished := time.Now()
+	j.record.FinishedAt = &finished
+	switch {
+	case ctx.Err() == context.Canceled:
+		j.record.State = db.JobCancelled
+	case err != nil:
+		j.record.State = db.JobFailed
+		j.record.Error = err.Error()
+	default:
+		j.record.State = db.JobSucceeded
+		if result != nil {
+			data, _ := json.Marshal(result)
+			j.record.Result = string(data)
+		}
+	}
+	j.save()
+	logrus.Infof("[Jobs] %v job %v is %v", j.record.Type, j.record.ID, j.record.State)
+}
+
+// fail marks the job failed unless it is already finished.
+func (j *Job) fail(reason string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.record.FinishedAt != nil {
+		return
+	}
+	finished := time.Now()
+	j.record.FinishedAt = &finished
+	j.record.State = db.JobFailed
+	j.record.Error = reason
+	j.save()
+	logrus.Warningf("[Jobs] %v job %v is %v: %v", j.record.Type, j.record.ID, j.record.State, reason)
+}
+
+func (j *Job) save() {
+	if err := j.m.mgr.UpdateJob(j.record); err != nil {
+		logrus.Errorf("[Jobs] Failed to save job %v: %v", j.record.ID, err)
+	}
+}
+
+func JobFromDB(r *db.Job) *types.Job {
+	job := &types.Job{
+		ID:         r.ID,
+		Type:       r.Type,
+		State:      r.State,
+		Workspace:  r.Workspace,
+		Name:       r.Name,
+		EntityType: r.EntityType,
+		Target:     r.Target,
+		Done:       r.Done,
+		Total:      r.Total,
+		Error:      r.Error,
+		CreatedAt:  r.CreatedAt,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+	}
+	if r.Result != "" {
+		job.Result = json.RawMessage(r.Result)
+	}
+	return job
+}
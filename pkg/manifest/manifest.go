@@ -0,0 +1,202 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/types"
+)
+
+const Algorithm = "ed25519"
+
+// Manifest is the canonical description of a version content.
+// It is built the same way on the server and on the client side,
+// so the signature made at commit time may be checked against
+// the file structure which is returned later.
+type Manifest struct {
+	Type      string `json:"type"`
+	Workspace string `json:"workspace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Files     []File `json:"files"`
+}
+
+type File struct {
+	Path   string  `json:"path"`
+	Size   int64   `json:"size"`
+	Mode   uint32  `json:"mode"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+func FromFS(dsType, workspace, name, version string, fs *plukio.ChunkedFileFS) *Manifest {
+	m := &Manifest{
+		Type:      dsType,
+		Workspace: workspace,
+		Name:      name,
+		Version:   version,
+		Files:     make([]File, 0),
+	}
+	if fs != nil {
+		m.addDir("", fs)
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	return m
+}
+
+func (m *Manifest) addDir(prefix string, dir *plukio.ChunkedFileFS) {
+	for name, d := range dir.Dirs {
+		m.addDir(path.Join(prefix, name), d)
+	}
+	for name, f := range dir.Files {
+		file := File{
+			Path:   path.Join(prefix, name),
+			Size:   f.Size,
+			Mode:   f.Mode,
+			Chunks: make([]Chunk, len(f.Chunks)),
+		}
+		for i, c := range f.Chunks {
+			file.Chunks[i] = Chunk{Hash: chunkHash(c), Size: c.Size}
+		}
+		m.Files = append(m.Files, file)
+	}
+}
+
+// chunkHash restores the chunk hash from its path. Only the trailing
+// path components are used, so the result doesn't depend on DATA_DIR.
+func chunkHash(c plukio.Chunk) string {
+	parts := strings.Split(c.Path, "/")
+	n := 2
+	switch c.Version {
+	case 2:
+		n = 3
+	case 1:
+		n = 4
+	}
+	if len(parts) < n {
+		n = len(parts)
+	}
+	return strings.Join(parts[len(parts)-n:], "")
+}
+
+func (m *Manifest) Canonical() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *Manifest) Digest() (string, error) {
+	data, err := m.Canonical()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum[:]), nil
+}
+
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func Sign(key ed25519.PrivateKey, m *Manifest) (*types.ManifestSignature, error) {
+	data, err := m.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &types.ManifestSignature{
+		Algorithm: Algorithm,
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Digest:    fmt.Sprintf("%x", sum[:]),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}, nil
+}
+
+func Verify(pub ed25519.PublicKey, m *Manifest, sig *types.ManifestSignature) error {
+	if sig == nil {
+		return errors.New("Manifest signature is missing")
+	}
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("Unsupported manifest signature algorithm: %v", sig.Algorithm)
+	}
+	if sig.KeyID != "" && sig.KeyID != KeyID(pub) {
+		return fmt.Errorf("Manifest is signed by unknown key %v", sig.KeyID)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("Invalid manifest signature: %v", err)
+	}
+	data, err := m.Canonical()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, raw) {
+		return fmt.Errorf(
+			"Manifest signature mismatch for %v %v/%v:%v: content differs from the committed one",
+			m.Type, m.Workspace, m.Name, m.Version,
+		)
+	}
+	return nil
+}
+
+// LoadPrivateKey reads ed25519 private key in PKCS#8 PEM format.
+func LoadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%v: not an ed25519 private key", filename)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads ed25519 public key in PKIX PEM format.
+func LoadPublicKey(filename string) (ed25519.PublicKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%v: not an ed25519 public key", filename)
+	}
+	return pub, nil
+}
+
+func readPEM(filename string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%v: no PEM data found", filename)
+	}
+	return block, nil
+}
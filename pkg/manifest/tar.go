@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+// TarVerifier checks the tar stream written to it against the manifest:
+// every file must be present in the manifest and its data must match
+// the chunk hashes.
+type TarVerifier struct {
+	w    *io.PipeWriter
+	done chan error
+}
+
+func NewTarVerifier(m *Manifest) *TarVerifier {
+	r, w := io.Pipe()
+	v := &TarVerifier{w: w, done: make(chan error, 1)}
+	go func() {
+		err := verifyTar(m, r)
+		// Drain the rest so that writer never blocks.
+		_, _ = io.Copy(io.Discard, r)
+		v.done <- err
+	}()
+	return v
+}
+
+func (v *TarVerifier) Write(p []byte) (int, error) {
+	return v.w.Write(p)
+}
+
+// Close finishes the stream and returns the verification result.
+func (v *TarVerifier) Close() error {
+	_ = v.w.Close()
+	return <-v.done
+}
+
+func verifyTar(m *Manifest, r io.Reader) error {
+	files := make(map[string]File)
+	for _, f := range m.Files {
+		files[f.Path] = f
+	}
+	treader := tar.NewReader(r)
+	for {
+		h, err := treader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+		f, ok := files[h.Name]
+		if !ok {
+			return fmt.Errorf("File %v is not in the signed manifest", h.Name)
+		}
+		delete(files, h.Name)
+		if h.Size != f.Size {
+			return fmt.Errorf("File %v size mismatch: got %v, signed %v", h.Name, h.Size, f.Size)
+		}
+		for i, c := range f.Chunks {
+			data := make([]byte, c.Size)
+			if _, err = io.ReadFull(treader, data); err != nil {
+				return fmt.Errorf("File %v: failed to read chunk %v: %v", h.Name, i, err)
+			}
+			if utils.CalcHash(data) != c.Hash {
+				return fmt.Errorf("File %v: chunk %v content differs from the signed one", h.Name, i)
+			}
+		}
+	}
+	for path := range files {
+		// Hidden files are not included in the archive.
+		if strings.HasPrefix(path, ".") {
+			continue
+		}
+		return fmt.Errorf("File %v from the signed manifest is missing", path)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Package metrics defines Prometheus metrics of pluk server and plukefs.
+*/
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "pluk"
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route and response status.",
+		},
+		[]string{"method", "route", "status"},
+	)
+	HTTPDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latencies by route.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "route"},
+	)
+	GrpcRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "gRPC chunk calls served (side=server) or made (side=client) by code.",
+		},
+		[]string{"side", "method", "code"},
+	)
+	GrpcDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "gRPC chunk call latencies.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"side", "method"},
+	)
+	ChunkBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chunk_bytes_total",
+			Help:      "Chunk bytes read (op=read) from local disk or master and written (op=write) to local disk.",
+		},
+		[]string{"op", "source"},
+	)
+	MasterFallbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chunk_master_fallbacks_total",
+			Help:      "Chunks missing locally and downloaded from master by outcome.",
+		},
+		[]string{"outcome"},
+	)
+	MasterDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "master_request_duration_seconds",
+			Help:      "Round-trip latencies of requests to master.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+	FSCache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fs_cache_requests_total",
+			Help:      "Version file structure cache lookups by result (hit or miss).",
+		},
+		[]string{"result"},
+	)
+	WebsocketConnections = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "websocket_connections",
+			Help:      "Slaves connected to the websocket hub.",
+		},
+	)
+	GCDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "gc_deleted_total",
+			Help:      "Objects deleted by garbage collector by kind.",
+		},
+		[]string{"kind"},
+	)
+	GCDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "gc_duration_seconds",
+			Help:      "Durations of garbage collector (run=gc) and clearing chunks (run=clear-chunks).",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 4, 10),
+		},
+		[]string{"run"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequests,
+		HTTPDuration,
+		GrpcRequests,
+		GrpcDuration,
+		ChunkBytes,
+		MasterFallbacks,
+		MasterDuration,
+		FSCache,
+		WebsocketConnections,
+		GCDeleted,
+		GCDuration,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve exposes metrics on the separate address, e.g. ":9090".
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	logrus.Infof("Serving metrics at %v/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logrus.Errorf("Failed to serve metrics: %v", err)
+	}
+}
+
+func Since(h prometheus.Observer, t time.Time) {
+	h.Observe(time.Since(t).Seconds())
+}
+
+func GrpcServerInterceptor(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	t := time.Now()
+	resp, err := handler(ctx, req)
+	observeGrpc("server", info.FullMethod, t, err)
+	return resp, err
+}
+
+func GrpcClientInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	t := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	observeGrpc("client", method, t, err)
+	return err
+}
+
+func observeGrpc(side, fullMethod string, t time.Time, err error) {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	GrpcRequests.WithLabelValues(side, method, status.Code(err).String()).Inc()
+	Since(GrpcDuration.WithLabelValues(side, method), t)
+}
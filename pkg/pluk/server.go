@@ -0,0 +1,253 @@
+// Package pluk runs the pluk server inside another program.
+package pluk
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kuberlab/pluk/pkg/api"
+	"github.com/kuberlab/pluk/pkg/datasets"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/gc"
+	"github.com/kuberlab/pluk/pkg/grpc"
+	"github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
+	grpclib "google.golang.org/grpc"
+)
+
+// Options are the dependencies of the Server. Nothing is read from the
+// environment or the config file: zero values disable the feature, e.g.
+// no Masters make a master and nil TLS serves plain HTTP.
+type Options struct {
+	// DataMgr is the database of the server, required. Jobs left
+	// unfinished in it by a previous process are failed by the caller
+	// with FailUnfinishedJobs.
+	DataMgr db.DataMgr
+	// ChunkDir is the directory of chunk files, required, DATA_DIR.
+	ChunkDir string
+	// Masters are the URLs of masters to sync from, MASTERS.
+	Masters []string
+	Auth    AuthOptions
+
+	// URLSigningKey is the HMAC key of signed URLs, URL_SIGNING_KEY.
+	URLSigningKey string
+	// MinFreeSpace and MinFreeInodes must stay free in ChunkDir,
+	// MIN_FREE_SPACE and MIN_FREE_INODES.
+	MinFreeSpace  int64
+	MinFreeInodes int64
+	// UploadConcurrency limits concurrent writes, 1 if not set,
+	// UPLOAD_CONCURRENCY.
+	UploadConcurrency int64
+
+	// HTTPAddr and GrpcAddr are the listen addresses, required.
+	// Port 0 picks a free port.
+	HTTPAddr string
+	GrpcAddr string
+	// TLS is the config of both listeners.
+	TLS *tls.Config
+}
+
+// AuthOptions configure authentication of requests.
+type AuthOptions struct {
+	// Mode is "local", "jwt" or empty for the auth service, AUTH_MODE.
+	Mode string
+	// ValidationURL is the URL of the auth service, AUTH_VALIDATION.
+	ValidationURL string
+	// InternalKeys are accepted from slaves, the first one is sent
+	// to masters, INTERNAL_KEY.
+	InternalKeys []string
+	// JWT is required in the jwt mode, JWT_*.
+	JWT utils.JWTSettings
+}
+
+// Server owns the API, gRPC server, garbage collector and websocket hub
+// serving one database and chunk dir. Servers of one process don't share
+// any of them, e.g. a master and its slave may run together.
+type Server struct {
+	opts     Options
+	settings *utils.Settings
+
+	api     *api.API
+	gc      *gc.Collector
+	handler http.Handler
+	http    *http.Server
+	grpc    *grpclib.Server
+
+	lock     sync.Mutex
+	httpAddr string
+	grpcAddr string
+	started  bool
+	closed   bool
+}
+
+// New builds the server; nothing is listening until Start.
+func New(opts Options) (*Server, error) {
+	switch {
+	case opts.DataMgr == nil:
+		return nil, errors.New("DataMgr is required")
+	case opts.ChunkDir == "":
+		return nil, errors.New("ChunkDir is required")
+	case opts.HTTPAddr == "" || opts.GrpcAddr == "":
+		return nil, errors.New("HTTPAddr and GrpcAddr are required")
+	}
+	settings := &utils.Settings{
+		ChunkDir:          opts.ChunkDir,
+		MasterURLs:        opts.Masters,
+		AuthMode:          opts.Auth.Mode,
+		AuthURL:           opts.Auth.ValidationURL,
+		InternalKeys:      opts.Auth.InternalKeys,
+		JWT:               opts.Auth.JWT,
+		URLSigningKey:     opts.URLSigningKey,
+		MinFreeSpace:      opts.MinFreeSpace,
+		MinFreeInodes:     opts.MinFreeInodes,
+		UploadConcurrency: opts.UploadConcurrency,
+	}
+
+	store := io.NewStore(settings, plukclient.NewInternalMasterClient(settings))
+	s := &Server{opts: opts, settings: settings, gc: gc.New(opts.DataMgr, store)}
+	s.api = api.New(opts.DataMgr, store, s.gc)
+	s.handler = api.GlobalHandler(s.api)
+	s.http = &http.Server{Handler: s.handler, TLSConfig: opts.TLS}
+	// Websockets are hijacked and not tracked by the server.
+	s.http.RegisterOnShutdown(s.api.CloseWebsockets)
+	s.grpc = grpc.NewServer(s.api, opts.TLS)
+	return s, nil
+}
+
+// API returns the API of the server.
+func (s *Server) API() *api.API {
+	return s.api
+}
+
+// Handler serves the HTTP API, e.g. to mount it into another router
+// instead of Start.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// HTTPAddr and GrpcAddr return the addresses listened after Start.
+func (s *Server) HTTPAddr() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.httpAddr
+}
+
+func (s *Server) GrpcAddr() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.grpcAddr
+}
+
+// Reload applies the auth options which may change without restart:
+// the URL of the auth service and the internal keys.
+func (s *Server) Reload(auth AuthOptions) {
+	s.settings.SetAuth(auth.ValidationURL, auth.InternalKeys)
+}
+
+// Start listens and serves in background. The gRPC listener failure
+// is reported by /healthz instead.
+func (s *Server) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started {
+		return errors.New("Server is already started")
+	}
+	logrus.Info("Starting pluke...")
+	s.settings.PrintInfo()
+
+	httpLn, err := net.Listen("tcp", s.opts.HTTPAddr)
+	if err != nil {
+		return err
+	}
+	s.httpAddr = httpLn.Addr().String()
+	if s.opts.TLS != nil {
+		httpLn = tls.NewListener(httpLn, s.opts.TLS)
+	}
+	logrus.Infof("Listen at %v", s.httpAddr)
+
+	grpcLn, err := net.Listen("tcp", s.opts.GrpcAddr)
+	if err != nil {
+		logrus.Errorf("failed to listen: %v", err)
+		s.api.SetGrpcState("", err)
+	} else {
+		s.grpcAddr = grpcLn.Addr().String()
+		s.api.SetGrpcState(s.grpcAddr, nil)
+		logrus.Infof("Starting grpc server at %v", s.grpcAddr)
+		go func() {
+			if err := s.grpc.Serve(grpcLn); err != nil {
+				logrus.Errorf("failed to serve grpc: %v", err)
+			}
+		}()
+	}
+
+	go s.gc.Run()
+	go func() {
+		if err := s.http.Serve(httpLn); err != nil && err != http.ErrServerClosed {
+			logrus.Error(err)
+		}
+	}()
+	s.started = true
+	return nil
+}
+
+// Shutdown drains requests first, so nothing new is written while
+// background jobs are finishing. Cancelable jobs are cancelled, the others
+// are waited for. Remaining requests are closed and unfinished jobs are
+// marked failed when the context is done. The database is left open.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	var errs []string
+	check := func(what string, err error) {
+		if err != nil {
+			logrus.Errorf("%v shutdown: %v", what, err)
+			errs = append(errs, fmt.Sprintf("%v: %v", what, err))
+		}
+	}
+
+	if err := s.http.Shutdown(ctx); err != nil {
+		s.http.Close()
+		check("HTTP", err)
+	}
+	check("gRPC", s.stopGrpc(ctx))
+	check("GC", s.gc.Stop(ctx))
+	check("Jobs", s.api.ShutdownJobs(ctx))
+	check("Flush deletes", datasets.FlushDeletes(ctx))
+	s.api.Close()
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stopGrpc waits for in-flight calls until the context is done
+// and then closes the remaining connections.
+func (s *Server) stopGrpc(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package pluk
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+const testKey = "test-key"
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pluk-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mgr := db.NewFakeDatabaseMgr(filepath.Join(dir, "pluk.db"))
+	defer mgr.Close()
+
+	// Nothing is read from the environment.
+	os.Setenv(utils.MastersVar, "http://127.0.0.1:1")
+	defer os.Unsetenv(utils.MastersVar)
+
+	opts := Options{
+		DataMgr:  mgr,
+		ChunkDir: filepath.Join(dir, "chunks"),
+		Auth:     AuthOptions{InternalKeys: []string{testKey}},
+		HTTPAddr: "127.0.0.1:0",
+		GrpcAddr: "127.0.0.1:0",
+	}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	utils.Assert(opts.ChunkDir, s.API().Store().Settings.DataDir(), t)
+	utils.Assert(true, s.GrpcAddr() != "", t)
+	utils.Assert(false, s.API().Store().HasMasters(), t)
+
+	// Servers of one process have their own chunk dirs and keys.
+	otherMgr := db.NewFakeDatabaseMgr(filepath.Join(dir, "other.db"))
+	defer otherMgr.Close()
+	other := opts
+	other.DataMgr = otherMgr
+	other.ChunkDir = filepath.Join(dir, "other")
+	other.Auth = AuthOptions{InternalKeys: []string{"other-key"}}
+	o, err := New(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Shutdown(context.Background())
+	utils.Assert(other.ChunkDir, o.API().Store().Settings.DataDir(), t)
+	utils.Assert(true, s.API().Store().Settings.IsInternalKey(testKey), t)
+	utils.Assert(false, o.API().Store().Settings.IsInternalKey(testKey), t)
+
+	// Keys are rotated without restart.
+	o.Reload(AuthOptions{InternalKeys: []string{"new-key"}})
+	utils.Assert(true, o.API().Store().Settings.IsInternalKey("new-key"), t)
+	utils.Assert(false, o.API().Store().Settings.IsInternalKey("other-key"), t)
+
+	base := "http://" + s.HTTPAddr()
+	header := http.Header{}
+	header.Set("Internal", testKey)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+s.HTTPAddr()+utils.ApiPrefix+"/websocket", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	connections := func() int {
+		req, _ := http.NewRequest(http.MethodGet, base+utils.ApiPrefix+"/websocket/connections", nil)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var list []interface{}
+		json.NewDecoder(resp.Body).Decode(&list)
+		return len(list)
+	}
+	for i := 0; i < 50 && connections() == 0; i++ {
+		time.Sleep(time.Millisecond * 20)
+	}
+	utils.Assert(1, connections(), t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Slaves are told to reconnect elsewhere.
+	_, _, err = conn.ReadMessage()
+	utils.Assert(true, websocket.IsCloseError(err, websocket.CloseGoingAway), t)
+	_, err = http.Get(base + "/probe")
+	utils.Assert(true, err != nil, t)
+
+	// The other server is still serving.
+	resp, err := http.Get("http://" + o.HTTPAddr() + "/probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	utils.Assert(http.StatusOK, resp.StatusCode, t)
+}
@@ -5,10 +5,10 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/sirupsen/logrus"
 	plukio "github.com/kuberlab/pluk/pkg/io"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 type MultiMasterClient struct {
@@ -17,37 +17,40 @@ type MultiMasterClient struct {
 	AuthOpts    AuthOpts
 }
 
-func NewInternalMasterClient() plukio.PlukClient {
-	masters := utils.Masters()
+// NewInternalMasterClient returns the client of the masters authenticated
+// with the internal key or nil if there are no masters.
+func NewInternalMasterClient(settings *utils.Settings) plukio.PlukClient {
+	masters := settings.Masters()
 	if len(masters) == 0 {
 		return nil
 	}
 	mClient := &MultiMasterClient{
 		Masters: masters,
 		AuthOpts: AuthOpts{
-			InternalKey:        utils.InternalKey(),
-			InsecureSkipVerify: true,
+			InternalKey: settings.InternalKey(),
+			TLS:         utils.NodeTLSConfig(),
 		},
 	}
 	mClient.initAllClients()
 	return mClient
 }
 
-func NewMasterClientWithSecret(workspace, secret string) plukio.PlukClient {
-	masters := utils.Masters()
-	mClient := &MultiMasterClient{Masters: masters, AuthOpts: AuthOpts{Workspace: workspace, Secret: secret}}
+func NewMasterClientWithSecret(masters []string, workspace, secret string) plukio.PlukClient {
+	mClient := &MultiMasterClient{
+		Masters:  masters,
+		AuthOpts: AuthOpts{Workspace: workspace, Secret: secret, TLS: utils.ClientTLSConfig()},
+	}
 	mClient.initAllClients()
 	return mClient
 }
 
-func NewMasterClientFromHeaders(headers http.Header) plukio.PlukClient {
-	masters := utils.Masters()
+func NewMasterClientFromHeaders(masters []string, headers http.Header) plukio.PlukClient {
 	auth := AuthOpts{
-		Cookie:             headers.Get("Cookie"),
-		Workspace:          headers.Get("X-Workspace-Name"),
-		Secret:             headers.Get("X-Workspace-Secret"),
-		Token:              strings.TrimPrefix(headers.Get("Authorization"), "Bearer "),
-		InsecureSkipVerify: true,
+		Cookie:    headers.Get("Cookie"),
+		Workspace: headers.Get("X-Workspace-Name"),
+		Secret:    headers.Get("X-Workspace-Secret"),
+		Token:     strings.TrimPrefix(headers.Get("Authorization"), "Bearer "),
+		TLS:       utils.ClientTLSConfig(),
 	}
 	mClient := &MultiMasterClient{Masters: masters, AuthOpts: auth}
 	mClient.initAllClients()
@@ -172,6 +175,17 @@ func (c *MultiMasterClient) GetVersion(entityType, workspace, name, version stri
 	return nil, err
 }
 
+func (c *MultiMasterClient) GetManifestSignature(entityType, workspace, name, version string) (res *types.ManifestSignature, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.GetManifestSignature(entityType, workspace, name, version)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
 func (c *MultiMasterClient) CreateEntity(entityType, workspace, name string) (res *types.Dataset, err error) {
 	for _, cl := range c.baseClients {
 		res, err = cl.CreateEntity(entityType, workspace, name)
@@ -371,6 +385,184 @@ func (c *MultiMasterClient) DeleteEntity(entityType, workspace, name string, for
 	return err
 }
 
+func (c *MultiMasterClient) ReopenVersion(entityType, workspace, name, version string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.ReopenVersion(entityType, workspace, name, version)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) RestoreEntity(entityType, workspace, name string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.RestoreEntity(entityType, workspace, name)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) RenameEntity(entityType, workspace, name, targetWorkspace, targetName string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.RenameEntity(entityType, workspace, name, targetWorkspace, targetName)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) RestoreVersion(entityType, workspace, name, version string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.RestoreVersion(entityType, workspace, name, version)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) GetRetentionPolicy(entityType, workspace, name string) (res *types.RetentionPolicy, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.GetRetentionPolicy(entityType, workspace, name)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
+func (c *MultiMasterClient) SetRetentionPolicy(entityType, workspace, name string, policy *types.RetentionPolicy) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.SetRetentionPolicy(entityType, workspace, name, policy)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) DeleteRetentionPolicy(entityType, workspace, name string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.DeleteRetentionPolicy(entityType, workspace, name)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) RetentionDryRun(entityType, workspace, name string) (res *types.VersionList, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.RetentionDryRun(entityType, workspace, name)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
+func (c *MultiMasterClient) GetWorkspaceQuota(workspace string) (res *types.WorkspaceQuota, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.GetWorkspaceQuota(workspace)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
+func (c *MultiMasterClient) SetWorkspaceQuota(workspace string, quota *types.WorkspaceQuota) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.SetWorkspaceQuota(workspace, quota)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) DeleteWorkspaceQuota(workspace string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.DeleteWorkspaceQuota(workspace)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) GetWorkspaceUsage(workspace string) (res *types.WorkspaceUsage, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.GetWorkspaceUsage(workspace)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
+func (c *MultiMasterClient) GetStorageStats(entityType, workspace, name, version string,
+	versions bool) (res *types.StorageStats, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.GetStorageStats(entityType, workspace, name, version, versions)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
+func (c *MultiMasterClient) MoveFiles(entityType, workspace, name, version, from, to string) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.MoveFiles(entityType, workspace, name, version, from, to)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) CopyFiles(entityType, workspace, name, version, to string, src types.FileSource) (err error) {
+	for _, cl := range c.baseClients {
+		err = cl.CopyFiles(entityType, workspace, name, version, to, src)
+		if err != nil {
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *MultiMasterClient) MergeVersion(entityType, workspace, name, version, theirs, base string,
+	resolutions map[string]string) (res *types.MergeResult, err error) {
+	for _, cl := range c.baseClients {
+		res, err = cl.MergeVersion(entityType, workspace, name, version, theirs, base, resolutions)
+		if err != nil {
+			continue
+		}
+		return res, err
+	}
+	return nil, err
+}
+
 func (c *MultiMasterClient) DeleteVersion(entityType, workspace, name, version string) (err error) {
 	for _, cl := range c.baseClients {
 		if err != nil {
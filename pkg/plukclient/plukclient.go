@@ -8,7 +8,6 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"golang.org/x/sync/semaphore"
 	"io"
 	"io/ioutil"
 	"net"
@@ -19,14 +18,16 @@ import (
 	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/gorilla/websocket"
 	"github.com/json-iterator/go"
 	liberrs "github.com/kuberlab/lib/pkg/errors"
 	libtypes "github.com/kuberlab/lib/pkg/types"
 	plukio "github.com/kuberlab/pluk/pkg/io"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/kuberlab/pluk/pkg/types"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -48,6 +49,15 @@ type AuthOpts struct {
 	Workspace          string
 	Secret             string
 	InsecureSkipVerify bool
+	// TLS overrides InsecureSkipVerify for https servers if set.
+	TLS *tls.Config
+}
+
+func (auth *AuthOpts) tlsConfig() *tls.Config {
+	if auth.TLS != nil {
+		return auth.TLS.Clone()
+	}
+	return &tls.Config{InsecureSkipVerify: auth.InsecureSkipVerify}
 }
 
 var AllowedTypes = map[string]bool{
@@ -90,7 +100,7 @@ func NewClient(baseURL string, auth *AuthOpts) (*Client, error) {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 	if base.Scheme == "https" {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: auth.InsecureSkipVerify}
+		transport.TLSClientConfig = auth.tlsConfig()
 	}
 	baseClient := &http.Client{Timeout: time.Hour * 8, Transport: transport}
 
@@ -112,10 +122,7 @@ func (c *Client) PrepareWebsocket(num int64) error {
 	case "http":
 		scheme = "ws"
 	case "https":
-		tlsConf := &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		dialer.TLSClientConfig = tlsConf
+		dialer.TLSClientConfig = c.auth.tlsConfig()
 		scheme = "wss"
 	}
 	u := fmt.Sprintf("%v://%v/%v", scheme, c.BaseURL.Host, strings.TrimPrefix(c.BaseURL.Path, "/"))
@@ -338,6 +345,23 @@ func (c *Client) GetVersion(entityType, workspace, name, version string) (*types
 	return res, err
 }
 
+func (c *Client) GetManifestSignature(entityType, workspace, name, version string) (*types.ManifestSignature, error) {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/manifest.sig", entityType, workspace, name, version)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.ManifestSignature)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
 func (c *Client) CreateEntity(entityType, workspace, name string) (*types.Dataset, error) {
 	u := fmt.Sprintf("/%v/%v/%v", entityType, workspace, name)
 
@@ -372,6 +396,38 @@ func (c *Client) CreateVersion(entityType, workspace, name, version string) (*ty
 	return res, err
 }
 
+func (c *Client) CommitVersion(entityType, workspace, name, version, message string) (*types.Version, error) {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/commit", entityType, workspace, name, version)
+	if message != "" {
+		query := url.Values{}
+		query.Set("message", message)
+		u = u + "?" + query.Encode()
+	}
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.Version)
+	_, err = c.Do(req, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) ReopenVersion(entityType, workspace, name, version string) error {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/reopen", entityType, workspace, name, version)
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
 func (c *Client) ListVersions(entityType, workspace, datasetName string) (*types.VersionList, error) {
 	u := fmt.Sprintf("/%v/%v/%v/versions", entityType, workspace, datasetName)
 
@@ -462,7 +518,9 @@ func (c *Client) DownloadFile(entityType, workspace, entityName, version, fileNa
 		return nil, err
 	}
 	logrus.Debugf("[go-plukclient] %v %v", req.Method, req.URL)
+	t := time.Now()
 	resp, err := c.Client.Do(req)
+	metrics.Since(metrics.MasterDuration.WithLabelValues(req.Method), t)
 
 	if err != nil {
 		return nil, err
@@ -514,7 +572,9 @@ func (c *Client) DownloadChunk(hash string, version byte) (io.ReadCloser, error)
 		return nil, err
 	}
 	logrus.Debugf("[go-plukclient] %v %v", req.Method, req.URL)
+	t := time.Now()
 	resp, err := c.Client.Do(req)
+	metrics.Since(metrics.MasterDuration.WithLabelValues(req.Method), t)
 
 	if err != nil {
 		return nil, err
@@ -674,6 +734,13 @@ func (c *Client) websocketReadWrite(read bool, ws *types.WebsocketClient, msg ty
 		c.releaseWebsocket(ws)
 	}
 	if read {
+		if libmsg.Type == "error" {
+			e := &liberrs.Error{}
+			if err = utils.LoadAsJson(libmsg.Content.(map[string]interface{}), e); err != nil {
+				return err
+			}
+			return e
+		}
 		if err = utils.LoadAsJson(libmsg.Content.(map[string]interface{}), msg); err != nil {
 			return err
 		}
@@ -763,6 +830,441 @@ func (c *Client) DeleteEntity(entityType, workspace, name string, force bool) er
 	return err
 }
 
+func (c *Client) RestoreEntity(entityType, workspace, name string) error {
+	u := fmt.Sprintf("/%v/%v/%v/restore", entityType, workspace, name)
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) RenameEntity(entityType, workspace, name, targetWorkspace, targetName string) error {
+	u := fmt.Sprintf("/%v/%v/%v/move/%v", entityType, workspace, name, targetWorkspace)
+
+	query := url.Values{}
+	query.Set("name", targetName)
+	u = u + "?" + query.Encode()
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) RestoreVersion(entityType, workspace, name, version string) error {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/restore", entityType, workspace, name, version)
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) GetRetentionPolicy(entityType, workspace, name string) (*types.RetentionPolicy, error) {
+	u := fmt.Sprintf("/%v/%v/%v/retention", entityType, workspace, name)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.RetentionPolicy)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) SetRetentionPolicy(entityType, workspace, name string, policy *types.RetentionPolicy) error {
+	u := fmt.Sprintf("/%v/%v/%v/retention", entityType, workspace, name)
+
+	req, err := c.NewRequest("PUT", u, policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) DeleteRetentionPolicy(entityType, workspace, name string) error {
+	u := fmt.Sprintf("/%v/%v/%v/retention", entityType, workspace, name)
+
+	req, err := c.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) RetentionDryRun(entityType, workspace, name string) (*types.VersionList, error) {
+	u := fmt.Sprintf("/%v/%v/%v/retention/dry-run", entityType, workspace, name)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.VersionList)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) GetWorkspaceQuota(workspace string) (*types.WorkspaceQuota, error) {
+	u := fmt.Sprintf("/quotas/%v", workspace)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.WorkspaceQuota)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) SetWorkspaceQuota(workspace string, quota *types.WorkspaceQuota) error {
+	u := fmt.Sprintf("/quotas/%v", workspace)
+
+	req, err := c.NewRequest("PUT", u, quota)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) DeleteWorkspaceQuota(workspace string) error {
+	u := fmt.Sprintf("/quotas/%v", workspace)
+
+	req, err := c.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) GetWorkspaceUsage(workspace string) (*types.WorkspaceUsage, error) {
+	u := fmt.Sprintf("/usage/%v", workspace)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.WorkspaceUsage)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) GetStorageStats(entityType, workspace, name, version string, versions bool) (*types.StorageStats, error) {
+	u := fmt.Sprintf("/%v/%v/%v/stats", entityType, workspace, name)
+	if version != "" {
+		u = fmt.Sprintf("/%v/%v/%v/versions/%v/stats", entityType, workspace, name, version)
+	}
+
+	query := url.Values{}
+	if versions {
+		query.Set("versions", "true")
+	}
+	u = u + "?" + query.Encode()
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.StorageStats)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) ListUsers() (*types.UserList, error) {
+	req, err := c.NewRequest("GET", "/admin/users", nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.UserList)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) CreateUser(user *types.User) error {
+	req, err := c.NewRequest("POST", "/admin/users", user)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) DeleteUser(name string) error {
+	u := fmt.Sprintf("/admin/users/%v", name)
+
+	req, err := c.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) ListTokens(user string) (*types.TokenList, error) {
+	u := "/admin/tokens"
+	if user != "" {
+		u += "?user=" + url.QueryEscape(user)
+	}
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.TokenList)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+// CreateToken issues the token; the result contains the token itself.
+func (c *Client) CreateToken(token *types.Token) (*types.Token, error) {
+	req, err := c.NewRequest("POST", "/admin/tokens", token)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.Token)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) DeleteToken(id uint) error {
+	u := fmt.Sprintf("/admin/tokens/%v", id)
+
+	req, err := c.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+// SignURL returns the signed URL of the file or, if the path is empty,
+// of the version archive. Zero expires means the server default.
+func (c *Client) SignURL(entityType, workspace, name, version, path string,
+	expires time.Duration, ip string, maxSize int64) (*types.SignedURL, error) {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/signed-url", entityType, workspace, name, version)
+
+	query := url.Values{}
+	if path != "" {
+		query.Set("path", path)
+	}
+	if expires > 0 {
+		query.Set("expires", expires.String())
+	}
+	if ip != "" {
+		query.Set("ip", ip)
+	}
+	if maxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(maxSize, 10))
+	}
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.SignedURL)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+// aclURL returns the URL of the dataset ACL or of the workspace default
+// one if the name is empty.
+func aclURL(entityType, workspace, name string) string {
+	if name == "" {
+		return fmt.Sprintf("/acl/%v/%v", entityType, workspace)
+	}
+	return fmt.Sprintf("/%v/%v/%v/acl", entityType, workspace, name)
+}
+
+func (c *Client) GetEntityACL(entityType, workspace, name string) (*types.EntityACL, error) {
+	req, err := c.NewRequest("GET", aclURL(entityType, workspace, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.EntityACL)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) SetEntityACL(acl *types.EntityACL) (*types.EntityACL, error) {
+	req, err := c.NewRequest("PUT", aclURL(acl.Type, acl.Workspace, acl.Name), acl)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.EntityACL)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) DeleteEntityACL(entityType, workspace, name string) error {
+	req, err := c.NewRequest("DELETE", aclURL(entityType, workspace, name), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) MoveFiles(entityType, workspace, name, version, from, to string) error {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/move", entityType, workspace, name, version)
+
+	query := url.Values{}
+	query.Set("from", from)
+	query.Set("to", to)
+	u = u + "?" + query.Encode()
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) CopyFiles(entityType, workspace, name, version, to string, src types.FileSource) error {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/copy", entityType, workspace, name, version)
+
+	query := url.Values{}
+	query.Set("from", src.Path)
+	query.Set("to", to)
+	if src.Workspace != "" {
+		query.Set("source_workspace", src.Workspace)
+	}
+	if src.Name != "" {
+		query.Set("source_name", src.Name)
+	}
+	if src.Version != "" {
+		query.Set("source_version", src.Version)
+	}
+	u = u + "?" + query.Encode()
+
+	req, err := c.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+func (c *Client) MergeVersion(entityType, workspace, name, version, theirs, base string,
+	resolutions map[string]string) (*types.MergeResult, error) {
+	u := fmt.Sprintf("/%v/%v/%v/versions/%v/merge/%v", entityType, workspace, name, version, theirs)
+
+	query := url.Values{}
+	query.Set("base", base)
+	u = u + "?" + query.Encode()
+
+	req, err := c.NewRequest("POST", u, types.MergeRequest{Resolutions: resolutions})
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.MergeResult)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
+func (c *Client) ListTrash(entityType, workspace string) (*types.TrashList, error) {
+	u := fmt.Sprintf("/trash/%v/%v", entityType, workspace)
+
+	req, err := c.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := new(types.TrashList)
+	_, err = c.Do(req, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, err
+}
+
 func (c *Client) DeleteVersion(entityType, workspace, name, version string) error {
 	u := fmt.Sprintf("/%v/%v/%v/versions/%v", entityType, workspace, name, version)
 
@@ -799,7 +1301,9 @@ func (c *Client) WebdavAuth(user, pass, path string) (bool, error) {
 // first decode it.
 func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 	logrus.Debugf("[go-plukclient] %v %v", req.Method, req.URL)
+	t := time.Now()
 	resp, err := c.Client.Do(req)
+	metrics.Since(metrics.MasterDuration.WithLabelValues(req.Method), t)
 	if err != nil {
 		if e, ok := err.(*url.Error); ok {
 			return nil, e
@@ -0,0 +1,133 @@
+// Package pluktest starts pluk servers for integration tests of programs
+// using plukclient.
+package pluktest
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuberlab/pluk/pkg/db"
+	"github.com/kuberlab/pluk/pkg/pluk"
+	"github.com/kuberlab/pluk/pkg/plukclient"
+)
+
+// InternalKey is accepted by all servers started by the package.
+const InternalKey = "pluktest-internal-key"
+
+const stopTimeout = time.Second * 10
+
+// Server is a pluk server listening on an ephemeral port with its own
+// sqlite database and data dir in a temp dir. It is closed at the end
+// of the test. Any number of servers may run at once, e.g. in parallel
+// tests.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:PORT.
+	URL string
+	// Dir holds the database file pluk.db and the data dir data.
+	Dir string
+
+	server *pluk.Server
+	mgr    *db.DatabaseMgr
+	once   sync.Once
+}
+
+// NewServer starts the server in this process.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	return startServer(t, "")
+}
+
+// NewPair starts the master and its slave in this process.
+func NewPair(t testing.TB) (master, slave *Server) {
+	t.Helper()
+	master = startServer(t, "")
+	slave = startServer(t, master.URL)
+	return master, slave
+}
+
+// Client returns the client of the server authenticated with the options,
+// anonymous if auth is nil.
+func (s *Server) Client(t testing.TB, auth *plukclient.AuthOpts) *plukclient.Client {
+	t.Helper()
+	client, err := plukclient.NewClient(s.URL, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// Close stops the server and releases its database.
+func (s *Server) Close() {
+	s.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+		s.server.Shutdown(ctx)
+		s.mgr.Close()
+	})
+}
+
+// Seed creates the version of the entity with the files, path to content,
+// and commits it. The entity is created if it doesn't exist; slaves create
+// it only locally, so seed new entities on the master of a pair.
+func Seed(t testing.TB, client *plukclient.Client, entityType, workspace, name, version string, files map[string]string) {
+	t.Helper()
+	if _, err := client.GetEntity(entityType, workspace, name); err != nil {
+		if _, err = client.CreateEntity(entityType, workspace, name); err != nil {
+			t.Fatalf("Create %v %v/%v: %v", entityType, workspace, name, err)
+		}
+	}
+	if _, err := client.CreateVersion(entityType, workspace, name, version); err != nil {
+		t.Fatalf("Create version %v: %v", version, err)
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		body := ioutil.NopCloser(strings.NewReader(files[path]))
+		if _, err := client.UploadFile(entityType, workspace, name, version, path, body); err != nil {
+			t.Fatalf("Upload %v: %v", path, err)
+		}
+	}
+	if _, err := client.CommitVersion(entityType, workspace, name, version, ""); err != nil {
+		t.Fatalf("Commit version %v: %v", version, err)
+	}
+}
+
+func startServer(t testing.TB, master string) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	var masters []string
+	if master != "" {
+		masters = []string{master}
+	}
+	mgr := db.NewFakeDatabaseMgr(filepath.Join(dir, "pluk.db"))
+	// Only these options are used, so MASTERS, AUTH_MODE, TLS_CERT_FILE
+	// and the like of the test process don't change the server: it has no
+	// auth service and speaks plain HTTP.
+	server, err := pluk.New(pluk.Options{
+		DataMgr:  mgr,
+		ChunkDir: filepath.Join(dir, "data"),
+		Masters:  masters,
+		Auth:     pluk.AuthOptions{InternalKeys: []string{InternalKey}},
+		HTTPAddr: "127.0.0.1:0",
+		GrpcAddr: "127.0.0.1:0",
+	})
+	if err == nil {
+		err = server.Start()
+	}
+	if err != nil {
+		mgr.Close()
+		t.Fatal(err)
+	}
+	s := &Server{URL: "http://" + server.HTTPAddr(), Dir: dir, server: server, mgr: mgr}
+	t.Cleanup(s.Close)
+	return s
+}
@@ -0,0 +1,83 @@
+package pluktest
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/kuberlab/pluk/pkg/plukclient"
+	"github.com/kuberlab/pluk/pkg/utils"
+)
+
+func readFile(t *testing.T, client *plukclient.Client, version, path string) string {
+	r, err := client.DownloadFile("dataset", "workspace", "dataset", version, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, _ := ioutil.ReadAll(r)
+	return string(data)
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	s := NewServer(t)
+	client := s.Client(t, nil)
+
+	Seed(t, client, "dataset", "workspace", "dataset", "1.0.0", map[string]string{
+		"a.txt":     "first",
+		"dir/b.txt": "second",
+	})
+	Seed(t, client, "dataset", "workspace", "dataset", "1.0.1", map[string]string{"a.txt": "changed"})
+
+	versions, err := client.ListVersions("dataset", "workspace", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(2, len(versions.Versions), t)
+	utils.Assert("second", readFile(t, client, "1.0.0", "dir/b.txt"), t)
+	utils.Assert("changed", readFile(t, client, "1.0.1", "a.txt"), t)
+
+	// The internal key is accepted.
+	internal := s.Client(t, &plukclient.AuthOpts{InternalKey: InternalKey})
+	_, err = internal.GetEntity("dataset", "workspace", "dataset")
+	utils.Assert(nil, err, t)
+}
+
+func TestPair(t *testing.T) {
+	t.Parallel()
+	master, slave := NewPair(t)
+
+	// Entities are created on the master, slaves serve and extend them.
+	Seed(t, master.Client(t, nil), "dataset", "workspace", "dataset", "1.0.0", map[string]string{"a.txt": "first"})
+	utils.Assert("first", readFile(t, slave.Client(t, nil), "1.0.0", "a.txt"), t)
+
+	Seed(t, slave.Client(t, nil), "dataset", "workspace", "dataset", "1.0.1", map[string]string{"a.txt": "second"})
+	utils.Assert("second", readFile(t, master.Client(t, nil), "1.0.1", "a.txt"), t)
+}
+
+func TestServers(t *testing.T) {
+	t.Parallel()
+	a, b := NewServer(t), NewServer(t)
+
+	// Servers of one process don't share entities or chunks.
+	Seed(t, a.Client(t, nil), "dataset", "workspace", "dataset", "1.0.0", map[string]string{"a.txt": "first"})
+	_, err := b.Client(t, nil).GetEntity("dataset", "workspace", "dataset")
+	utils.Assert(true, err != nil, t)
+	Seed(t, b.Client(t, nil), "dataset", "workspace", "dataset", "1.0.0", map[string]string{"a.txt": "other"})
+	utils.Assert("first", readFile(t, a.Client(t, nil), "1.0.0", "a.txt"), t)
+	utils.Assert("other", readFile(t, b.Client(t, nil), "1.0.0", "a.txt"), t)
+}
+
+func TestIgnoresEnvironment(t *testing.T) {
+	t.Setenv(utils.MastersVar, "http://127.0.0.1:1")
+	t.Setenv("AUTH_MODE", "local")
+	t.Setenv("TLS_CERT_FILE", "/nonexistent/cert.pem")
+	t.Setenv("TLS_KEY_FILE", "/nonexistent/key.pem")
+	s := NewServer(t)
+
+	// The master is not a slave and serves plain HTTP without tokens.
+	client := s.Client(t, nil)
+	Seed(t, client, "dataset", "workspace", "dataset", "1.0.0", map[string]string{"a.txt": "first"})
+	utils.Assert("first", readFile(t, client, "1.0.0", "a.txt"), t)
+	utils.Assert(false, s.server.API().Store().HasMasters(), t)
+}
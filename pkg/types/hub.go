@@ -4,6 +4,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/kuberlab/pluk/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -80,6 +82,9 @@ func (h *Hub) Register(client *WebsocketClient) {
 	defer h.lock.Unlock()
 	h.lastMessages.CheckExpire()
 	h.PushMany(client, h.lastMessages.messages)
+	if !h.connections[client] {
+		metrics.WebsocketConnections.Inc()
+	}
 	h.connections[client] = true
 }
 
@@ -98,6 +103,21 @@ func (h *Hub) Drop(client *WebsocketClient) {
 	defer h.lock.Unlock()
 	if _, ok := h.connections[client]; ok {
 		delete(h.connections, client)
+		metrics.WebsocketConnections.Dec()
+	}
+}
+
+// Close tells all clients that the server is going away and closes
+// their connections.
+func (h *Hub) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for client := range h.connections {
+		delete(h.connections, client)
+		metrics.WebsocketConnections.Dec()
+		if err := client.Close(websocket.CloseGoingAway, "server shutdown"); err != nil {
+			logrus.Error(err)
+		}
 	}
 }
 
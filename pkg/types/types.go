@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"os"
 	"sync"
 	"time"
@@ -90,6 +91,73 @@ func (dv *Version) Type() string {
 	return "dataset_version"
 }
 
+type TrashItem struct {
+	Workspace string    `json:"workspace"`
+	Name      string    `json:"name"`
+	DType     string    `json:"type"`
+	Version   string    `json:"version,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type TrashList struct {
+	Items []TrashItem `json:"items"`
+}
+
+// RetentionPolicy defines which versions are deleted automatically:
+// committed versions beyond the KeepLast newest ones and older than KeepDays,
+// and editing versions not updated for EditingDays. Zero value disables a rule.
+// Versions matching any of Exclude patterns are never deleted.
+type RetentionPolicy struct {
+	KeepLast    int      `json:"keep_last,omitempty"`
+	KeepDays    int      `json:"keep_days,omitempty"`
+	EditingDays int      `json:"editing_days,omitempty"`
+	Exclude     []string `json:"exclude,omitempty"`
+}
+
+// WorkspaceQuota limits the logical size of the workspace, 0 means unlimited.
+type WorkspaceQuota struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// WorkspaceUsage reports the storage used by the workspace. LogicalBytes is
+// the sum of all version sizes, PhysicalBytes is the size of deduplicated
+// chunks referenced only by this workspace and SharedBytes is the size of
+// chunks also referenced by other workspaces.
+type WorkspaceUsage struct {
+	Workspace     string `json:"workspace"`
+	LogicalBytes  int64  `json:"logical_bytes"`
+	PhysicalBytes int64  `json:"physical_bytes"`
+	SharedBytes   int64  `json:"shared_bytes"`
+	QuotaBytes    int64  `json:"quota_bytes"`
+}
+
+// StorageStats reports the storage used by the dataset or its version.
+// UniqueBytes is the size of distinct chunks, SharedBytes is the part of it
+// also used by other versions or datasets and ExclusiveBytes is what deleting
+// the dataset or version would free. DedupRatio is LogicalBytes to UniqueBytes.
+type StorageStats struct {
+	Workspace      string         `json:"workspace"`
+	Name           string         `json:"name"`
+	Version        string         `json:"version,omitempty"`
+	Files          int64          `json:"files"`
+	LogicalBytes   int64          `json:"logical_bytes"`
+	UniqueChunks   int64          `json:"unique_chunks"`
+	UniqueBytes    int64          `json:"unique_bytes"`
+	SharedBytes    int64          `json:"shared_bytes"`
+	ExclusiveBytes int64          `json:"exclusive_bytes"`
+	DedupRatio     float64        `json:"dedup_ratio"`
+	Versions       []StorageStats `json:"versions,omitempty"`
+}
+
+// FileSource points to the file or directory copied from another version.
+type FileSource struct {
+	Workspace string `json:"workspace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Path      string `json:"path"`
+}
+
 type SaveOpts struct {
 	Comment string
 	Create  bool
@@ -115,6 +183,13 @@ type Hash struct {
 	Version byte   `json:"version"`
 }
 
+type ManifestSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
 type ChunkCheck struct {
 	Hash   string `json:"hash"`
 	Size   int64  `json:"size"`
@@ -157,9 +232,155 @@ func (c *WebsocketClient) closeHandler() {
 
 }
 
+// Close sends the close message and closes the connection.
+func (c *WebsocketClient) Close(code int, text string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Closed = true
+	msg := websocket.FormatCloseMessage(code, text)
+	err := c.Ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.Ws.Close()
+	return err
+}
+
 func (c *WebsocketClient) WriteMessage(sType string, content interface{}) error {
 	// Prevent concurrent socket writes.
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	return utils.WriteMessage(c.Ws, sType, c.ID, content)
 }
+
+// IngestProgress is reported while an uploaded archive is being saved as a version.
+type IngestProgress struct {
+	Files  int         `json:"files"`
+	Bytes  int64       `json:"bytes"`
+	Path   string      `json:"path,omitempty"`
+	Done   bool        `json:"done"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// Job is the state of the long-running server operation.
+type Job struct {
+	ID         uint            `json:"id"`
+	Type       string          `json:"type"`
+	State      string          `json:"state"`
+	Workspace  string          `json:"workspace,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	EntityType string          `json:"entity_type,omitempty"`
+	Target     string          `json:"target,omitempty"`
+	Done       int64           `json:"done"`
+	Total      int64           `json:"total"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  types.Time      `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+type JobList struct {
+	Items []Job `json:"items"`
+}
+
+// MergeConflict describes the path changed differently in both merged versions.
+type MergeConflict struct {
+	Path   string `json:"path"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+}
+
+type MergeResult struct {
+	Added     []string        `json:"added"`
+	Modified  []string        `json:"modified"`
+	Deleted   []string        `json:"deleted"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+// MergeRequest resolves conflicts of the previous merge: path -> "ours" or "theirs".
+type MergeRequest struct {
+	Resolutions map[string]string `json:"resolutions,omitempty"`
+}
+
+// AuditRecord tells who did the mutating operation, on what and with which outcome.
+type AuditRecord struct {
+	ID         uint      `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Action     string    `json:"action"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Workspace  string    `json:"workspace,omitempty"`
+	EntityType string    `json:"entity_type,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+}
+
+type AuditList struct {
+	Items []AuditRecord `json:"items"`
+}
+
+// TokenScope grants read or write access to the workspace, "*" means any workspace.
+type TokenScope struct {
+	Workspace string `json:"workspace"`
+	Access    string `json:"access"`
+}
+
+type User struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+type UserList struct {
+	Items []User `json:"items"`
+}
+
+// Token is the API token of the built-in authentication. The token itself
+// is returned only once, when it is created.
+type Token struct {
+	ID        uint         `json:"id"`
+	User      string       `json:"user"`
+	Name      string       `json:"name"`
+	Scopes    []TokenScope `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	CreatedAt types.Time   `json:"created_at"`
+	Token     string       `json:"token,omitempty"`
+}
+
+type TokenList struct {
+	Items []Token `json:"items"`
+}
+
+// Health is the breakdown of health or readiness checks; Status is "ok"
+// only if all the checks are "ok".
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// EntityACL is the access control list of the dataset or, if the name is
+// empty, the default list for all datasets of the workspace.
+type EntityACL struct {
+	Type       string   `json:"type"`
+	Workspace  string   `json:"workspace"`
+	Name       string   `json:"name,omitempty"`
+	Owner      string   `json:"owner"`
+	Readers    []string `json:"readers"`
+	Writers    []string `json:"writers"`
+	PublicRead bool     `json:"public_read"`
+}
+
+// SignedURL gives GET access to a file, a version archive or a chunk
+// without authentication until ExpiresAt.
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
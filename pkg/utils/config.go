@@ -0,0 +1,372 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileVar points to the YAML config file of the server.
+const ConfigFileVar = "PLUK_CONFIG"
+
+const redacted = "<redacted>"
+
+// ServerConfig is the schema of the config file. Environment variables
+// override values from the file.
+type ServerConfig struct {
+	DataDir     string            `yaml:"data_dir" json:"data_dir"`
+	HTTPPort    int               `yaml:"http_port" json:"http_port"`
+	GrpcPort    int               `yaml:"grpc_port" json:"grpc_port"`
+	Masters     []string          `yaml:"masters" json:"masters"`
+	Proxies     []string          `yaml:"trusted_proxies" json:"trusted_proxies"`
+	DB          DBConfig          `yaml:"db" json:"db"`
+	Auth        AuthConfig        `yaml:"auth" json:"auth"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency" json:"concurrency"`
+	GC          GCConfig          `yaml:"gc" json:"gc"`
+}
+
+type DBConfig struct {
+	Type     string `yaml:"type" json:"type"`
+	Name     string `yaml:"name" json:"name"`
+	Host     string `yaml:"host" json:"host"`
+	Port     int    `yaml:"port" json:"port"`
+	User     string `yaml:"user" json:"user"`
+	Password string `yaml:"password" json:"password"`
+}
+
+type AuthConfig struct {
+	Mode          string    `yaml:"mode" json:"mode"`
+	ValidationURL string    `yaml:"validation_url" json:"validation_url"`
+	InternalKeys  []string  `yaml:"internal_keys" json:"internal_keys"`
+	JWT           JWTConfig `yaml:"jwt" json:"jwt"`
+}
+
+type JWTConfig struct {
+	Keys        string `yaml:"keys" json:"keys"`
+	Audience    string `yaml:"audience" json:"audience"`
+	Issuer      string `yaml:"issuer" json:"issuer"`
+	UserClaim   string `yaml:"user_claim" json:"user_claim"`
+	ScopesClaim string `yaml:"scopes_claim" json:"scopes_claim"`
+}
+
+type ConcurrencyConfig struct {
+	Upload int `yaml:"upload" json:"upload"`
+}
+
+type GCConfig struct {
+	Interval       Duration `yaml:"interval" json:"interval"`
+	ChunksInterval Duration `yaml:"chunks_interval" json:"chunks_interval"`
+	TrashRetention Duration `yaml:"trash_retention" json:"trash_retention"`
+}
+
+// Duration is written as a Go duration string like 1h30m.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// setting describes the environment variable behind the config key.
+type setting struct {
+	env    string
+	key    string
+	reload bool
+	check  func(string) error
+}
+
+var settings = []setting{
+	{env: dataVar, key: "data_dir"},
+	{env: portVar, key: "http_port", check: checkPort},
+	{env: PortGrpcVar, key: "grpc_port", check: checkPort},
+	{env: MastersVar, key: "masters", check: checkURLs},
+	{env: trustedProxiesVar, key: "trusted_proxies", reload: true, check: checkNetworks},
+	{env: "DB_TYPE", key: "db.type", check: checkOneOf("sqlite3", "mysql", "postgres")},
+	{env: dbNameVar, key: "db.name"},
+	{env: dbHostVar, key: "db.host"},
+	{env: dbPortVar, key: "db.port", check: checkPort},
+	{env: dbUserVar, key: "db.user"},
+	{env: dbPassVar, key: "db.password"},
+	{env: authModeVar, key: "auth.mode", check: checkOneOf("local", "jwt")},
+	{env: authValidationVar, key: "auth.validation_url", reload: true, check: checkURLs},
+	{env: internalKeyVar, key: "auth.internal_keys", reload: true},
+	{env: jwtKeysVar, key: "auth.jwt.keys"},
+	{env: jwtAudienceVar, key: "auth.jwt.audience"},
+	{env: jwtIssuerVar, key: "auth.jwt.issuer"},
+	{env: jwtUserClaimVar, key: "auth.jwt.user_claim"},
+	{env: jwtScopesClaimVar, key: "auth.jwt.scopes_claim"},
+	{env: uploadConcurrencyVar, key: "concurrency.upload", check: checkPositive},
+	{env: gcIntervalVar, key: "gc.interval", reload: true, check: checkDuration},
+	{env: gcChunksIntervalVar, key: "gc.chunks_interval", reload: true, check: checkDuration},
+	{env: trashRetentionVar, key: "gc.trash_retention", reload: true, check: checkDuration},
+}
+
+var fileConfig = struct {
+	sync.RWMutex
+	values map[string]string
+}{}
+
+// Getenv returns the environment variable or, if it is empty,
+// the value from the config file.
+func Getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	fileConfig.RLock()
+	defer fileConfig.RUnlock()
+	return fileConfig.values[name]
+}
+
+// LoadConfig reads the config file if ConfigFileVar is set and validates
+// the resulting settings.
+func LoadConfig() error {
+	values, err := readConfigFile(os.Getenv(ConfigFileVar))
+	if err != nil {
+		return err
+	}
+	if err = validateSettings(values); err != nil {
+		return err
+	}
+	fileConfig.Lock()
+	fileConfig.values = values
+	fileConfig.Unlock()
+	return nil
+}
+
+// ReloadConfig re-reads the config file and applies settings which can
+// change without restart. The current config is kept if the new one is invalid.
+func ReloadConfig() error {
+	values, err := readConfigFile(os.Getenv(ConfigFileVar))
+	if err != nil {
+		return err
+	}
+	if err = validateSettings(values); err != nil {
+		return err
+	}
+	fileConfig.RLock()
+	for _, s := range settings {
+		if s.reload || values[s.env] == fileConfig.values[s.env] {
+			continue
+		}
+		logrus.Warningf("Config: %v is changed, restart is required to apply it", s.key)
+		if old, ok := fileConfig.values[s.env]; ok {
+			values[s.env] = old
+		} else {
+			delete(values, s.env)
+		}
+	}
+	fileConfig.RUnlock()
+	fileConfig.Lock()
+	fileConfig.values = values
+	fileConfig.Unlock()
+	logrus.Info("Config reloaded")
+	return nil
+}
+
+func readConfigFile(file string) (map[string]string, error) {
+	values := make(map[string]string)
+	if file == "" {
+		return values, nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read config: %v", err)
+	}
+	conf := &ServerConfig{}
+	if err = yaml.UnmarshalStrict(raw, conf); err != nil {
+		return nil, fmt.Errorf("Invalid config %v: %v", file, err)
+	}
+	set := func(name, value string) {
+		if value != "" && value != "0" && value != "0s" {
+			values[name] = value
+		}
+	}
+	set(dataVar, conf.DataDir)
+	set(portVar, strconv.Itoa(conf.HTTPPort))
+	set(PortGrpcVar, strconv.Itoa(conf.GrpcPort))
+	set(MastersVar, strings.Join(conf.Masters, ","))
+	set(trustedProxiesVar, strings.Join(conf.Proxies, ","))
+	set("DB_TYPE", conf.DB.Type)
+	set(dbNameVar, conf.DB.Name)
+	set(dbHostVar, conf.DB.Host)
+	set(dbPortVar, strconv.Itoa(conf.DB.Port))
+	set(dbUserVar, conf.DB.User)
+	set(dbPassVar, conf.DB.Password)
+	set(authModeVar, conf.Auth.Mode)
+	set(authValidationVar, conf.Auth.ValidationURL)
+	set(internalKeyVar, strings.Join(conf.Auth.InternalKeys, ","))
+	set(jwtKeysVar, conf.Auth.JWT.Keys)
+	set(jwtAudienceVar, conf.Auth.JWT.Audience)
+	set(jwtIssuerVar, conf.Auth.JWT.Issuer)
+	set(jwtUserClaimVar, conf.Auth.JWT.UserClaim)
+	set(jwtScopesClaimVar, conf.Auth.JWT.ScopesClaim)
+	set(uploadConcurrencyVar, strconv.Itoa(conf.Concurrency.Upload))
+	set(gcIntervalVar, conf.GC.Interval.String())
+	set(gcChunksIntervalVar, conf.GC.ChunksInterval.String())
+	set(trashRetentionVar, conf.GC.TrashRetention.String())
+	return values, nil
+}
+
+// validateSettings checks the values of the file overridden by the
+// environment and reports all invalid ones at once.
+func validateSettings(values map[string]string) error {
+	get := func(name string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return values[name]
+	}
+	var errs []string
+	for _, s := range settings {
+		if v := get(s.env); v != "" && s.check != nil {
+			if err := s.check(v); err != nil {
+				errs = append(errs, fmt.Sprintf("%v (%v): %v", s.key, s.env, err))
+			}
+		}
+	}
+	if t := get("DB_TYPE"); (t == "mysql" || t == "postgres") && get(dbHostVar) == "" {
+		errs = append(errs, fmt.Sprintf("db.host (%v): required for %v", dbHostVar, t))
+	}
+	if strings.ToLower(get(authModeVar)) == "jwt" {
+		if get(jwtKeysVar) == "" {
+			errs = append(errs, fmt.Sprintf("auth.jwt.keys (%v): required for jwt auth mode", jwtKeysVar))
+		}
+		if get(jwtAudienceVar) == "" {
+			errs = append(errs, fmt.Sprintf("auth.jwt.audience (%v): required for jwt auth mode", jwtAudienceVar))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid configuration:\n  %v", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func checkPort(v string) error {
+	port, err := strconv.Atoi(v)
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", v)
+	}
+	return nil
+}
+
+func checkPositive(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("must be a positive number, got %q", v)
+	}
+	return nil
+}
+
+func checkDuration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("must be a positive duration like 1h, got %q", v)
+	}
+	return nil
+}
+
+func checkURLs(v string) error {
+	for _, raw := range strings.Split(v, ",") {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", raw)
+		}
+	}
+	return nil
+}
+
+func checkNetworks(v string) error {
+	for _, raw := range strings.Split(v, ",") {
+		if parseNetwork(strings.TrimSpace(raw)) == nil {
+			return fmt.Errorf("invalid IP or CIDR %q", raw)
+		}
+	}
+	return nil
+}
+
+func checkOneOf(allowed ...string) func(string) error {
+	return func(v string) error {
+		for _, a := range allowed {
+			if strings.ToLower(v) == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v, got %q", strings.Join(allowed, ", "), v)
+	}
+}
+
+// EffectiveConfig returns the settings of the server with secrets
+// redacted. Ports are left to the caller which knows its listeners;
+// the database, proxies and GC are the same for all servers.
+func (s *Settings) EffectiveConfig() ServerConfig {
+	atoi := func(v string) int {
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	conf := ServerConfig{
+		DataDir: s.DataDir(),
+		Masters: make([]string, 0),
+		Proxies: make([]string, 0),
+		DB: DBConfig{
+			Type: DBType(),
+			Name: DBName(),
+			Host: DBHost(),
+			Port: atoi(DBPort()),
+			User: DBUser(),
+		},
+		Auth: AuthConfig{
+			Mode:          s.authMode(),
+			ValidationURL: s.AuthValidationURL(),
+			InternalKeys:  make([]string, 0),
+			JWT: JWTConfig{
+				Keys:        s.JWT.Keys,
+				Audience:    s.JWT.Audience,
+				Issuer:      s.JWT.Issuer,
+				UserClaim:   s.JWT.UserClaim,
+				ScopesClaim: s.JWT.ScopesClaim,
+			},
+		},
+		Concurrency: ConcurrencyConfig{
+			Upload: int(s.Uploads()),
+		},
+		GC: GCConfig{
+			Interval:       Duration(GCInterval()),
+			ChunksInterval: Duration(GCChunksInterval()),
+			TrashRetention: Duration(TrashRetention()),
+		},
+	}
+	conf.Masters = append(conf.Masters, s.Masters()...)
+	for _, n := range TrustedProxies() {
+		conf.Proxies = append(conf.Proxies, n.String())
+	}
+	if DBPassword() != "" {
+		conf.DB.Password = redacted
+	}
+	for range s.keys() {
+		conf.Auth.InternalKeys = append(conf.Auth.InternalKeys, redacted)
+	}
+	return conf
+}
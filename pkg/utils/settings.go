@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Settings are the settings which may differ between servers of one
+// process. They are filled once by the caller, e.g. from the environment
+// and the config file by pluksrv; zero values disable the feature.
+// AuthURL and InternalKeys may change later only with SetAuth.
+type Settings struct {
+	// ChunkDir is the directory of chunk files, DATA_DIR.
+	ChunkDir string
+	// MasterURLs are the masters of the slave, MASTERS.
+	MasterURLs []string
+	// AuthMode is "local", "jwt" or empty for the auth service, AUTH_MODE.
+	AuthMode string
+	// AuthURL is the URL of the auth service, AUTH_VALIDATION.
+	AuthURL string
+	// InternalKeys are accepted from slaves, the first one is sent to
+	// masters, INTERNAL_KEY.
+	InternalKeys []string
+	// JWT configures verification of JWTs in the jwt auth mode.
+	JWT JWTSettings
+	// URLSigningKey is the HMAC key of signed URLs, URL_SIGNING_KEY.
+	URLSigningKey string
+	// MinFreeSpace and MinFreeInodes must stay free in the chunk dir,
+	// MIN_FREE_SPACE and MIN_FREE_INODES.
+	MinFreeSpace  int64
+	MinFreeInodes int64
+	// UploadConcurrency limits concurrent writes, 1 if not set,
+	// UPLOAD_CONCURRENCY.
+	UploadConcurrency int64
+
+	lock sync.RWMutex
+}
+
+// JWTSettings are the JWT_* settings.
+type JWTSettings struct {
+	Keys        string
+	Audience    string
+	Issuer      string
+	UserClaim   string
+	ScopesClaim string
+}
+
+// SettingsFromEnv returns the settings from the environment and the
+// config file.
+func SettingsFromEnv() *Settings {
+	return &Settings{
+		ChunkDir:     DataDir(),
+		MasterURLs:   Masters(),
+		AuthMode:     AuthMode(),
+		AuthURL:      AuthValidationURL(),
+		InternalKeys: InternalKeys(),
+		JWT: JWTSettings{
+			Keys:        JWTKeys(),
+			Audience:    JWTAudience(),
+			Issuer:      JWTIssuer(),
+			UserClaim:   JWTUserClaim(),
+			ScopesClaim: JWTScopesClaim(),
+		},
+		URLSigningKey:     URLSigningKey(),
+		MinFreeSpace:      MinFreeSpace(),
+		MinFreeInodes:     MinFreeInodes(),
+		UploadConcurrency: UploadConcurrency(),
+	}
+}
+
+// SetAuth changes the settings reloaded without restart.
+func (s *Settings) SetAuth(authURL string, internalKeys []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.AuthURL = authURL
+	s.InternalKeys = internalKeys
+}
+
+func (s *Settings) DataDir() string {
+	return s.ChunkDir
+}
+
+func (s *Settings) Masters() []string {
+	return s.MasterURLs
+}
+
+func (s *Settings) HasMasters() bool {
+	return len(s.Masters()) > 0
+}
+
+func (s *Settings) AuthValidationURL() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.AuthURL
+}
+
+func (s *Settings) authMode() string {
+	return strings.ToLower(s.AuthMode)
+}
+
+// LocalAuth tells whether requests are authenticated with API tokens
+// managed by pluk itself.
+func (s *Settings) LocalAuth() bool {
+	return s.authMode() == "local"
+}
+
+// JWTAuth tells whether bearer tokens are JWTs verified offline.
+func (s *Settings) JWTAuth() bool {
+	return s.authMode() == "jwt"
+}
+
+// Uploads is the number of concurrent writes.
+func (s *Settings) Uploads() int64 {
+	if s.UploadConcurrency <= 0 {
+		return 1
+	}
+	return s.UploadConcurrency
+}
+
+func (s *Settings) keys() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.InternalKeys
+}
+
+// InternalKey is the key sent with slave-to-master requests.
+func (s *Settings) InternalKey() string {
+	keys := s.keys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+// HasInternalKeys tells whether requests of slaves must carry the key.
+func (s *Settings) HasInternalKeys() bool {
+	return len(s.keys()) > 0
+}
+
+// IsInternalKey reports whether the key is one of the internal keys.
+func (s *Settings) IsInternalKey(key string) bool {
+	return isInternalKey(s.keys(), key)
+}
+
+func isInternalKey(keys []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// ChunkPath returns the path of the chunk file in the chunk dir.
+func (s *Settings) ChunkPath(hash string, version byte) string {
+	return chunkPath(s.DataDir(), hash, version)
+}
+
+// LocalChunkPath maps the chunk path of any server, e.g. from the file
+// structure of the master, to the chunk dir.
+func (s *Settings) LocalChunkPath(path string, version byte) string {
+	return s.ChunkPath(ChunkHash(path, version), version)
+}
+
+// PrintInfo prints the settings at startup.
+func (s *Settings) PrintInfo() {
+	fmt.Printf("DATA_DIR = %q\n", s.DataDir())
+	fmt.Printf("AUTH_VALIDATION = %q\n", s.AuthValidationURL())
+	fmt.Printf("AUTH_MODE = %q\n", s.authMode())
+	fmt.Printf("MASTERS = %q\n", s.Masters())
+	if s.JWTAuth() {
+		fmt.Printf("JWT_KEYS = %q\n", s.JWT.Keys)
+		fmt.Printf("JWT_AUDIENCE = %q\n", s.JWT.Audience)
+		fmt.Printf("JWT_ISSUER = %q\n", s.JWT.Issuer)
+	}
+	fmt.Printf("UPLOAD_CONCURRENCY = %v\n", s.Uploads())
+	fmt.Printf("MIN_FREE_SPACE = %v\n", s.MinFreeSpace)
+	fmt.Printf("MIN_FREE_INODES = %v\n", s.MinFreeInodes)
+}
+
+// ChunkHash returns the hash of the chunk file path of the version,
+// whichever chunk dir the path is in.
+func ChunkHash(path string, version byte) string {
+	parts := 2
+	switch version {
+	case 2:
+		parts = 3
+	case 1:
+		parts = 4
+	}
+	splitted := strings.Split(path, "/")
+	if len(splitted) > parts {
+		splitted = splitted[len(splitted)-parts:]
+	}
+	return strings.Join(splitted, "")
+}
+
+func chunkPath(dir, hash string, version byte) string {
+	if len(hash) < ChunkDirLength {
+		return ""
+	}
+	if version == 2 {
+		return fmt.Sprintf("%v/%v/%v/%v", dir, hash[:2], hash[2:4], hash[4:])
+	} else if version == 1 {
+		return fmt.Sprintf("%v/%v/%v/%v/%v", dir, hash[:2], hash[2:4], hash[4:6], hash[6:])
+	} else if version == 0 {
+		hashDir := hash[:ChunkDirLength]
+		hashFile := hash[ChunkDirLength:]
+		return fmt.Sprintf("%v/%v/%v", dir, hashDir, hashFile)
+	} else {
+		return ""
+	}
+}
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tlsCertVar     = "TLS_CERT_FILE"
+	tlsKeyVar      = "TLS_KEY_FILE"
+	TLSCAFileVar   = "TLS_CA_FILE"
+	TLSInsecureVar = "TLS_INSECURE_SKIP_VERIFY"
+	GrpcTLSVar     = "GRPC_TLS"
+
+	tlsClientCAVar      = "TLS_CLIENT_CA_FILE"
+	tlsClientCertVar    = "TLS_CLIENT_CERT_FILE"
+	tlsClientKeyVar     = "TLS_CLIENT_KEY_FILE"
+	internalSubjectsVar = "INTERNAL_CLIENT_SUBJECTS"
+)
+
+// TLSCertFile and TLSKeyFile are the certificate and key of HTTP and gRPC
+// servers. Servers listen without TLS if they are empty.
+func TLSCertFile() string {
+	return os.Getenv(tlsCertVar)
+}
+
+func TLSKeyFile() string {
+	return os.Getenv(tlsKeyVar)
+}
+
+// TLSCAFile is the CA bundle trusted in addition to system roots
+// for outbound calls to masters and the auth service.
+func TLSCAFile() string {
+	return os.Getenv(TLSCAFileVar)
+}
+
+// TLSInsecure disables verification of outbound TLS connections.
+func TLSInsecure() bool {
+	return strings.ToLower(os.Getenv(TLSInsecureVar)) == "true"
+}
+
+// GrpcTLS tells whether gRPC clients connect with TLS.
+func GrpcTLS() bool {
+	return strings.ToLower(os.Getenv(GrpcTLSVar)) == "true"
+}
+
+// TLSClientCAFile is the CA bundle verifying client certificates of slaves.
+// Servers request client certificates only if it is set.
+func TLSClientCAFile() string {
+	return os.Getenv(tlsClientCAVar)
+}
+
+// TLSClientCertFile and TLSClientKeyFile are the certificate and key
+// presented to masters as the node identity.
+func TLSClientCertFile() string {
+	return os.Getenv(tlsClientCertVar)
+}
+
+func TLSClientKeyFile() string {
+	return os.Getenv(tlsClientKeyVar)
+}
+
+// InternalClientSubjects are the comma-separated common names, DNS names
+// or full subjects of client certificates trusted as slaves.
+func InternalClientSubjects() []string {
+	var subjects []string
+	for _, s := range strings.Split(os.Getenv(internalSubjectsVar), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			subjects = append(subjects, s)
+		}
+	}
+	return subjects
+}
+
+// NodeIdentity returns the common name of the verified client certificate
+// if its subject is in InternalClientSubjects.
+func NodeIdentity(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := state.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName, cert.Subject.String()}, cert.DNSNames...)
+	for _, allowed := range InternalClientSubjects() {
+		for _, name := range names {
+			if name != "" && name == allowed {
+				return cert.Subject.CommonName, true
+			}
+		}
+	}
+	return "", false
+}
+
+// certReloader serves the certificate and reloads it when files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.getCertificate(nil)
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil || modTime.Equal(r.modTime) {
+		if r.cert == nil {
+			return nil, fmt.Errorf("Can't load TLS certificate: %v", err)
+		}
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert == nil {
+			return nil, fmt.Errorf("Can't load TLS certificate: %v", err)
+		}
+		// The files may be written not at once, retry on next handshake.
+		logrus.Errorf("Can't reload TLS certificate, using previous one: %v", err)
+		return r.cert, nil
+	}
+	if r.cert != nil {
+		logrus.Infof("Reloaded TLS certificate %v", r.certFile)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+// ServerTLSConfig returns the config of HTTP and gRPC servers, nil if TLS
+// isn't configured. The certificate is reloaded on change without restart.
+func ServerTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := TLSCertFile(), TLSKeyFile()
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("Both %v and %v must be set", tlsCertVar, tlsKeyVar)
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{GetCertificate: r.getCertificate, MinVersion: tls.VersionTLS12}
+	if caFile := TLSClientCAFile(); caFile != "" {
+		// Clients without certificates still authenticate with other means.
+		pool, err := loadClientCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return conf, nil
+}
+
+func loadClientCAPool(file string) (*x509.CertPool, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("No certificates found in %v", file)
+	}
+	return pool, nil
+}
+
+var caPool = struct {
+	sync.Mutex
+	file    string
+	modTime time.Time
+	pool    *x509.CertPool
+}{}
+
+var clientCert = struct {
+	sync.Mutex
+	reloader *certReloader
+}{}
+
+// NodeTLSConfig is ClientTLSConfig presenting the client certificate,
+// if configured, for internal requests to masters. Requests made on behalf
+// of users must not use it.
+func NodeTLSConfig() *tls.Config {
+	conf := ClientTLSConfig()
+	if r := clientCertReloader(); r != nil {
+		conf.GetClientCertificate = r.getClientCertificate
+	}
+	return conf
+}
+
+// ClientTLSConfig returns the config of outbound connections: servers are
+// verified against system roots and TLSCAFile.
+func ClientTLSConfig() *tls.Config {
+	conf := &tls.Config{InsecureSkipVerify: TLSInsecure()}
+	if file := TLSCAFile(); file != "" {
+		pool, err := LoadCAPool(file)
+		if err != nil {
+			logrus.Errorf("Can't load CA bundle: %v", err)
+		} else {
+			conf.RootCAs = pool
+		}
+	}
+	return conf
+}
+
+func clientCertReloader() *certReloader {
+	certFile, keyFile := TLSClientCertFile(), TLSClientKeyFile()
+	if certFile == "" || keyFile == "" {
+		return nil
+	}
+	clientCert.Lock()
+	defer clientCert.Unlock()
+	r := clientCert.reloader
+	if r == nil || r.certFile != certFile || r.keyFile != keyFile {
+		r = &certReloader{certFile: certFile, keyFile: keyFile}
+		clientCert.reloader = r
+	}
+	return r
+}
+
+// LoadCAPool returns system roots with certificates from the file added.
+// The pool is cached until the file changes.
+func LoadCAPool(file string) (*x509.CertPool, error) {
+	caPool.Lock()
+	defer caPool.Unlock()
+
+	modTime, err := latestModTime(file)
+	if err != nil {
+		return nil, err
+	}
+	if caPool.pool != nil && caPool.file == file && modTime.Equal(caPool.modTime) {
+		return caPool.pool, nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("No certificates found in %v", file)
+	}
+	caPool.file = file
+	caPool.modTime = modTime
+	caPool.pool = pool
+	return pool, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -4,7 +4,8 @@ import (
 	"crypto/sha512"
 	"errors"
 	"fmt"
-	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
 	"runtime"
@@ -16,7 +17,9 @@ import (
 	"github.com/Masterminds/semver"
 	"github.com/gorilla/websocket"
 	"github.com/json-iterator/go"
+	liberrs "github.com/kuberlab/lib/pkg/errors"
 	"github.com/kuberlab/lib/pkg/types"
+	"github.com/sirupsen/logrus"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -28,9 +31,24 @@ const (
 	debug                = "DEBUG"
 	logLevel             = "LOG_LEVEL"
 	authValidationVar    = "AUTH_VALIDATION"
+	authModeVar          = "AUTH_MODE"
+	jwtKeysVar           = "JWT_KEYS"
+	jwtAudienceVar       = "JWT_AUDIENCE"
+	jwtIssuerVar         = "JWT_ISSUER"
+	jwtUserClaimVar      = "JWT_USER_CLAIM"
+	jwtScopesClaimVar    = "JWT_SCOPES_CLAIM"
 	DoNotSaveChunks      = "DO_NOT_SAVE_CHUNKS"
 	internalKeyVar       = "INTERNAL_KEY"
-	readConcurrencyVar   = "READ_CONCURRENCY"
+	manifestKeyVar       = "MANIFEST_SIGNING_KEY"
+	urlSigningKeyVar     = "URL_SIGNING_KEY"
+	trashRetentionVar    = "TRASH_RETENTION"
+	gcIntervalVar        = "GC_INTERVAL"
+	gcChunksIntervalVar  = "GC_CHUNKS_INTERVAL"
+	shutdownTimeoutVar   = "SHUTDOWN_TIMEOUT"
+	workspaceQuotaVar    = "WORKSPACE_QUOTA"
+	auditLogFileVar      = "AUDIT_LOG_FILE"
+	minFreeSpaceVar      = "MIN_FREE_SPACE"
+	minFreeInodesVar     = "MIN_FREE_INODES"
 	uploadConcurrencyVar = "UPLOAD_CONCURRENCY"
 	dataVar              = "DATA_DIR"
 	dbNameVar            = "DB_NAME"
@@ -39,22 +57,19 @@ const (
 	dbPassVar            = "DB_PASSWORD"
 	dbPortVar            = "DB_PORT"
 	MastersVar           = "MASTERS"
+	trustedProxiesVar    = "TRUSTED_PROXIES"
 	portVar              = "PLUK_HTTP_PORT"
 	PortGrpcVar          = "PLUK_GRPC_PORT"
 	prettyPrintVar       = "PRETTY_PRINT"
 	defaultPort          = "8082"
 	defaultGrpcPort      = "8085"
 	defaultDataDir       = "/data"
+	defaultMinFreeSpace  = 100 * 1024 * 1024
+	defaultMinFreeInodes = 1000
 	defaultDBName        = "/pluk/pluke.db"
 	ChunkDirLength       = 8
 )
 
-var (
-	DataDirValue = ""
-	AuthURL      = "unset"
-	UseGrpc      = false
-)
-
 func MustParse(date string) time.Time {
 	t, err := time.ParseInLocation("2006-01-02 15:04:05", date, time.FixedZone("UTC", 0))
 	if err != nil {
@@ -85,21 +100,15 @@ func LogLevel() string {
 }
 
 func DataDir() string {
-	if DataDirValue != "" {
-		return DataDirValue
-	}
-
-	dataDir := os.Getenv(dataVar)
+	dataDir := Getenv(dataVar)
 	if dataDir == "" {
-		DataDirValue = defaultDataDir
 		return defaultDataDir
 	}
-	DataDirValue = dataDir
 	return dataDir
 }
 
 func HttpPort() string {
-	port := os.Getenv(portVar)
+	port := Getenv(portVar)
 	if port == "" {
 		return defaultPort
 	}
@@ -107,7 +116,7 @@ func HttpPort() string {
 }
 
 func GrpcPort() string {
-	port := os.Getenv(PortGrpcVar)
+	port := Getenv(PortGrpcVar)
 	if port == "" {
 		return defaultGrpcPort
 	}
@@ -143,7 +152,7 @@ func DBPort() string {
 }
 
 func FromEnv(varName, defaultVal string) string {
-	val := os.Getenv(varName)
+	val := Getenv(varName)
 	if val == "" {
 		val = defaultVal
 	}
@@ -151,28 +160,188 @@ func FromEnv(varName, defaultVal string) string {
 }
 
 func AuthValidationURL() string {
-	if AuthURL != "unset" {
-		return AuthURL
+	return Getenv(authValidationVar)
+}
+
+// AuthMode is "local" for API tokens managed by pluk itself, "jwt" for
+// JWTs verified offline against JWT_KEYS or empty for AUTH_VALIDATION.
+func AuthMode() string {
+	return strings.ToLower(Getenv(authModeVar))
+}
+
+// JWTKeys is the path to JWKS or PEM file with JWT verification keys.
+func JWTKeys() string {
+	return Getenv(jwtKeysVar)
+}
+
+// JWTAudience is the required "aud" claim.
+func JWTAudience() string {
+	return Getenv(jwtAudienceVar)
+}
+
+// JWTIssuer is the required "iss" claim, not checked if empty.
+func JWTIssuer() string {
+	return Getenv(jwtIssuerVar)
+}
+
+func JWTUserClaim() string {
+	if v := Getenv(jwtUserClaimVar); v != "" {
+		return v
 	}
-	AuthURL = os.Getenv(authValidationVar)
-	return AuthURL
+	return "sub"
 }
 
+func JWTScopesClaim() string {
+	if v := Getenv(jwtScopesClaimVar); v != "" {
+		return v
+	}
+	return "pluk_scopes"
+}
+
+// InternalKey is the key sent with slave-to-master requests, the first
+// one of InternalKeys.
 func InternalKey() string {
-	return os.Getenv(internalKeyVar)
+	keys := InternalKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
 }
 
-func ReadConcurrency() int64 {
-	raw := os.Getenv(readConcurrencyVar)
-	c, err := strconv.ParseInt(raw, 10, 64)
-	if err != nil {
-		return 4
+// InternalKeys are the comma-separated keys accepted from slaves, so
+// the key can be rotated without downtime.
+func InternalKeys() []string {
+	var keys []string
+	for _, k := range strings.Split(Getenv(internalKeyVar), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
 	}
-	return c
+	return keys
+}
+
+// IsInternalKey tells whether the key is one of InternalKeys.
+func IsInternalKey(key string) bool {
+	return isInternalKey(InternalKeys(), key)
+}
+
+// ManifestSigningKey returns the path to ed25519 private key (PKCS#8 PEM)
+// used to sign version manifests on commit. Signing is disabled if empty.
+func ManifestSigningKey() string {
+	return os.Getenv(manifestKeyVar)
+}
+
+// TrashRetention returns how long deleted datasets and versions are kept
+// in trash before GC purges them.
+// URLSigningKey is the HMAC key of signed URLs. Signed URLs are disabled if empty.
+func URLSigningKey() string {
+	return os.Getenv(urlSigningKeyVar)
+}
+
+func TrashRetention() time.Duration {
+	raw := Getenv(trashRetentionVar)
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return time.Hour * 24 * 7
+	}
+	return d
+}
+
+// GCInterval is the period of the garbage collector.
+func GCInterval() time.Duration {
+	d, err := time.ParseDuration(Getenv(gcIntervalVar))
+	if err != nil || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
+
+// GCChunksInterval is the period of deleting chunk files unknown to the database.
+func GCChunksInterval() time.Duration {
+	d, err := time.ParseDuration(Getenv(gcChunksIntervalVar))
+	if err != nil || d <= 0 {
+		return time.Hour * 24
+	}
+	return d
+}
+
+// ShutdownTimeout limits draining of requests and background jobs on
+// SIGTERM, it should be less than the grace period of the pod.
+func ShutdownTimeout() time.Duration {
+	raw := os.Getenv(shutdownTimeoutVar)
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return time.Second * 25
+	}
+	return d
+}
+
+// WorkspaceQuota is the default quota in bytes for workspaces without
+// their own one, 0 means unlimited.
+func WorkspaceQuota() int64 {
+	raw := os.Getenv(workspaceQuotaVar)
+	q, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || q < 0 {
+		return 0
+	}
+	return q
+}
+
+// AuditLogFile is the file audit records are appended to as JSON lines.
+func AuditLogFile() string {
+	return os.Getenv(auditLogFileVar)
+}
+
+// TrustedProxies are the networks of reverse proxies whose X-Forwarded-For
+// header is taken as the client address.
+func TrustedProxies() []*net.IPNet {
+	var res []*net.IPNet
+	for _, raw := range strings.Split(Getenv(trustedProxiesVar), ",") {
+		if n := parseNetwork(strings.TrimSpace(raw)); n != nil {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// parseNetwork parses the CIDR or the single IP.
+func parseNetwork(raw string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(raw); err == nil {
+		return n
+	}
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// MinFreeSpace is the free space in bytes DATA_DIR must keep: chunk writes
+// are rejected below it.
+func MinFreeSpace() int64 {
+	raw := os.Getenv(minFreeSpaceVar)
+	s, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || s < 0 {
+		return defaultMinFreeSpace
+	}
+	return s
+}
+
+// MinFreeInodes is the number of free inodes DATA_DIR must keep.
+func MinFreeInodes() int64 {
+	raw := os.Getenv(minFreeInodesVar)
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return defaultMinFreeInodes
+	}
+	return n
 }
 
 func DBType() string {
-	dbType := os.Getenv("DB_TYPE")
+	dbType := Getenv("DB_TYPE")
 	if dbType == "" {
 		dbType = "sqlite3"
 	}
@@ -180,7 +349,7 @@ func DBType() string {
 }
 
 func UploadConcurrency() int64 {
-	raw := os.Getenv(uploadConcurrencyVar)
+	raw := Getenv(uploadConcurrencyVar)
 	c, err := strconv.ParseInt(raw, 10, 64)
 	if err != nil {
 		if DBType() == "sqlite3" {
@@ -192,7 +361,7 @@ func UploadConcurrency() int64 {
 }
 
 func Masters() []string {
-	mastersRaw := os.Getenv(MastersVar)
+	mastersRaw := Getenv(MastersVar)
 	if mastersRaw == "" {
 		return make([]string, 0)
 	}
@@ -222,42 +391,24 @@ func CalcHash(data []byte) string {
 }
 
 func GetHashedFilename(hash string, version byte) string {
-	if version == 2 {
-		return fmt.Sprintf("%v/%v/%v/%v", DataDir(), hash[:2], hash[2:4], hash[4:])
-	} else if version == 1 {
-		return fmt.Sprintf("%v/%v/%v/%v/%v", DataDir(), hash[:2], hash[2:4], hash[4:6], hash[6:])
-	} else if version == 0 {
-		hashDir := hash[:ChunkDirLength]
-		hashFile := hash[ChunkDirLength:]
-		return fmt.Sprintf("%v/%v/%v", DataDir(), hashDir, hashFile)
-	} else {
-		return ""
-	}
-}
-
-func GetHashFromPath(path string) (hash string, version byte) {
-	hash = strings.TrimPrefix(path, DataDir())
-	cnt := strings.Count(hash, "/")
-	if cnt == 3 {
-		version = 2
-	} else if cnt == 4 {
-		version = 1
-	} else {
-		version = 0
-	}
-	hash = strings.Replace(hash, "/", "", -1)
-	return
+	return chunkPath(DataDir(), hash, version)
 }
 
 func PrintEnvInfo() {
 	fmt.Printf("DEBUG = %v\n", DebugEnabled())
-	fmt.Printf("DATA_DIR = %q\n", DataDir())
 	fmt.Printf("HTTP_PORT = %q\n", HttpPort())
-	fmt.Printf("AUTH_VALIDATION = %q\n", AuthValidationURL())
-	fmt.Printf("MASTERS = %q\n", Masters())
-	fmt.Printf("READ_CONCURRENCY = %v\n", ReadConcurrency())
-	fmt.Printf("UPLOAD_CONCURRENCY = %v\n", UploadConcurrency())
+	fmt.Printf("TLS_CERT_FILE = %q\n", TLSCertFile())
+	fmt.Printf("TLS_CA_FILE = %q\n", TLSCAFile())
+	fmt.Printf("TLS_INSECURE_SKIP_VERIFY = %v\n", TLSInsecure())
 	fmt.Printf("SAVE_CHUNKS = %v\n", SaveChunks())
+	fmt.Printf("MANIFEST_SIGNING_KEY = %q\n", ManifestSigningKey())
+	fmt.Printf("TRASH_RETENTION = %v\n", TrashRetention())
+	fmt.Printf("GC_INTERVAL = %v\n", GCInterval())
+	fmt.Printf("GC_CHUNKS_INTERVAL = %v\n", GCChunksInterval())
+	fmt.Printf("SHUTDOWN_TIMEOUT = %v\n", ShutdownTimeout())
+	fmt.Printf("WORKSPACE_QUOTA = %v\n", WorkspaceQuota())
+	fmt.Printf("AUDIT_LOG_FILE = %q\n", AuditLogFile())
+	fmt.Printf("TRUSTED_PROXIES = %v\n", TrustedProxies())
 }
 
 func GetFirstN(s []string, n int) []string {
@@ -355,6 +506,10 @@ func Retry(description string, delaySec float64, retries int, f interface{}, arg
 	if err == nil {
 		return res, nil
 	}
+	if e, ok := err.(*liberrs.Error); ok && e.Status == http.StatusInsufficientStorage {
+		// Retrying won't free the space.
+		return res, err
+	}
 
 	//timeoutDur := time.Duration(int64(float64(time.Second) * timeoutSec))
 	delayDur := time.Duration(int64(float64(time.Second) * delaySec))
@@ -375,8 +530,11 @@ func Retry(description string, delaySec float64, retries int, f interface{}, arg
 			if err == nil {
 				return res, nil
 			}
+			if e, ok := err.(*liberrs.Error); ok && e.Status == http.StatusInsufficientStorage {
+				return res, err
+			}
 			step++
-			if step + 1 >= retries {
+			if step+1 >= retries {
 				return res, errors.New(
 					fmt.Sprintf(
 						"Max retries (%v) exceeded while waiting for %v: %v",
@@ -384,8 +542,8 @@ func Retry(description string, delaySec float64, retries int, f interface{}, arg
 					),
 				)
 			}
-		//case <-timeout.C:
-		//	return res, errors.New(fmt.Sprintf("Timeout while waiting for %v: %v", vf.String(), err))
+			//case <-timeout.C:
+			//	return res, errors.New(fmt.Sprintf("Timeout while waiting for %v: %v", vf.String(), err))
 		}
 	}
 }
@@ -1,21 +1,114 @@
 package main
 
 import (
-	"github.com/sirupsen/logrus"
-	"github.com/kuberlab/pluk/pkg/api"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/kuberlab/pluk/pkg/db"
-	"github.com/kuberlab/pluk/pkg/gc"
-	"github.com/kuberlab/pluk/pkg/grpc"
+	"github.com/kuberlab/pluk/pkg/pluk"
 	"github.com/kuberlab/pluk/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	if err := utils.LoadConfig(); err != nil {
+		logrus.Fatal(err)
+	}
 	if utils.DebugEnabled() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, TimestampFormat: "2006-01-02 15:04:05"})
-	db.DbMgr = db.NewMainDatabaseMgr()
-	go gc.Start()
-	go grpc.Start()
-	api.Start(api.Build())
+	mgr := db.NewMainDatabaseMgr()
+	// Nobody will finish jobs of the previous process.
+	if err := mgr.FailUnfinishedJobs("Interrupted by restart"); err != nil {
+		logrus.Errorf("[Jobs] %v", err)
+	}
+	utils.PrintEnvInfo()
+	opts, err := options(mgr)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	server, err := pluk.New(opts)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err = server.Start(); err != nil {
+		logrus.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			if err := utils.ReloadConfig(); err != nil {
+				logrus.Errorf("Config is not reloaded: %v", err)
+				continue
+			}
+			server.Reload(authOptions())
+			continue
+		}
+		logrus.Infof("Received %v, shutting down...", sig)
+		go func() {
+			for sig := range signals {
+				if sig != syscall.SIGHUP {
+					logrus.Warn("Forced shutdown.")
+					os.Exit(1)
+				}
+			}
+		}()
+		shutdown(server, mgr)
+		return
+	}
+}
+
+// options are read from the environment and the config file once,
+// only authOptions are reloaded.
+func options(mgr db.DataMgr) (pluk.Options, error) {
+	tlsConfig, err := utils.ServerTLSConfig()
+	if err != nil {
+		return pluk.Options{}, err
+	}
+	return pluk.Options{
+		DataMgr:           mgr,
+		ChunkDir:          utils.DataDir(),
+		Masters:           utils.Masters(),
+		Auth:              authOptions(),
+		URLSigningKey:     utils.URLSigningKey(),
+		MinFreeSpace:      utils.MinFreeSpace(),
+		MinFreeInodes:     utils.MinFreeInodes(),
+		UploadConcurrency: utils.UploadConcurrency(),
+		HTTPAddr:          ":" + utils.HttpPort(),
+		GrpcAddr:          ":" + utils.GrpcPort(),
+		TLS:               tlsConfig,
+	}, nil
+}
+
+func authOptions() pluk.AuthOptions {
+	return pluk.AuthOptions{
+		Mode:          utils.AuthMode(),
+		ValidationURL: utils.AuthValidationURL(),
+		InternalKeys:  utils.InternalKeys(),
+		JWT: utils.JWTSettings{
+			Keys:        utils.JWTKeys(),
+			Audience:    utils.JWTAudience(),
+			Issuer:      utils.JWTIssuer(),
+			UserClaim:   utils.JWTUserClaim(),
+			ScopesClaim: utils.JWTScopesClaim(),
+		},
+	}
+}
+
+// shutdown stops the server and closes the database at last.
+func shutdown(server *pluk.Server, mgr db.DataMgr) {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.ShutdownTimeout())
+	defer cancel()
+
+	// Errors are logged by the server.
+	_ = server.Shutdown(ctx)
+	if err := mgr.Close(); err != nil {
+		logrus.Error(err)
+	}
+	logrus.Info("Shutdown complete.")
 }